@@ -0,0 +1,85 @@
+package initramfs
+
+import "strings"
+
+// The suggested prefix for the filenames of padding entries, see
+// [Writer.SetAlignmentPadEntries].
+const DefaultAlignmentPadPrefix = ".initramfs-pad"
+
+// The largest filename (including the trailing 0) that a padding entry is
+// given, matching the Linux PATH_MAX that the kernel enforces.
+const maxPadFilenameSize = 4096
+
+// When prefix is not empty, the padding that [Writer.SetDataAlignment] (or
+// [Writer.SetHeaderAlignment], or the default data alignment) inserts before a
+// header is written as one or more empty regular file entries, rather than as
+// zero bytes. Each has a filename consisting of prefix followed by as many
+// underscores as are needed to reach the desired length, which makes them
+// recognizable. If the padding required is shorter than such an entry, a
+// further multiple of the alignment is added.
+//
+// The kernel skips zero padding between entries, but other cpio tools may
+// reject or warn about it; padding entries keep the output a strictly
+// contiguous sequence of entries. The kernel will create each as an empty file,
+// named relative to the root. An empty prefix (the default) restores zero
+// padding. The prefix should not contain any slashes.
+func (iw *Writer) SetAlignmentPadEntries(prefix string) { iw.padEntryPrefix = prefix }
+
+// Write fill bytes of padding (a multiple of 4), or if enabled, padding
+// entries of at least that length and congruent to it modulo alignTo.
+func (iw *Writer) writeFill(fill, alignTo int64) error {
+	if iw.padEntryPrefix == "" || fill == 0 {
+		return iw.writePad(fill)
+	}
+
+	var (
+		// The size of the smallest and largest padding entries, each being a
+		// header and filename followed by alignment
+		minEntry = alignUp(HeaderSize+int64(len(iw.padEntryPrefix))+1, 4)
+		maxEntry = int64(HeaderSize+maxPadFilenameSize) &^ 3
+	)
+
+	for fill < minEntry {
+		fill += alignTo
+	}
+
+	for fill > 0 {
+		var size = fill
+		if size > maxEntry {
+			// Leave enough for at least one more entry
+			size = min(maxEntry, fill-minEntry) &^ 3
+		}
+
+		if err := iw.writePadEntry(size); err != nil {
+			return err
+		}
+
+		fill -= size
+	}
+
+	return nil
+}
+
+// Write an empty file entry that, along with the alignment that follows it,
+// occupies exactly size bytes (a multiple of 4).
+func (iw *Writer) writePadEntry(size int64) error {
+	// A filename of length size-112 plus its trailing 0 gives size-1 bytes,
+	// with a single byte of alignment
+	var hdr = Header{
+		Magic:    iw.defaultMagic,
+		Mode:     Mode_File,
+		NumLinks: 1,
+		Filename: iw.padEntryPrefix + strings.Repeat("_", int(size-HeaderSize-2)-len(iw.padEntryPrefix)),
+	}
+	hdr.FilenameSize = uint32(len(hdr.Filename) + 1)
+
+	n, err := hdr.WriteTo(iw.curW)
+	iw.written += n
+	if err != nil {
+		return err
+	}
+
+	iw.stats.add(&hdr, n)
+
+	return iw.writeAlignment(4)
+}
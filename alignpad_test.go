@@ -0,0 +1,68 @@
+package initramfs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriter_SetAlignmentPadEntries(t *testing.T) {
+	for _, alignTo := range []int{16, 512, 8192} {
+		for _, prefix := range []string{"", DefaultAlignmentPadPrefix} {
+			w, r := testWriterReader(t)
+
+			w.SetAlignmentPadEntries(prefix)
+
+			// Filenames of every length modulo 4, each within a directory that
+			// is created automatically
+			for _, name := range []string{"a/b", "a/bc", "a/bcd", "a/bcde"} {
+				if err := w.SetDataAlignment(alignTo); err != nil {
+					t.Fatalf("SetDataAlignment: %s", err)
+				}
+
+				if err := w.WriteFile(name, 0o644, []byte(name)); err != nil {
+					t.Fatalf("WriteFile %s: %s", name, err)
+				}
+			}
+
+			if err := w.WriteTrailer(); err != nil {
+				t.Fatalf("WriteTrailer: %s", err)
+			}
+
+			var (
+				files, pads int
+				end         int64 // Of the previous entry, after alignment
+			)
+
+			for _, hdr := range r.All() {
+				if strings.HasPrefix(hdr.Filename, DefaultAlignmentPadPrefix) {
+					pads++
+
+					if hdr.DataSize != 0 || hdr.FilenameSize > maxPadFilenameSize {
+						t.Errorf("unexpected padding entry %+v", hdr)
+					}
+				} else if hdr.Mode.File() {
+					files++
+
+					if hdr.DataOffset%int64(alignTo) != 0 {
+						t.Errorf("%d %q: %s: data offset %d is not aligned", alignTo, prefix, hdr.Filename, hdr.DataOffset)
+					}
+				}
+
+				// With padding entries, every header immediately follows the
+				// previous entry
+				if prefix != "" && hdr.HeaderOffset != end {
+					t.Errorf("%d: %s: expected header at %d, got %d", alignTo, hdr.Filename, end, hdr.HeaderOffset)
+				}
+				end = alignUp(hdr.DataOffset+int64(hdr.DataSize), 4)
+			}
+
+			if files != 4 {
+				t.Errorf("%d %q: expected 4 files, got %d", alignTo, prefix, files)
+			}
+
+			if (pads > 0) != (prefix != "") {
+				t.Errorf("%d %q: unexpected %d padding entries", alignTo, prefix, pads)
+			}
+		}
+	}
+}
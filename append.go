@@ -0,0 +1,266 @@
+package initramfs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+var ErrAppendCompressed = errors.New("initramfs: cannot append to an archive containing compressed content")
+
+// Create a writer that extends the existing uncompressed archive in rws (such
+// as an [os.File] opened for reading and writing), which must start at offset
+// 0.
+//
+// The headers of the archive are scanned, seeking over the file data rather
+// than reading it (see [Reader.BuildIndex]). The writer is positioned to
+// overwrite the final trailer and any padding that follows (the file is
+// truncated there if rws has a Truncate method), and continues the inode
+// numbering and the tracking of existing directories. Subsequent entries
+// extend the archive, which should be finished with [Writer.WriteTrailer].
+//
+// Returns [ErrAppendCompressed] if the archive contains compressed content.
+func NewAppender(rws io.ReadWriteSeeker) (*Writer, error) {
+	if _, err := rws.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	hdrs, err := NewReader(rws).BuildIndex()
+	if err == ErrCompressedContentAhead {
+		return nil, ErrAppendCompressed
+	} else if err != nil {
+		return nil, err
+	}
+
+	var (
+		iw  = NewWriter(rws)
+		end int64
+	)
+
+	for _, hdr := range hdrs {
+		if hdr.Trailer() {
+			// Drop any trailer, as more entries may follow it
+			continue
+		}
+
+		end = hdr.DataOffset + int64(hdr.DataSize)
+		iw.nextInode = max(iw.nextInode, hdr.Inode+1)
+
+		if hdr.Mode.Dir() {
+			iw.mkdirs[normalizeName(hdr.Filename)] = struct{}{}
+		}
+	}
+
+	if t, ok := rws.(interface{ Truncate(int64) error }); ok {
+		if err := t.Truncate(end); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := rws.Seek(end, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	iw.out.n = end
+	iw.written = end
+
+	return iw, nil
+}
+
+// When enabled, [Writer.AppendArchive] drops the trailer (along with any
+// padding that follows it) at the end of an uncompressed archive, such that its
+// entries are merged with those written afterwards into a single archive.
+func (iw *Writer) SetMergeAppended(merge bool) { iw.mergeAppended = merge }
+
+// Copy an already formed archive, which may be compressed, verbatim into the
+// output without parsing its entries. This is far cheaper than copying it entry
+// by entry, but the writer has no knowledge of its contents, such as the
+// directories and inodes it contains.
+//
+// Any data remaining for the current file is first padded with zeros. An
+// uncompressed archive is then preceded by padding to a 4 byte boundary, and if
+// merging (see [Writer.SetMergeAppended]), its final trailer is dropped. A
+// compressed archive is preceded by padding to a multiple of
+// [StartCompressionAlignment], and is assumed to be complete; it may not be
+// appended while compressing, in which case [ErrAlreadyCompressed] is returned.
+//
+// Returns an [UnexpectedContentError] if r starts with neither a newc cpio
+// header, zero padding nor recognized compressed data, with the offset being
+// that of the output.
+func (iw *Writer) AppendArchive(r io.Reader) error {
+	if iw.closed {
+		return os.ErrClosed
+	}
+
+	if err := iw.skipFileRemaining(); err != nil {
+		return err
+	}
+
+	var br = bufio.NewReader(r)
+
+	la, err := PeekLookahead(br)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case la == EOF:
+		return nil
+
+	case la.Compression():
+		if iw.compressed {
+			return ErrAlreadyCompressed
+		}
+
+		if err := iw.writeAlignment(StartCompressionAlignment); err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(writerFunc(iw.write), br); err != nil {
+			return err
+		}
+
+		iw.endedWithTrailer()
+
+	case la == CpioFile, la == Padding:
+		if err := iw.writeAlignment(4); err != nil {
+			return err
+		}
+
+		var ts = trailerStripper{iw: iw}
+		if _, err := io.Copy(&ts, br); err != nil {
+			return err
+		}
+
+		trailer, err := ts.finish(iw.mergeAppended)
+		if err != nil {
+			return err
+		}
+
+		if trailer && !iw.mergeAppended {
+			iw.endedWithTrailer()
+		} else if ts.entries {
+			iw.trailerDue = true
+		}
+
+	default:
+		peek, _ := br.Peek(8)
+		return &UnexpectedContentError{Offset: iw.written, Peek: bytes.Clone(peek)}
+	}
+
+	return nil
+}
+
+// Forget the state that a trailer ends, as when writing one.
+func (iw *Writer) endedWithTrailer() {
+	clear(iw.mkdirs)
+	clear(iw.links)
+	iw.trailerDue = false
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (fn writerFunc) Write(p []byte) (int, error) { return fn(p) }
+
+// The length of a trailer header and its filename, excluding the terminating 0.
+const trailerTailSize = HeaderSize + int64(len(TrailerFilename))
+
+// Copies an uncompressed archive to the writer, while holding back its end so
+// that a final trailer (and the zero padding that follows it) can be
+// identified, and if desired, dropped.
+type trailerStripper struct {
+	iw      *Writer
+	tail    []byte // Up to trailerTailSize bytes preceding any trailing zeros
+	zeros   int64  // Trailing zero bytes
+	entries bool   // Whether any non-zero bytes have been seen
+}
+
+func (ts *trailerStripper) Write(p []byte) (int, error) {
+	var last = len(p) - 1
+	for last >= 0 && p[last] == 0 {
+		last--
+	}
+
+	if last < 0 {
+		ts.zeros += int64(len(p))
+		return len(p), nil
+	}
+
+	ts.entries = true
+
+	var data = p[:last+1]
+
+	if int64(len(data)) >= trailerTailSize {
+		if err := ts.emit(); err != nil {
+			return 0, err
+		}
+
+		var split = int64(len(data)) - trailerTailSize
+		if _, err := ts.iw.write(data[:split]); err != nil {
+			return 0, err
+		}
+
+		ts.tail = append(ts.tail[:0], data[split:]...)
+	} else {
+		if excess := ts.zeros - trailerTailSize; excess > 0 {
+			// Only the zeros nearest the new data need remain held back
+			if _, err := ts.iw.write(ts.tail); err != nil {
+				return 0, err
+			}
+			if err := ts.iw.writePad(excess); err != nil {
+				return 0, err
+			}
+
+			ts.tail = ts.tail[:0]
+			ts.zeros = trailerTailSize
+		}
+
+		var held = append(append(ts.tail, zeroPadding[:ts.zeros]...), data...)
+
+		if split := int64(len(held)) - trailerTailSize; split > 0 {
+			if _, err := ts.iw.write(held[:split]); err != nil {
+				return 0, err
+			}
+			held = held[split:]
+		}
+
+		ts.tail = bytes.Clone(held)
+	}
+
+	ts.zeros = int64(len(p) - len(data))
+	return len(p), nil
+}
+
+// Write the held back bytes.
+func (ts *trailerStripper) emit() error {
+	if _, err := ts.iw.write(ts.tail); err != nil {
+		return err
+	}
+	ts.tail = ts.tail[:0]
+
+	err := ts.iw.writePad(ts.zeros)
+	ts.zeros = 0
+	return err
+}
+
+// Reports whether the archive ended with a trailer, and writes the held back
+// bytes unless they are that trailer and strip is set.
+func (ts *trailerStripper) finish(strip bool) (trailer bool, err error) {
+	if int64(len(ts.tail)) == trailerTailSize {
+		var (
+			hdr Header
+			raw = io.MultiReader(bytes.NewReader(ts.tail), bytes.NewReader([]byte{0}))
+		)
+
+		_, err := hdr.readFrom(raw, len(TrailerFilename)+1)
+		trailer = err == nil && hdr.Trailer() && hdr.Magic != Magic_070707
+	}
+
+	if trailer && strip {
+		return true, nil
+	}
+
+	return trailer, ts.emit()
+}
@@ -0,0 +1,208 @@
+package initramfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+func TestNewAppender(t *testing.T) {
+	var name = filepath.Join(t.TempDir(), "initramfs.cpio")
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	w := NewWriter(f)
+	w.SetTrailerPadding(512)
+	if err := w.WriteFile("etc/hosts", 0o644, []byte("127.0.0.1 localhost\n")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	f, err = os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %s", err)
+	}
+
+	w, err = NewAppender(f)
+	if err != nil {
+		t.Fatalf("NewAppender: %s", err)
+	}
+	if err := w.WriteFile("etc/passwd", 0o644, []byte("root:x:0:0::/root:/bin/sh\n")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+
+	var (
+		hdrs   headerList
+		inodes = make(map[uint32]string)
+		r      = NewReader(bytes.NewReader(raw))
+	)
+	for hdr, err := range r.AllErr() {
+		if err != nil {
+			t.Fatalf("AllErr: %s", err)
+		}
+
+		hdrs = append(hdrs, hdr)
+
+		if other, ok := inodes[hdr.Inode]; ok && !hdr.Trailer() {
+			t.Errorf("%s: inode %d already used by %s", hdr.Filename, hdr.Inode, other)
+		}
+		inodes[hdr.Inode] = hdr.Filename
+	}
+
+	hdrs.expectNames(t, ".", "etc", "etc/hosts", "etc/passwd", TrailerFilename)
+}
+
+func TestNewAppenderCompressed(t *testing.T) {
+	var name = filepath.Join(t.TempDir(), "initramfs.cpio.gz")
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	defer f.Close()
+
+	w := NewWriter(f)
+	if err := w.StartCompression(GzipWriter); err != nil {
+		t.Fatalf("StartCompression: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+	if err := w.EndCompression(); err != nil {
+		t.Fatalf("EndCompression: %s", err)
+	}
+
+	if _, err := NewAppender(f); !errors.Is(err, ErrAppendCompressed) {
+		t.Errorf("expected ErrAppendCompressed, got %v", err)
+	}
+}
+
+func TestWriter_AppendArchive(t *testing.T) {
+	var sub bytes.Buffer
+
+	sw := NewWriter(&sub)
+	sw.SetTrailerPadding(512)
+	if err := sw.WriteFile("lib/firmware/blob", 0o644, append([]byte("blob"), make([]byte, 1000)...)); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := sw.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	for _, merge := range []bool{false, true} {
+		for _, oneByte := range []bool{false, true} {
+			var buf bytes.Buffer
+
+			w := NewWriter(&buf)
+			w.SetMergeAppended(merge)
+
+			if err := w.WriteFile("init", 0o755, []byte("#!/bin/sh\n")); err != nil {
+				t.Fatalf("WriteFile: %s", err)
+			}
+
+			var src io.Reader = bytes.NewReader(sub.Bytes())
+			if oneByte {
+				src = iotest.OneByteReader(src)
+			}
+
+			if err := w.AppendArchive(src); err != nil {
+				t.Fatalf("AppendArchive: %s", err)
+			}
+
+			if err := w.WriteFile("etc/hosts", 0o644, nil); err != nil {
+				t.Fatalf("WriteFile: %s", err)
+			}
+			if err := w.WriteTrailer(); err != nil {
+				t.Fatalf("WriteTrailer: %s", err)
+			}
+
+			var (
+				r    = NewReader(&buf)
+				hdrs headerList
+			)
+
+			for _, hdr := range r.All() {
+				hdrs = append(hdrs, hdr)
+
+				if hdr.Filename == "lib/firmware/blob" {
+					if data, err := io.ReadAll(r); err != nil || !bytes.HasPrefix(data, []byte("blob")) || len(data) != 1004 {
+						t.Errorf("unexpected blob data of length %d (%v)", len(data), err)
+					}
+				}
+			}
+
+			var names = []string{".", "init", ".", "lib", "lib/firmware", "lib/firmware/blob"}
+			if merge {
+				names = append(names, "etc", "etc/hosts", TrailerFilename)
+			} else {
+				names = append(names, TrailerFilename, ".", "etc", "etc/hosts", TrailerFilename)
+			}
+
+			hdrs.expectNames(t, names...)
+		}
+	}
+}
+
+func TestWriter_AppendArchiveCompressed(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+
+	if err := w.WriteFile("init", 0o755, []byte("#!/bin/sh\n")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	if err := w.AppendArchive(bytes.NewReader(testSegmentedArchive(t, false))); err != nil {
+		t.Fatalf("AppendArchive: %s", err)
+	}
+
+	var codecs []Lookahead
+	for seg, err := range NewReader(&buf).Segments() {
+		if err != nil {
+			t.Fatalf("Segments: %s", err)
+		}
+		codecs = append(codecs, seg.Compression)
+	}
+
+	if len(codecs) != 2 || codecs[1] != Gzip {
+		t.Errorf("expected an uncompressed and a gzip segment, got %v", codecs)
+	}
+
+	if err := w.StartCompressionType(Gzip); err != nil {
+		t.Fatalf("StartCompressionType: %s", err)
+	}
+	if err := w.AppendArchive(bytes.NewReader(testSegmentedArchive(t, false))); err != ErrAlreadyCompressed {
+		t.Errorf("expected ErrAlreadyCompressed, got %v", err)
+	}
+
+	var ucErr *UnexpectedContentError
+	if err := w.AppendArchive(bytes.NewReader([]byte("garbage!"))); !errors.As(err, &ucErr) {
+		t.Errorf("expected UnexpectedContentError, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package initramfs
+
+import (
+	"bytes"
+	"cmp"
+	"io"
+	"slices"
+)
+
+// Accumulates entries in memory so that they can be written to an archive in a
+// controlled order. The zero value is ready to use.
+type Builder struct {
+	entries []builderEntry
+	order   map[string]int
+}
+
+type builderEntry struct {
+	hdr  Header
+	data []byte
+}
+
+// Add an entry with the given file data. The DataSize of the header is set
+// from the length of data.
+func (b *Builder) Add(hdr Header, data []byte) error {
+	if err := hdr.SetDataSize(int64(len(data))); err != nil {
+		return err
+	}
+
+	b.entries = append(b.entries, builderEntry{hdr, data})
+	return nil
+}
+
+// Record the order of the entries in the reference archive, so that
+// [Builder.WriteEntries] will emit any entries with matching (normalized)
+// filenames in that same sequence. Entries not present in the reference are
+// emitted afterwards, in the order they were added.
+//
+// This helps to produce an archive that is byte-for-byte comparable with an
+// existing image.
+func (b *Builder) OrderLike(reference *Reader) error {
+	var order = make(map[string]int)
+
+	err := reference.walk(func(hdr *Header) error {
+		if hdr.Trailer() {
+			return nil
+		}
+
+		var name = normalizeName(hdr.Filename)
+		if _, ok := order[name]; !ok {
+			order[name] = len(order)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	b.order = order
+	return nil
+}
+
+// Write all of the entries to the writer, ordered as per [Builder.OrderLike].
+// No trailer is written.
+func (b *Builder) WriteEntries(iw *Writer) error {
+	var entries = slices.Clone(b.entries)
+
+	if b.order != nil {
+		var rank = func(e *builderEntry) int {
+			if i, ok := b.order[normalizeName(e.hdr.Filename)]; ok {
+				return i
+			}
+			return len(b.order)
+		}
+
+		slices.SortStableFunc(entries, func(x, y builderEntry) int {
+			return cmp.Compare(rank(&x), rank(&y))
+		})
+	}
+
+	return writeEntries(iw, entries)
+}
+
+func writeEntries(iw *Writer, entries []builderEntry) error {
+	for i := range entries {
+		var e = &entries[i]
+
+		if err := iw.WriteHeader(&e.hdr); err != nil {
+			return err
+		}
+
+		// The data may have been dropped when coalescing hard links
+		if e.hdr.DataSize > 0 {
+			if _, err := iw.ReadFrom(bytes.NewReader(e.data)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Report the size of the complete archive (the entries of b followed by a
+// trailer) when compressed with each of the given codecs, using the writers
+// registered in [CompressWriters]. This can help when choosing a compressor.
+//
+// Returns [ErrNoCompressWriter] if any codec has no registered writer.
+func CompressionReport(b *Builder, codecs []Lookahead) (map[Lookahead]int64, error) {
+	var sizes = make(map[Lookahead]int64, len(codecs))
+
+	for _, la := range codecs {
+		var (
+			cw = &countWriter{w: io.Discard}
+			iw = NewWriter(cw)
+		)
+
+		if err := iw.StartCompressionType(la); err != nil {
+			return nil, err
+		}
+
+		if err := b.WriteEntries(iw); err != nil {
+			return nil, err
+		}
+
+		if err := iw.WriteTrailer(); err != nil {
+			return nil, err
+		}
+
+		if err := iw.EndCompression(); err != nil {
+			return nil, err
+		}
+
+		sizes[la] = cw.n
+	}
+
+	return sizes, nil
+}
+
+// Build an archive in memory, returning its bytes. A writer is created with the
+// given options (see [NewWriterOptions]) and passed to fn, after which a
+// trailer is written if one has not already followed the last entry, and the
+// writer is closed (see [Writer.SetAutoTrailer]).
+//
+// Returns the first error from creating the writer, from fn, or from closing.
+func Build(fn func(iw *Writer) error, opts ...WriterOption) ([]byte, error) {
+	var buf bytes.Buffer
+
+	iw, err := NewWriterOptions(&buf, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fn(iw); err != nil {
+		return nil, err
+	}
+
+	iw.SetAutoTrailer(true)
+
+	if err := iw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,132 @@
+package initramfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"testing"
+)
+
+func TestBuilder_OrderLike(t *testing.T) {
+	var ref bytes.Buffer
+
+	rw := NewWriter(&ref)
+	for _, name := range []string{"/", "/etc", "/init", "/bin", "/etc/hostname"} {
+		testMkdirHeader(t, rw, name, nil)
+	}
+	if err := rw.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var b Builder
+
+	for _, name := range []string{".", "bin", "etc"} {
+		if err := b.Add(Header{Mode: Mode_Dir | 0o755, Filename: name}, nil); err != nil {
+			t.Fatalf("Add: %s", err)
+		}
+	}
+
+	for _, name := range []string{"etc/hostname", "extra", "init"} {
+		if err := b.Add(Header{Mode: Mode_File | 0o644, Filename: name}, []byte(name)); err != nil {
+			t.Fatalf("Add: %s", err)
+		}
+	}
+
+	if err := b.OrderLike(NewReader(&ref)); err != nil {
+		t.Fatalf("OrderLike: %s", err)
+	}
+
+	w, r := testWriterReader(t)
+
+	if err := b.WriteEntries(w); err != nil {
+		t.Fatalf("WriteEntries: %s", err)
+	}
+
+	var hdrs headerList
+	for _, hdr := range r.All() {
+		hdrs = append(hdrs, hdr)
+		if !hdr.Mode.File() {
+			continue
+		}
+
+		var data = make([]byte, hdr.DataSize)
+		r.Read(data)
+		if string(data) != hdr.Filename {
+			t.Errorf("%s: expected data %q, got %q", hdr.Filename, hdr.Filename, data)
+		}
+	}
+
+	hdrs.expectNames(t,
+		".",
+		"etc",
+		"init",
+		"bin",
+		"etc/hostname",
+		"extra",
+	)
+}
+
+func TestCompressionReport(t *testing.T) {
+	// Stand in for a second codec using a different gzip level
+	CompressWriters[Zstd] = testGzipWriterLevel(t, gzip.BestSpeed)
+	t.Cleanup(func() { delete(CompressWriters, Zstd) })
+
+	var b Builder
+
+	var data = bytes.Repeat([]byte("initramfs "), 1000)
+	for _, name := range []string{"a", "b", "c"} {
+		if err := b.Add(Header{Mode: Mode_File | 0o644, Filename: name}, data); err != nil {
+			t.Fatalf("Add: %s", err)
+		}
+	}
+
+	sizes, err := CompressionReport(&b, []Lookahead{Gzip, Zstd})
+	if err != nil {
+		t.Fatalf("CompressionReport: %s", err)
+	}
+
+	if len(sizes) != 2 {
+		t.Fatalf("expected 2 sizes, got %v", sizes)
+	}
+
+	for la, n := range sizes {
+		if n <= 0 || n >= int64(3*len(data)) {
+			t.Errorf("%s: unexpected compressed size %d", la, n)
+		}
+	}
+
+	if _, err := CompressionReport(&b, []Lookahead{Lz4}); !errors.Is(err, ErrNoCompressWriter) {
+		t.Errorf("expected ErrNoCompressWriter, got %v", err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	for _, explicitTrailer := range []bool{false, true} {
+		raw, err := Build(func(iw *Writer) error {
+			if err := iw.WriteFile("init", 0o755, []byte("#!/bin/sh\n")); err != nil {
+				return err
+			}
+
+			if explicitTrailer {
+				return iw.WriteTrailer()
+			}
+			return nil
+		}, WithReproducible())
+		if err != nil {
+			t.Fatalf("Build: %s", err)
+		}
+
+		var hdrs headerList
+		hdrs.readAll(NewReader(bytes.NewReader(raw)))
+		hdrs.expectNames(t, ".", "init", TrailerFilename)
+	}
+
+	var errFn = errors.New("callback failed")
+	if _, err := Build(func(iw *Writer) error { return errFn }); err != errFn {
+		t.Errorf("expected the callback error, got %v", err)
+	}
+
+	if _, err := Build(func(iw *Writer) error { return nil }, WithDefaultAlignment(3)); !errors.Is(err, ErrBadAlignment) {
+		t.Errorf("expected ErrBadAlignment from an option, got %v", err)
+	}
+}
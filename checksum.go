@@ -0,0 +1,200 @@
+package initramfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Read an archive from src and write it to dst using the [Magic_070702]
+// format, with the Checksum field of every regular file computed using
+// [ComputeChecksum]. All other entries (directories, symlinks, devices, etc.)
+// are given a checksum of 0.
+//
+// Any compressed segments in src are decompressed using the global
+// [CompressReaders], and dst will receive a single uncompressed archive. The
+// data of each regular file is buffered in memory to compute its checksum
+// before the header is written.
+func AddChecksums(dst io.Writer, src io.Reader) error {
+	var (
+		r    = NewReader(src)
+		iw   = NewWriter(dst)
+		data bytes.Buffer
+	)
+
+	err := r.walk(func(hdr *Header) error {
+		data.Reset()
+		if hdr.DataSize > 0 {
+			if _, err := io.Copy(&data, r); err != nil {
+				return err
+			}
+		}
+
+		hdr.Magic = Magic_070702
+		hdr.Checksum = 0
+
+		if hdr.Mode.File() {
+			hdr.Checksum = ComputeChecksum(data.Bytes())
+		}
+
+		if err := iw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if data.Len() > 0 {
+			if _, err := iw.ReadFrom(&data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return iw.Flush()
+}
+
+var ErrChecksumNotSeekable = errors.New("initramfs: computing checksums requires an uncompressed io.WriteSeeker output")
+
+// Offset of the Checksum field within the text header.
+const checksumFieldOffset = 6 + 12*8
+
+// When enabled, the Checksum field of every regular file entry using
+// [Magic_070702] is computed (see [ComputeChecksum]) as its data is written,
+// rather than taken from the header. Once all of the data has been written,
+// the writer seeks back to update the field in the output, and so the
+// [io.Writer] given to [NewWriter] must also be an [io.WriteSeeker].
+//
+// [Writer.WriteHeader] will return [ErrChecksumNotSeekable] for such an entry
+// with data if the output is not seekable or compression is being applied.
+// Entries without data are given a checksum of 0.
+func (iw *Writer) SetAutoChecksum(enable bool) { iw.autoChecksum = enable }
+
+// Whether the checksum of this entry needs to be computed from its data.
+func (iw *Writer) wantChecksum(hdr *Header) bool {
+	return iw.autoChecksum && hdr.Magic == Magic_070702 && hdr.Mode.File()
+}
+
+// Record the position of the Checksum field of the header about to be written.
+func (iw *Writer) startChecksum(hdr *Header) error {
+	hdr.Checksum = 0
+
+	if hdr.DataSize == 0 {
+		return nil
+	}
+
+	pos, err := iw.w.(io.Seeker).Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	iw.sumPending = true
+	iw.sumOffset = pos + checksumFieldOffset
+	iw.sum.Reset()
+
+	return nil
+}
+
+// Update the Checksum field of the most recent header, if one is pending, and
+// return to the end of the output.
+func (iw *Writer) finishChecksum() error {
+	if !iw.sumPending {
+		return nil
+	}
+
+	iw.sumPending = false
+
+	var field [8]byte
+	for i := range field {
+		field[i] = nibble2hex(byte(iw.sum.Sum32() >> (28 - 4*i)))
+	}
+
+	ws := iw.w.(io.WriteSeeker)
+
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ws.Seek(iw.sumOffset, io.SeekStart); err != nil {
+		return err
+	}
+
+	if _, err := ws.Write(field[:]); err != nil {
+		return err
+	}
+
+	_, err = ws.Seek(end, io.SeekStart)
+	return err
+}
+
+// Accumulates the checksum of all data written to it (see [ComputeChecksum]),
+// as used for the Checksum field of [Magic_070702] headers. The zero value is
+// ready to use. It never returns an error, and so may be combined with other
+// writers using [io.MultiWriter] or [io.TeeReader].
+//
+// As a [hash.Hash32], the sum is the running value, and Sum appends it in
+// big-endian byte order.
+type ChecksumWriter struct {
+	sum uint32
+}
+
+var _ hash.Hash32 = (*ChecksumWriter)(nil)
+
+func (cw *ChecksumWriter) Write(p []byte) (int, error) {
+	cw.sum += ComputeChecksum(p)
+	return len(p), nil
+}
+
+// Returns the checksum of all data written so far.
+func (cw *ChecksumWriter) Sum32() uint32 { return cw.sum }
+
+func (cw *ChecksumWriter) Sum(b []byte) []byte { return binary.BigEndian.AppendUint32(b, cw.sum) }
+func (cw *ChecksumWriter) Reset()              { cw.sum = 0 }
+func (cw *ChecksumWriter) Size() int           { return 4 }
+func (cw *ChecksumWriter) BlockSize() int      { return 1 }
+
+// Sums the bytes written through it.
+type sumWriter struct {
+	w   io.Writer
+	sum *ChecksumWriter
+}
+
+func (sw sumWriter) Write(p []byte) (int, error) {
+	n, err := sw.w.Write(p)
+	sw.sum.Write(p[:n])
+	return n, err
+}
+
+// The checksum of a file's data did not match its header.
+type ChecksumError struct {
+	Filename string
+	Want     uint32 // From the header
+	Got      uint32 // Computed from the data
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("initramfs: checksum mismatch for %s: header has %08x, data sums to %08x", e.Filename, e.Want, e.Got)
+}
+
+// When enabled, the data of every regular file entry using [Magic_070702] is
+// checked against its Checksum field (see [ComputeChecksum]) as it is consumed
+// through [Reader.Read] or [Reader.WriteTo], or skipped by moving on to the
+// next entry. A mismatch is reported with a [*ChecksumError] once the last of
+// the file's data has been read, or from [Reader.Next] if it was skipped.
+func (r *Reader) SetVerifyChecksum(verify bool) { r.verifyChecksum = verify }
+
+func (r *Reader) checkSum() error {
+	r.sumActive = false
+
+	if sum := r.sum.Sum32(); sum != r.cur.Checksum {
+		return &ChecksumError{Filename: r.cur.Filename, Want: r.cur.Checksum, Got: sum}
+	}
+
+	return nil
+}
@@ -0,0 +1,258 @@
+package initramfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+func TestAddChecksums(t *testing.T) {
+	const (
+		content = "Hello World!\n"
+		target  = "hello.txt"
+	)
+
+	var src bytes.Buffer
+
+	w := NewWriter(&src)
+	testMkdirHeader(t, w, "dir", nil)
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, DataSize: uint32(len(content)), Filename: "dir/hello.txt"})
+	w.Write([]byte(content))
+	testWriteHeader(t, w, &Header{Mode: Mode_Symlink | 0o777, DataSize: uint32(len(target)), Filename: "dir/link"})
+	w.Write([]byte(target))
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Filename: "dir/empty"})
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var dst bytes.Buffer
+	if err := AddChecksums(&dst, &src); err != nil {
+		t.Fatalf("AddChecksums: %s", err)
+	}
+
+	var (
+		r    = NewReader(&dst)
+		hdrs headerList
+	)
+
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next: %s", err)
+		}
+
+		hdrs = append(hdrs, *hdr)
+
+		if hdr.Magic != Magic_070702 {
+			t.Errorf("%s: expected magic %s, got %s", hdr.Filename, Magic_070702, hdr.Magic)
+		}
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll: %s", err)
+		}
+
+		var expect uint32
+		if hdr.Mode.File() {
+			expect = ComputeChecksum(data)
+		}
+
+		if hdr.Checksum != expect {
+			t.Errorf("%s: expected checksum %d, got %d", hdr.Filename, expect, hdr.Checksum)
+		}
+
+		if hdr.Filename == "dir/hello.txt" && hdr.Checksum == 0 {
+			t.Errorf("%s: expected non-zero checksum", hdr.Filename)
+		}
+	}
+
+	hdrs.expectNames(t, ".", "dir", "dir/hello.txt", "dir/link", "dir/empty", TrailerFilename)
+}
+
+func TestWriter_SetAutoChecksum(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "initramfs.cpio"))
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	defer f.Close()
+
+	var files = map[string]string{
+		"hello.txt": "Hello World!\n",
+		"bye.txt":   "Goodbye\n",
+	}
+
+	w := NewWriter(f)
+	w.SetAutoChecksum(true)
+	if err := w.SetDefaultMagic(Magic_070702); err != nil {
+		t.Fatalf("SetDefaultMagic: %s", err)
+	}
+
+	for _, name := range []string{"hello.txt", "bye.txt"} {
+		if err := w.WriteFile(name, 0o644, []byte(files[name])); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+	}
+
+	if err := w.WriteFileReader("empty", 0o644, 0, nil); err != nil {
+		t.Fatalf("WriteFileReader: %s", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	raw, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+
+	var n int
+	for _, hdr := range NewReader(bytes.NewReader(raw)).All() {
+		if !hdr.Mode.File() {
+			continue
+		}
+
+		n++
+
+		if expect := ComputeChecksum([]byte(files[hdr.Filename])); hdr.Checksum != expect {
+			t.Errorf("%s: expected checksum %#x, got %#x", hdr.Filename, expect, hdr.Checksum)
+		}
+	}
+
+	if n != 3 {
+		t.Errorf("expected 3 files, got %d", n)
+	}
+}
+
+func TestWriter_SetAutoChecksumNotSeekable(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	w.SetAutoChecksum(true)
+
+	var hdr = Header{Magic: Magic_070702, Mode: Mode_File | 0o644, DataSize: 1, Filename: "a"}
+	if err := w.WriteHeader(&hdr); !errors.Is(err, ErrChecksumNotSeekable) {
+		t.Fatalf("expected ErrChecksumNotSeekable, got %v", err)
+	}
+
+	// Checksums are not needed without data, or for other magic values
+	testWriteHeader(t, w, &Header{Magic: Magic_070702, Mode: Mode_File | 0o644, Filename: "b"})
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, DataSize: 1, Filename: "c"})
+}
+
+func TestReader_SetVerifyChecksum(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	testWriteHeader(t, w, &Header{Magic: Magic_070702, Mode: Mode_File | 0o644, DataSize: 5, Checksum: ComputeChecksum([]byte("hello")), Filename: "good"})
+	w.Write([]byte("hello"))
+	testWriteHeader(t, w, &Header{Magic: Magic_070702, Mode: Mode_File | 0o644, DataSize: 5, Checksum: 1, Filename: "bad"})
+	w.Write([]byte("hello"))
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var raw = buf.Bytes()
+
+	var expectMismatch = func(t *testing.T, err error) {
+		t.Helper()
+
+		var cerr *ChecksumError
+		if !errors.As(err, &cerr) {
+			t.Fatalf("expected ChecksumError, got %v", err)
+		}
+
+		if cerr.Filename != "bad" || cerr.Want != 1 || cerr.Got != ComputeChecksum([]byte("hello")) {
+			t.Errorf("unexpected %+v", cerr)
+		}
+	}
+
+	t.Run("Read", func(t *testing.T) {
+		r := NewReader(bytes.NewReader(raw))
+		r.SetVerifyChecksum(true)
+
+		testNextNamed(t, r, ".")
+		testNextNamed(t, r, "good")
+		if _, err := io.ReadAll(r); err != nil {
+			t.Fatalf("ReadAll good: %s", err)
+		}
+
+		testNextNamed(t, r, "bad")
+		_, err := io.ReadAll(r)
+		expectMismatch(t, err)
+	})
+
+	t.Run("WriteTo", func(t *testing.T) {
+		r := NewReader(bytes.NewReader(raw))
+		r.SetVerifyChecksum(true)
+
+		testNextNamed(t, r, ".")
+		testNextNamed(t, r, "good")
+		testNextNamed(t, r, "bad")
+
+		_, err := r.WriteTo(io.Discard)
+		expectMismatch(t, err)
+	})
+
+	t.Run("All", func(t *testing.T) {
+		r := NewReader(bytes.NewReader(raw))
+		r.SetVerifyChecksum(true)
+
+		// Skipping the bad data stops the iteration before the trailer
+		var hdrs headerList
+		hdrs.readAll(r)
+		hdrs.expectNames(t, ".", "good", "bad")
+	})
+
+	t.Run("Next", func(t *testing.T) {
+		r := NewReader(bytes.NewReader(raw))
+		r.SetVerifyChecksum(true)
+
+		testNextNamed(t, r, ".")
+		testNextNamed(t, r, "good")
+		testNextNamed(t, r, "bad")
+
+		_, err := r.Next()
+		expectMismatch(t, err)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		r := NewReader(bytes.NewReader(raw))
+
+		var hdrs headerList
+		hdrs.readAll(r)
+		hdrs.expectNames(t, ".", "good", "bad", TrailerFilename)
+	})
+}
+
+func TestChecksumWriter(t *testing.T) {
+	var (
+		data = []byte("Hello World!\n")
+		cw   ChecksumWriter
+	)
+
+	if _, err := io.Copy(&cw, iotest.HalfReader(bytes.NewReader(data))); err != nil {
+		t.Fatalf("Copy: %s", err)
+	}
+
+	var expect = ComputeChecksum(data)
+	if got := cw.Sum32(); got != expect {
+		t.Errorf("expected %08x, got %08x", expect, got)
+	}
+
+	if got := cw.Sum([]byte{0xff}); !bytes.Equal(got, binary.BigEndian.AppendUint32([]byte{0xff}, expect)) {
+		t.Errorf("unexpected Sum %x", got)
+	}
+
+	cw.Reset()
+	if got := cw.Sum32(); got != 0 {
+		t.Errorf("expected 0 after Reset, got %08x", got)
+	}
+}
@@ -3,6 +3,7 @@ package initramfs
 import (
 	"compress/bzip2"
 	"compress/gzip"
+	"errors"
 	"io"
 )
 
@@ -15,9 +16,35 @@ import (
 // [XZ compression options]: https://www.kernel.org/doc/html/latest/staging/xz.html#notes-on-compression-options
 type CompressWriter func(output io.Writer) (io.Writer, error)
 
+// Use the [Lookahead] token to select a suitable [CompressWriter].
+type CompressWriterMap map[Lookahead]CompressWriter
+
+// A global map of known compression writers.
+//
+// The default only includes compressors that exist within the standard library.
+// See [go.pdmccormick.com/initramfs/compressors] for implementations of others.
+var CompressWriters = CompressWriterMap{
+	Gzip: GzipWriter,
+}
+
 // A [CompressWriter] using [compress/gzip.NewWriter].
 func GzipWriter(w io.Writer) (io.Writer, error) { return gzip.NewWriter(w), nil }
 
+var ErrBadCompressionLevel = errors.New("initramfs: invalid compression level")
+
+// Returns a [CompressWriter] using [compress/gzip.NewWriterLevel].
+//
+// Returns [ErrBadCompressionLevel] if the level is not within the range of
+// [compress/gzip.BestSpeed] to [compress/gzip.BestCompression], so that an
+// invalid level is caught before any output is written.
+func GzipWriterLevel(level int) (CompressWriter, error) {
+	if level < gzip.BestSpeed || level > gzip.BestCompression {
+		return nil, ErrBadCompressionLevel
+	}
+
+	return func(w io.Writer) (io.Writer, error) { return gzip.NewWriterLevel(w, level) }, nil
+}
+
 // A [CompressReader] will decompress the given input.
 type CompressReader func(input io.Reader) (io.Reader, error)
 
@@ -27,15 +54,24 @@ type CompressReaderMap map[Lookahead]CompressReader
 // A global map of known compression readers.
 //
 // The default only includes compressors that exist within the standard library.
-// See [go.pdmccormick.com/initramfs/examples] for sample implementations of
-// existing packages.
+// See [go.pdmccormick.com/initramfs/compressors] for implementations of others.
 var CompressReaders = CompressReaderMap{
 	Gzip:  GzipReader,
 	Bzip2: Bzip2Reader,
 }
 
-// A [CompressReader] using [compress/gzip.NewReader].
-func GzipReader(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }
+// A [CompressReader] using [compress/gzip.NewReader]. Only a single gzip
+// stream is read (see [compress/gzip.Reader.Multistream]), such that any
+// padding or further segments that follow are left unread.
+func GzipReader(r io.Reader) (io.Reader, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	zr.Multistream(false)
+	return zr, nil
+}
 
 // A [CompressReader] using [compress/bzip2.NewReader].
 func Bzip2Reader(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil }
@@ -0,0 +1,67 @@
+// Compression readers and writers for formats that are not provided by the
+// standard library, for use with [go.pdmccormick.com/initramfs].
+//
+// This is a separate module so that the core package remains free of
+// dependencies. The LZ4 and LZO implementations are self-contained, covering
+// only the legacy LZ4 frame and lzop file formats that the kernel accepts. Call [RegisterAll] to add every implementation to the global
+// [go.pdmccormick.com/initramfs.CompressReaders] and
+// [go.pdmccormick.com/initramfs.CompressWriters] maps.
+package compressors
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+
+	"go.pdmccormick.com/initramfs"
+)
+
+// The LZMA2 dictionary size used by [XzWriter], as recommended for the kernel.
+// See [XZ compression options].
+//
+// [XZ compression options]: https://www.kernel.org/doc/html/latest/staging/xz.html#notes-on-compression-options
+const XzDictCap = 1 << 20
+
+// An Xz [go.pdmccormick.com/initramfs.CompressReader] using the [github.com/ulikunitz/xz] package.
+func XzReader(r io.Reader) (io.Reader, error) { return xz.NewReader(r) }
+
+// An Xz [go.pdmccormick.com/initramfs.CompressWriter] using the
+// [github.com/ulikunitz/xz] package, configured for compatibility with the
+// kernel decompressor: a CRC32 integrity check (the kernel does not support
+// CRC64 or SHA-256), the LZMA2 filter alone and a dictionary of [XzDictCap].
+func XzWriter(w io.Writer) (io.Writer, error) {
+	var cfg = xz.WriterConfig{
+		DictCap:  XzDictCap,
+		CheckSum: xz.CRC32,
+	}
+
+	return cfg.NewWriter(w)
+}
+
+// A Zstd [go.pdmccormick.com/initramfs.CompressReader] using the [github.com/klauspost/compress/zstd] package.
+func ZstdReader(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) }
+
+// A Zstd [go.pdmccormick.com/initramfs.CompressWriter] using the [github.com/klauspost/compress/zstd] package.
+func ZstdWriter(w io.Writer) (io.Writer, error) { return zstd.NewWriter(w) }
+
+// Adds [XzReader], [ZstdReader], [Lz4Reader] and [LzoReader] to the global
+// [go.pdmccormick.com/initramfs.CompressReaders] map, and [XzWriter],
+// [ZstdWriter], [Lz4Writer] and [LzoWriter] to the global
+// [go.pdmccormick.com/initramfs.CompressWriters] map.
+func RegisterAll() {
+	var (
+		crs = initramfs.CompressReaders
+		cws = initramfs.CompressWriters
+	)
+
+	crs[initramfs.Xz] = XzReader
+	crs[initramfs.Zstd] = ZstdReader
+	crs[initramfs.Lz4] = Lz4Reader
+	crs[initramfs.Lzo] = LzoReader
+
+	cws[initramfs.Xz] = XzWriter
+	cws[initramfs.Zstd] = ZstdWriter
+	cws[initramfs.Lz4] = Lz4Writer
+	cws[initramfs.Lzo] = LzoWriter
+}
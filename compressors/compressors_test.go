@@ -0,0 +1,62 @@
+package compressors
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"go.pdmccormick.com/initramfs"
+)
+
+func TestRegisterAll(t *testing.T) {
+	RegisterAll()
+
+	for _, la := range []initramfs.Lookahead{initramfs.Xz, initramfs.Zstd, initramfs.Lz4, initramfs.Lzo} {
+		t.Run(la.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			w := initramfs.NewWriter(&buf)
+			if err := w.StartCompressionType(la); err != nil {
+				t.Fatalf("StartCompressionType: %s", err)
+			}
+			if err := w.WriteFile("hello.txt", 0o644, []byte("Hello, world!")); err != nil {
+				t.Fatalf("WriteFile: %s", err)
+			}
+			if err := w.WriteTrailer(); err != nil {
+				t.Fatalf("WriteTrailer: %s", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %s", err)
+			}
+
+			r := initramfs.NewReader(&buf)
+			if _, err := r.Next(); err != initramfs.ErrCompressedContentAhead {
+				t.Fatalf("expected ErrCompressedContentAhead, got %v", err)
+			}
+
+			if compressed, typ, err := r.ContinueCompressed(nil); err != nil {
+				t.Fatalf("ContinueCompressed: %s", err)
+			} else if !compressed || typ != la {
+				t.Fatalf("expected %s compression, got %v %s", la, compressed, typ)
+			}
+
+			for {
+				hdr, err := r.Next()
+				if err != nil {
+					t.Fatalf("Next: %s", err)
+				}
+
+				if hdr.Filename == "hello.txt" {
+					data, err := io.ReadAll(r)
+					if err != nil {
+						t.Fatalf("ReadAll: %s", err)
+					}
+					if string(data) != "Hello, world!" {
+						t.Errorf("unexpected data %q", data)
+					}
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package compressors
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// The largest amount of data in each block of the LZ4 legacy frame format, as
+// also assumed by the kernel decompressor.
+const Lz4BlockSize = 8 << 20
+
+const lz4LegacyMagic = 0x184C2102
+
+var ErrCorruptLz4 = errors.New("compressors: corrupt LZ4 data")
+
+// An LZ4 [go.pdmccormick.com/initramfs.CompressReader] for the legacy frame
+// format, which is the only one the kernel accepts. Further legacy frames that
+// directly follow are read as well. As the format has no end marker, r is read
+// until its end, so nothing else may follow the compressed data.
+func Lz4Reader(r io.Reader) (io.Reader, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, err
+	}
+
+	if binary.LittleEndian.Uint32(magic[:]) != lz4LegacyMagic {
+		return nil, ErrCorruptLz4
+	}
+
+	return &lz4Reader{r: r}, nil
+}
+
+type lz4Reader struct {
+	r   io.Reader
+	src []byte
+	dst []byte
+	buf []byte // Unread part of dst
+	err error
+}
+
+func (lr *lz4Reader) Read(p []byte) (int, error) {
+	for len(lr.buf) == 0 {
+		if lr.err != nil {
+			return 0, lr.err
+		}
+		lr.err = lr.readBlock()
+	}
+
+	n := copy(p, lr.buf)
+	lr.buf = lr.buf[n:]
+	return n, nil
+}
+
+func (lr *lz4Reader) readBlock() error {
+	var size [4]byte
+	if _, err := io.ReadFull(lr.r, size[:]); err == io.EOF {
+		return io.EOF
+	} else if err != nil {
+		return err
+	}
+
+	var n = binary.LittleEndian.Uint32(size[:])
+
+	switch {
+	case n == lz4LegacyMagic:
+		// The start of another frame
+		return nil
+	case n == 0:
+		return io.EOF
+	case n > lz4CompressBound(Lz4BlockSize):
+		return ErrCorruptLz4
+	}
+
+	if cap(lr.src) < int(n) {
+		lr.src = make([]byte, n)
+	}
+	lr.src = lr.src[:n]
+
+	if _, err := io.ReadFull(lr.r, lr.src); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	if lr.dst == nil {
+		lr.dst = make([]byte, Lz4BlockSize)
+	}
+
+	k, err := lz4DecodeBlock(lr.dst, lr.src)
+	if err != nil {
+		return err
+	}
+
+	lr.buf = lr.dst[:k]
+	return nil
+}
+
+// An LZ4 [go.pdmccormick.com/initramfs.CompressWriter] producing the legacy
+// frame format, with blocks of up to [Lz4BlockSize]. The writer must be closed
+// to write the final block.
+func Lz4Writer(w io.Writer) (io.Writer, error) {
+	return &lz4Writer{w: w}, nil
+}
+
+type lz4Writer struct {
+	w       io.Writer
+	buf     []byte
+	out     []byte
+	table   []int32
+	started bool
+	err     error
+}
+
+func (lw *lz4Writer) Write(p []byte) (n int, err error) {
+	if lw.err != nil {
+		return 0, lw.err
+	}
+
+	for len(p) > 0 {
+		if lw.buf == nil {
+			lw.buf = make([]byte, 0, Lz4BlockSize)
+		}
+
+		k := min(len(p), Lz4BlockSize-len(lw.buf))
+		lw.buf = append(lw.buf, p[:k]...)
+		p = p[k:]
+		n += k
+
+		if len(lw.buf) == Lz4BlockSize {
+			if err := lw.writeBlock(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Write the final block. The underlying writer is not closed.
+func (lw *lz4Writer) Close() error {
+	if lw.err != nil {
+		return lw.err
+	}
+
+	if err := lw.writeBlock(); err != nil {
+		return err
+	}
+
+	lw.err = os.ErrClosed
+	return nil
+}
+
+func (lw *lz4Writer) writeBlock() error {
+	lw.out = lw.out[:0]
+
+	if !lw.started {
+		lw.out = binary.LittleEndian.AppendUint32(lw.out, lz4LegacyMagic)
+		lw.started = true
+	}
+
+	if len(lw.buf) > 0 {
+		if lw.table == nil {
+			lw.table = make([]int32, 1<<lz4HashBits)
+		}
+
+		lw.out = binary.LittleEndian.AppendUint32(lw.out, 0)
+		var start = len(lw.out)
+
+		lw.out = lz4EncodeBlock(lw.out, lw.buf, lw.table)
+		binary.LittleEndian.PutUint32(lw.out[start-4:], uint32(len(lw.out)-start))
+	}
+
+	lw.buf = lw.buf[:0]
+
+	if _, err := lw.w.Write(lw.out); err != nil {
+		lw.err = err
+		return err
+	}
+
+	return nil
+}
+
+// The largest compressed size of an LZ4 block of n bytes.
+func lz4CompressBound(n uint32) uint32 { return n + n/255 + 16 }
+
+// Decode an LZ4 block from src into dst, returning the number of bytes written.
+func lz4DecodeBlock(dst, src []byte) (int, error) {
+	var i, o int
+
+	var length = func(n int) (int, error) {
+		for {
+			if i >= len(src) {
+				return 0, ErrCorruptLz4
+			}
+
+			b := src[i]
+			i++
+			n += int(b)
+
+			if b != 255 {
+				return n, nil
+			}
+		}
+	}
+
+	for {
+		if i >= len(src) {
+			return 0, ErrCorruptLz4
+		}
+
+		token := src[i]
+		i++
+
+		lit := int(token >> 4)
+		if lit == 15 {
+			var err error
+			if lit, err = length(lit); err != nil {
+				return 0, err
+			}
+		}
+
+		if lit > len(src)-i || lit > len(dst)-o {
+			return 0, ErrCorruptLz4
+		}
+
+		o += copy(dst[o:], src[i:i+lit])
+		i += lit
+
+		// The last sequence consists of literals only
+		if i == len(src) {
+			return o, nil
+		}
+
+		if len(src)-i < 2 {
+			return 0, ErrCorruptLz4
+		}
+
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+
+		if offset == 0 || offset > o {
+			return 0, ErrCorruptLz4
+		}
+
+		match := int(token&15) + lz4MinMatch
+		if token&15 == 15 {
+			var err error
+			if match, err = length(match); err != nil {
+				return 0, err
+			}
+		}
+
+		if match > len(dst)-o {
+			return 0, ErrCorruptLz4
+		}
+
+		// The match may overlap the data being written
+		for k := range match {
+			dst[o+k] = dst[o-offset+k]
+		}
+		o += match
+	}
+}
+
+const (
+	lz4MinMatch     = 4
+	lz4LastLiterals = 5  // The last bytes of a block are always literals
+	lz4MatchLimit   = 12 // The last match must start at least this far from the end
+	lz4MaxOffset    = 65535
+	lz4HashBits     = 16
+)
+
+// Append src encoded as an LZ4 block to dst, using a greedy match search.
+// The table is used to find matches, and is cleared first.
+func lz4EncodeBlock(dst, src []byte, table []int32) []byte {
+	clear(table)
+
+	var (
+		anchor int
+		limit  = len(src) - lz4MatchLimit
+	)
+
+	for i := 0; i < limit; {
+		var (
+			seq  = binary.LittleEndian.Uint32(src[i:])
+			h    = (seq * 2654435761) >> (32 - lz4HashBits)
+			cand = int(table[h]) - 1
+		)
+
+		table[h] = int32(i + 1)
+
+		if cand < 0 || i-cand > lz4MaxOffset || binary.LittleEndian.Uint32(src[cand:]) != seq {
+			i++
+			continue
+		}
+
+		var (
+			n   = lz4MinMatch
+			end = len(src) - lz4LastLiterals
+		)
+		for i+n < end && src[cand+n] == src[i+n] {
+			n++
+		}
+
+		dst = lz4AppendSequence(dst, src[anchor:i], i-cand, n)
+
+		i += n
+		anchor = i
+	}
+
+	return lz4AppendSequence(dst, src[anchor:], 0, 0)
+}
+
+// Append a sequence of literals followed by a match, or just literals if the
+// match length is 0.
+func lz4AppendSequence(dst, lits []byte, offset, match int) []byte {
+	var appendLength = func(dst []byte, n int) []byte {
+		for ; n >= 255; n -= 255 {
+			dst = append(dst, 255)
+		}
+		return append(dst, byte(n))
+	}
+
+	var token = byte(min(len(lits), 15)) << 4
+	if match > 0 {
+		token |= byte(min(match-lz4MinMatch, 15))
+	}
+
+	dst = append(dst, token)
+
+	if len(lits) >= 15 {
+		dst = appendLength(dst, len(lits)-15)
+	}
+	dst = append(dst, lits...)
+
+	if match > 0 {
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(offset))
+
+		if match-lz4MinMatch >= 15 {
+			dst = appendLength(dst, match-lz4MinMatch-15)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,140 @@
+package compressors
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// Test inputs exercising literal runs, long matches and incompressible data
+func testCodecInputs() map[string][]byte {
+	var (
+		rng   = rand.New(rand.NewSource(1))
+		noise = make([]byte, 100<<10)
+		mixed []byte
+	)
+	rng.Read(noise)
+
+	for len(mixed) < 1<<20 {
+		switch rng.Intn(3) {
+		case 0:
+			mixed = append(mixed, noise[:rng.Intn(300)]...)
+		case 1:
+			mixed = append(mixed, bytes.Repeat([]byte{byte(rng.Intn(256))}, rng.Intn(1000))...)
+		default:
+			// Repeat earlier data at a range of distances
+			if len(mixed) > 0 {
+				start := rng.Intn(len(mixed))
+				mixed = append(mixed, mixed[start:min(len(mixed), start+rng.Intn(100))]...)
+			}
+		}
+	}
+
+	return map[string][]byte{
+		"tiny":   []byte("abc"),
+		"short":  []byte("Hello, world!"),
+		"text":   bytes.Repeat([]byte("initramfs "), 1000),
+		"noise":  noise,
+		"mixed":  mixed,
+		"zeroes": make([]byte, 300<<10),
+	}
+}
+
+// If terminated, the format has an end marker, and anything following it must
+// be left unread.
+func testRoundTrip(t *testing.T, newWriter func(io.Writer) (io.Writer, error), newReader func(io.Reader) (io.Reader, error), terminated bool) {
+	for name, data := range testCodecInputs() {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			w, err := newWriter(&buf)
+			if err != nil {
+				t.Fatalf("writer: %s", err)
+			}
+			if _, err := w.Write(data); err != nil {
+				t.Fatalf("Write: %s", err)
+			}
+			if err := w.(io.Closer).Close(); err != nil {
+				t.Fatalf("Close: %s", err)
+			}
+
+			if terminated {
+				buf.WriteString("after")
+			}
+
+			r, err := newReader(&buf)
+			if err != nil {
+				t.Fatalf("reader: %s", err)
+			}
+
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll: %s", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("round trip mismatch: expected %d bytes, got %d", len(data), len(got))
+			}
+
+			if rest := buf.String(); terminated && rest != "after" {
+				t.Errorf("expected trailing data to remain, got %q", rest)
+			}
+		})
+	}
+}
+
+// Check that corrupt input results in an error rather than a panic.
+func testCorrupt(t *testing.T, newWriter func(io.Writer) (io.Writer, error), newReader func(io.Reader) (io.Reader, error)) {
+	var buf bytes.Buffer
+
+	w, _ := newWriter(&buf)
+	w.Write(testCodecInputs()["mixed"][:4096])
+	w.(io.Closer).Close()
+
+	var (
+		valid = buf.Bytes()
+		rng   = rand.New(rand.NewSource(2))
+	)
+
+	for range 1000 {
+		var data = bytes.Clone(valid[:rng.Intn(len(valid))])
+		if len(data) > 0 {
+			data[rng.Intn(len(data))] ^= byte(1 + rng.Intn(255))
+		}
+
+		if r, err := newReader(bytes.NewReader(data)); err == nil {
+			io.Copy(io.Discard, r)
+		}
+	}
+}
+
+func TestLz4Reader(t *testing.T) {
+	expect, err := os.ReadFile("../testdata/data.cpio")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open("../testdata/data.cpio.lz4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := Lz4Reader(f)
+	if err != nil {
+		t.Fatalf("Lz4Reader: %s", err)
+	}
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+	if !bytes.Equal(got, expect) {
+		t.Errorf("expected %d bytes of data.cpio, got %d", len(expect), len(got))
+	}
+}
+
+func TestLz4RoundTrip(t *testing.T) { testRoundTrip(t, Lz4Writer, Lz4Reader, false) }
+
+func TestLz4Corrupt(t *testing.T) { testCorrupt(t, Lz4Writer, Lz4Reader) }
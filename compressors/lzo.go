@@ -0,0 +1,667 @@
+package compressors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// The amount of data in each block written by [LzoWriter], being the largest
+// that the kernel decompressor accepts.
+const LzoBlockSize = 256 << 10
+
+// The largest block accepted by [LzoReader], as for the lzop tool.
+const lzoMaxBlockSize = 64 << 20
+
+var (
+	ErrCorruptLzo     = errors.New("compressors: corrupt LZO data")
+	ErrUnsupportedLzo = errors.New("compressors: unsupported lzop file options")
+)
+
+var lzoMagic = []byte{0x89, 'L', 'Z', 'O', 0x00, '\r', '\n', 0x1a, '\n'}
+
+// Flags of the lzop file header
+const (
+	lzoFlagAdler32D   = 0x0001
+	lzoFlagAdler32C   = 0x0002
+	lzoFlagExtraField = 0x0040
+	lzoFlagCrc32D     = 0x0100
+	lzoFlagCrc32C     = 0x0200
+	lzoFlagMultipart  = 0x0400
+	lzoFlagFilter     = 0x0800
+	lzoFlagHeaderCrc  = 0x1000
+	lzoFlagOSUnix     = 0x03000000
+)
+
+// An LZO [go.pdmccormick.com/initramfs.CompressReader] for the lzop file
+// format, as produced by the lzop tool and accepted by the kernel. Block and
+// header checksums are verified. Only the compressed data is consumed from r.
+func LzoReader(r io.Reader) (io.Reader, error) {
+	var lr = lzoReader{r: r}
+
+	if err := lr.readHeader(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return &lr, nil
+}
+
+type lzoReader struct {
+	r     io.Reader
+	flags uint32
+	src   []byte
+	dst   []byte
+	buf   []byte // Unread part of dst
+	err   error
+}
+
+func (lr *lzoReader) readHeader() error {
+	var magic [9]byte
+	if _, err := io.ReadFull(lr.r, magic[:]); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(magic[:], lzoMagic) {
+		return ErrCorruptLzo
+	}
+
+	// The header checksum covers everything following the magic, and is
+	// computed once the flags (which select the algorithm) are known
+	var hdr bytes.Buffer
+	var read = func(n int) ([]byte, error) {
+		var p = make([]byte, n)
+		if _, err := io.ReadFull(lr.r, p); err != nil {
+			return nil, err
+		}
+		hdr.Write(p)
+		return p, nil
+	}
+
+	p, err := read(7) // Version, library version, version needed and method
+	if err != nil {
+		return err
+	}
+
+	var version = binary.BigEndian.Uint16(p)
+	if version < 0x0940 {
+		return ErrUnsupportedLzo
+	}
+
+	if p, err = read(1 + 4); err != nil { // Level and flags
+		return err
+	}
+
+	lr.flags = binary.BigEndian.Uint32(p[1:])
+	if lr.flags&(lzoFlagFilter|lzoFlagMultipart) != 0 {
+		return ErrUnsupportedLzo
+	}
+
+	if p, err = read(4 + 8 + 1); err != nil { // Mode, mtime and name length
+		return err
+	}
+
+	if _, err = read(int(p[12])); err != nil {
+		return err
+	}
+
+	var sum = lr.headerHash()
+	sum.Write(hdr.Bytes())
+
+	if p, err = read(4); err != nil {
+		return err
+	} else if binary.BigEndian.Uint32(p) != sum.Sum32() {
+		return ErrCorruptLzo
+	}
+
+	if lr.flags&lzoFlagExtraField != 0 {
+		hdr.Reset()
+
+		if p, err = read(4); err != nil {
+			return err
+		}
+		if _, err = read(int(binary.BigEndian.Uint32(p))); err != nil {
+			return err
+		}
+
+		var sum = lr.headerHash()
+		sum.Write(hdr.Bytes())
+
+		if p, err = read(4); err != nil {
+			return err
+		} else if binary.BigEndian.Uint32(p) != sum.Sum32() {
+			return ErrCorruptLzo
+		}
+	}
+
+	return nil
+}
+
+func (lr *lzoReader) headerHash() hash.Hash32 {
+	if lr.flags&lzoFlagHeaderCrc != 0 {
+		return crc32.NewIEEE()
+	}
+	return adler32.New()
+}
+
+func (lr *lzoReader) Read(p []byte) (int, error) {
+	for len(lr.buf) == 0 {
+		if lr.err != nil {
+			return 0, lr.err
+		}
+		lr.err = lr.readBlock()
+	}
+
+	n := copy(p, lr.buf)
+	lr.buf = lr.buf[n:]
+	return n, nil
+}
+
+func (lr *lzoReader) readBlock() error {
+	var sizes [8]byte
+
+	if _, err := io.ReadFull(lr.r, sizes[:4]); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	var dstLen = binary.BigEndian.Uint32(sizes[:4])
+	if dstLen == 0 {
+		return io.EOF
+	} else if dstLen > lzoMaxBlockSize {
+		return ErrCorruptLzo
+	}
+
+	if _, err := io.ReadFull(lr.r, sizes[4:]); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	var srcLen = binary.BigEndian.Uint32(sizes[4:])
+	if srcLen == 0 || srcLen > dstLen {
+		return ErrCorruptLzo
+	}
+
+	// Checksums of the uncompressed and (if actually compressed) the
+	// compressed data, in that order
+	var checks []hash.Hash32
+	if lr.flags&lzoFlagAdler32D != 0 {
+		checks = append(checks, adler32.New())
+	}
+	if lr.flags&lzoFlagCrc32D != 0 {
+		checks = append(checks, crc32.NewIEEE())
+	}
+
+	var nD = len(checks)
+
+	if srcLen < dstLen {
+		if lr.flags&lzoFlagAdler32C != 0 {
+			checks = append(checks, adler32.New())
+		}
+		if lr.flags&lzoFlagCrc32C != 0 {
+			checks = append(checks, crc32.NewIEEE())
+		}
+	}
+
+	var sums = make([]byte, 4*len(checks))
+	if _, err := io.ReadFull(lr.r, sums); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	if cap(lr.src) < int(srcLen) {
+		lr.src = make([]byte, srcLen)
+	}
+	lr.src = lr.src[:srcLen]
+
+	if _, err := io.ReadFull(lr.r, lr.src); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	for _, h := range checks[nD:] {
+		h.Write(lr.src)
+	}
+
+	if srcLen == dstLen {
+		// Stored without compression
+		lr.buf = lr.src
+	} else {
+		if cap(lr.dst) < int(dstLen) {
+			lr.dst = make([]byte, dstLen)
+		}
+		lr.dst = lr.dst[:dstLen]
+
+		if n, err := lzo1xDecode(lr.dst, lr.src); err != nil {
+			return err
+		} else if n != int(dstLen) {
+			return ErrCorruptLzo
+		}
+
+		lr.buf = lr.dst
+	}
+
+	for _, h := range checks[:nD] {
+		h.Write(lr.buf)
+	}
+
+	for i, h := range checks {
+		if binary.BigEndian.Uint32(sums[4*i:]) != h.Sum32() {
+			return ErrCorruptLzo
+		}
+	}
+
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// An LZO [go.pdmccormick.com/initramfs.CompressWriter] producing the lzop file
+// format in blocks of [LzoBlockSize], each with an Adler-32 checksum of its
+// uncompressed data, as the kernel expects. The writer must be closed to write
+// the final block and end marker.
+func LzoWriter(w io.Writer) (io.Writer, error) {
+	return &lzoWriter{w: w}, nil
+}
+
+type lzoWriter struct {
+	w       io.Writer
+	buf     []byte
+	out     []byte
+	table   []int32
+	started bool
+	err     error
+}
+
+func (lw *lzoWriter) Write(p []byte) (n int, err error) {
+	if lw.err != nil {
+		return 0, lw.err
+	}
+
+	for len(p) > 0 {
+		if lw.buf == nil {
+			lw.buf = make([]byte, 0, LzoBlockSize)
+		}
+
+		k := min(len(p), LzoBlockSize-len(lw.buf))
+		lw.buf = append(lw.buf, p[:k]...)
+		p = p[k:]
+		n += k
+
+		if len(lw.buf) == LzoBlockSize {
+			if err := lw.writeBlock(false); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Write the final block and end marker. The underlying writer is not closed.
+func (lw *lzoWriter) Close() error {
+	if lw.err != nil {
+		return lw.err
+	}
+
+	if err := lw.writeBlock(true); err != nil {
+		return err
+	}
+
+	lw.err = os.ErrClosed
+	return nil
+}
+
+func (lw *lzoWriter) writeBlock(last bool) error {
+	lw.out = lw.out[:0]
+
+	if !lw.started {
+		lw.out = appendLzoHeader(lw.out)
+		lw.started = true
+	}
+
+	if len(lw.buf) > 0 {
+		if lw.table == nil {
+			lw.table = make([]int32, 1<<lzoHashBits)
+		}
+
+		lw.out = binary.BigEndian.AppendUint32(lw.out, uint32(len(lw.buf)))
+		lw.out = binary.BigEndian.AppendUint32(lw.out, 0) // Compressed size
+		lw.out = binary.BigEndian.AppendUint32(lw.out, adler32.Checksum(lw.buf))
+
+		var start = len(lw.out)
+
+		lw.out = lzo1xEncode(lw.out, lw.buf, lw.table)
+
+		// Store the data as is if it does not compress
+		if len(lw.out)-start >= len(lw.buf) {
+			lw.out = append(lw.out[:start], lw.buf...)
+		}
+
+		binary.BigEndian.PutUint32(lw.out[start-8:], uint32(len(lw.out)-start))
+	}
+
+	if last {
+		lw.out = binary.BigEndian.AppendUint32(lw.out, 0)
+	}
+
+	lw.buf = lw.buf[:0]
+
+	if _, err := lw.w.Write(lw.out); err != nil {
+		lw.err = err
+		return err
+	}
+
+	return nil
+}
+
+func appendLzoHeader(dst []byte) []byte {
+	dst = append(dst, lzoMagic...)
+
+	var start = len(dst)
+
+	dst = binary.BigEndian.AppendUint16(dst, 0x1040) // Version, as lzop 1.04
+	dst = binary.BigEndian.AppendUint16(dst, 0x20a0) // Library version
+	dst = binary.BigEndian.AppendUint16(dst, 0x0940) // Version needed to extract
+	dst = append(dst, 1, 5)                          // Method (LZO1X-1) and level
+	dst = binary.BigEndian.AppendUint32(dst, lzoFlagAdler32D|lzoFlagOSUnix)
+	dst = binary.BigEndian.AppendUint32(dst, 0o100644) // Mode
+	dst = binary.BigEndian.AppendUint64(dst, 0)        // Mtime
+	dst = append(dst, 0)                               // Empty name
+
+	return binary.BigEndian.AppendUint32(dst, adler32.Checksum(dst[start:]))
+}
+
+// Decode an LZO1X stream from src into dst, returning the number of bytes
+// written. The stream must end with its end of stream marker.
+func lzo1xDecode(dst, src []byte) (int, error) {
+	var (
+		ip, op int
+		t      int
+	)
+
+	var next = func() (byte, bool) {
+		if ip >= len(src) {
+			return 0, false
+		}
+		ip++
+		return src[ip-1], true
+	}
+
+	// A length encoded as a run of zero bytes followed by a non-zero byte,
+	// each zero adding 255
+	var length = func(base int) (int, bool) {
+		var n int
+		for {
+			b, ok := next()
+			if !ok {
+				return 0, false
+			}
+			if b != 0 {
+				return n + base + int(b), true
+			}
+			n += 255
+			if n > len(dst) {
+				return 0, false
+			}
+		}
+	}
+
+	var literals = func(n int) bool {
+		if n > len(src)-ip || n > len(dst)-op {
+			return false
+		}
+		op += copy(dst[op:], src[ip:ip+n])
+		ip += n
+		return true
+	}
+
+	var match = func(dist, n int) bool {
+		if dist <= 0 || dist > op || n > len(dst)-op {
+			return false
+		}
+		for k := range n {
+			dst[op+k] = dst[op-dist+k]
+		}
+		op += n
+		return true
+	}
+
+	var distLow = func() (int, bool) {
+		if len(src)-ip < 2 {
+			return 0, false
+		}
+		ip += 2
+		return int(binary.LittleEndian.Uint16(src[ip-2:])), true
+	}
+
+	const (
+		stateLiterals = iota // Expecting a literal run or a match
+		stateFirst           // Following a literal run of 4 or more
+		stateMatch           // Following 1 to 3 trailing literals
+	)
+
+	var state = stateLiterals
+
+	if len(src) > 0 && src[0] > 17 {
+		ip++
+		t = int(src[0]) - 17
+		if !literals(t) {
+			return 0, ErrCorruptLzo
+		}
+		state = stateFirst
+		if t < 4 {
+			state = stateMatch
+		}
+	}
+
+	for {
+		b, ok := next()
+		if !ok {
+			return 0, ErrCorruptLzo
+		}
+		t = int(b)
+
+		if t < 16 {
+			switch state {
+			case stateLiterals:
+				// A literal run of 4 or more
+				if t == 0 {
+					if t, ok = length(15); !ok {
+						return 0, ErrCorruptLzo
+					}
+				}
+				if !literals(t + 3) {
+					return 0, ErrCorruptLzo
+				}
+				state = stateFirst
+				continue
+
+			case stateFirst:
+				// A match of 3 following a literal run, beyond the
+				// range of a short match
+				h, ok := next()
+				if !ok || !match(1+0x0800+(t>>2)+int(h)<<2, 3) {
+					return 0, ErrCorruptLzo
+				}
+
+			default:
+				// A match of 2 following trailing literals
+				h, ok := next()
+				if !ok || !match(1+(t>>2)+int(h)<<2, 2) {
+					return 0, ErrCorruptLzo
+				}
+			}
+		} else if t >= 64 {
+			h, ok := next()
+			if !ok || !match(1+((t>>2)&7)+int(h)<<3, (t>>5)+1) {
+				return 0, ErrCorruptLzo
+			}
+		} else if t >= 32 {
+			var n = t & 31
+			if n == 0 {
+				if n, ok = length(31); !ok {
+					return 0, ErrCorruptLzo
+				}
+			}
+
+			d, ok := distLow()
+			if !ok || !match(1+d>>2, n+2) {
+				return 0, ErrCorruptLzo
+			}
+		} else {
+			var (
+				far = (t & 8) << 11
+				n   = t & 7
+			)
+			if n == 0 {
+				if n, ok = length(7); !ok {
+					return 0, ErrCorruptLzo
+				}
+			}
+
+			d, ok := distLow()
+			if !ok {
+				return 0, ErrCorruptLzo
+			}
+
+			if far == 0 && d>>2 == 0 {
+				// End of stream
+				if ip != len(src) {
+					return 0, ErrCorruptLzo
+				}
+				return op, nil
+			}
+
+			if !match(far+d>>2+0x4000, n+2) {
+				return 0, ErrCorruptLzo
+			}
+		}
+
+		// Up to 3 literals may follow a match, given by the low bits of its
+		// last byte, in which case the next instruction is another match
+		if n := int(src[ip-2] & 3); n > 0 {
+			if !literals(n) {
+				return 0, ErrCorruptLzo
+			}
+			state = stateMatch
+		} else {
+			state = stateLiterals
+		}
+	}
+}
+
+const (
+	lzoHashBits    = 14
+	lzoMaxDistance = 0xBFFF
+	lzoM2MaxLen    = 8
+	lzoM2MaxDist   = 0x0800
+	lzoM3MaxDist   = 0x4000
+)
+
+// Append src encoded as an LZO1X stream to dst, using a greedy match search.
+// Only long matches (M2, M3 and M4) are produced, which every LZO1X
+// decompressor accepts. The table is used to find matches, and is cleared
+// first.
+func lzo1xEncode(dst, src []byte, table []int32) []byte {
+	clear(table)
+
+	var (
+		anchor   int
+		stateIdx = -1 // Of the byte holding the trailing literal count of the last match
+	)
+
+	var appendLength = func(dst []byte, n int) []byte {
+		for ; n > 255; n -= 255 {
+			dst = append(dst, 0)
+		}
+		return append(dst, byte(n))
+	}
+
+	var appendLiterals = func(dst, lits []byte) []byte {
+		switch n := len(lits); {
+		case n == 0:
+		case stateIdx < 0 && n < 4:
+			// Only possible at the start of the stream
+			dst = append(dst, byte(17+n))
+		case n < 4:
+			dst[stateIdx] |= byte(n)
+		case n <= 18:
+			dst = append(dst, byte(n-3))
+		default:
+			dst = append(dst, 0)
+			dst = appendLength(dst, n-18)
+		}
+
+		return append(dst, lits...)
+	}
+
+	for i := 0; i+4 <= len(src); {
+		var (
+			seq  = binary.LittleEndian.Uint32(src[i:])
+			h    = (seq * 2654435761) >> (32 - lzoHashBits)
+			cand = int(table[h]) - 1
+		)
+
+		table[h] = int32(i + 1)
+
+		if cand < 0 || i-cand > lzoMaxDistance || binary.LittleEndian.Uint32(src[cand:]) != seq {
+			i++
+			continue
+		}
+
+		var n = 4
+		for i+n < len(src) && src[cand+n] == src[i+n] {
+			n++
+		}
+
+		dst = appendLiterals(dst, src[anchor:i])
+
+		switch d := i - cand; {
+		case n <= lzoM2MaxLen && d <= lzoM2MaxDist:
+			dst = append(dst, byte((n-1)<<5|((d-1)&7)<<2), byte((d-1)>>3))
+			stateIdx = len(dst) - 2
+
+		case d <= lzoM3MaxDist:
+			if n-2 <= 31 {
+				dst = append(dst, byte(32|(n-2)))
+			} else {
+				dst = append(dst, 32)
+				dst = appendLength(dst, n-2-31)
+			}
+			dst = binary.LittleEndian.AppendUint16(dst, uint16((d-1)<<2))
+			stateIdx = len(dst) - 2
+
+		default:
+			d -= 0x4000
+			var t = byte(16 | (d>>11)&8)
+			if n-2 <= 7 {
+				dst = append(dst, t|byte(n-2))
+			} else {
+				dst = append(dst, t)
+				dst = appendLength(dst, n-2-7)
+			}
+			dst = binary.LittleEndian.AppendUint16(dst, uint16((d&0x3fff)<<2))
+			stateIdx = len(dst) - 2
+		}
+
+		i += n
+		anchor = i
+	}
+
+	dst = appendLiterals(dst, src[anchor:])
+
+	// End of stream marker
+	return append(dst, 16|1, 0, 0)
+}
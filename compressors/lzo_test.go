@@ -0,0 +1,53 @@
+package compressors
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestLzoReader(t *testing.T) {
+	expect, err := os.ReadFile("../testdata/data.cpio")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open("../testdata/data.cpio.lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := LzoReader(f)
+	if err != nil {
+		t.Fatalf("LzoReader: %s", err)
+	}
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+	if !bytes.Equal(got, expect) {
+		t.Errorf("expected %d bytes of data.cpio, got %d", len(expect), len(got))
+	}
+}
+
+func TestLzoRoundTrip(t *testing.T) { testRoundTrip(t, LzoWriter, LzoReader, true) }
+
+func TestLzoCorrupt(t *testing.T) { testCorrupt(t, LzoWriter, LzoReader) }
+
+func TestLzoWriter_Header(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, _ := LzoWriter(&buf)
+	w.Write([]byte("initramfs"))
+	w.(io.Closer).Close()
+
+	// The kernel only skips a single checksum per block, so the flags must
+	// request just the checksum of the uncompressed data
+	var flags = buf.Bytes()[len(lzoMagic)+8:]
+	if flags[0] != 0x03 || flags[1] != 0 || flags[2] != 0 || flags[3] != lzoFlagAdler32D {
+		t.Errorf("unexpected flags % x", flags[:4])
+	}
+}
@@ -0,0 +1,83 @@
+package initramfs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// The number of zero padding bytes that should follow n bytes of archive data
+// so that a subsequently concatenated archive starts on a
+// [StartCompressionAlignment] boundary.
+func PaddingForConcat(n int64) int64 { return alignFill(n, StartCompressionAlignment) }
+
+var ErrEarlyCompressed = errors.New("initramfs: early archive must not be compressed")
+
+// Combine an uncompressed early archive (such as one containing CPU microcode,
+// see [MicrocodeX86Path]) with a main archive, which may itself be compressed.
+//
+// The early archive is copied first, followed by sufficient zero padding (see
+// [PaddingForConcat]), and then the main archive is copied verbatim. Returns
+// [ErrEarlyCompressed] if the early archive starts with compressed data.
+func ConcatEarlyAndMain(dst io.Writer, early io.Reader, main io.Reader) error {
+	var br = bufio.NewReader(early)
+
+	la, err := PeekLookahead(br)
+	if err != nil {
+		return err
+	}
+
+	if la.Compression() {
+		return ErrEarlyCompressed
+	}
+
+	return Concat(dst, br, main)
+}
+
+// Concatenate already formed archive parts, each of which may be compressed or
+// uncompressed, into a single initramfs as the kernel expects.
+//
+// Each part is copied verbatim, and zero padding (see [PaddingForConcat]) is
+// inserted between parts so that each begins on a [StartCompressionAlignment]
+// boundary. The content of a part, compressed or otherwise, is never altered.
+// Returns an [UnexpectedContentError] for any part that starts with neither a
+// cpio header, zero padding nor recognized compressed data, with the offset
+// being the number of bytes written to dst up to that point.
+func Concat(dst io.Writer, parts ...io.Reader) error {
+	var n int64
+
+	for i, part := range parts {
+		var br = bufio.NewReader(part)
+
+		la, err := PeekLookahead(br)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case la == EOF:
+			continue
+		case la == CpioFile, la == Padding, la.Compression():
+		default:
+			peek, _ := br.Peek(8)
+			return &UnexpectedContentError{Offset: n, Peek: bytes.Clone(peek)}
+		}
+
+		if i > 0 {
+			var pad = PaddingForConcat(n)
+			if _, err := dst.Write(zeroPadding[:pad]); err != nil {
+				return err
+			}
+			n += pad
+		}
+
+		k, err := io.Copy(dst, br)
+		n += k
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package initramfs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestConcatEarlyAndMain(t *testing.T) {
+	var early, main bytes.Buffer
+
+	ew := NewWriter(&early)
+	testWriteHeader(t, ew, &Header{Mode: Mode_File | 0o644, Filename: MicrocodePath_AuthenticAMD})
+	if err := ew.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	mw := NewWriter(&main)
+	if err := mw.StartCompressionType(Gzip); err != nil {
+		t.Fatalf("StartCompressionType: %s", err)
+	}
+	testWriteHeader(t, mw, &Header{Mode: Mode_File | 0o755, Filename: "init"})
+	if err := mw.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	var (
+		earlyLen  = int64(early.Len())
+		mainBytes = bytes.Clone(main.Bytes())
+	)
+
+	var combined bytes.Buffer
+	if err := ConcatEarlyAndMain(&combined, &early, &main); err != nil {
+		t.Fatalf("ConcatEarlyAndMain: %s", err)
+	}
+
+	var mainOffset = earlyLen + PaddingForConcat(earlyLen)
+	if mainOffset%StartCompressionAlignment != 0 {
+		t.Fatalf("main archive offset %d is not aligned", mainOffset)
+	}
+
+	if !GzipMagic1.MatchBytes(combined.Bytes()[mainOffset:]) {
+		t.Fatalf("expected gzip data at offset %d", mainOffset)
+	}
+
+	var (
+		r    = NewReader(&combined)
+		hdrs headerList
+	)
+
+	hdrs.readAll(r)
+
+	if compressed, typ, err := r.ContinueCompressed(nil); err != nil {
+		t.Fatalf("ContinueCompressed: %s", err)
+	} else if !compressed || typ != Gzip {
+		t.Fatalf("expected gzip compression, got %v %s", compressed, typ)
+	}
+
+	hdrs.readAll(r)
+	hdrs.expectNames(t,
+		".",
+		"kernel",
+		"kernel/x86",
+		"kernel/x86/microcode",
+		MicrocodePath_AuthenticAMD,
+		TrailerFilename,
+		".",
+		"init",
+		TrailerFilename,
+	)
+
+	t.Run("compressed early", func(t *testing.T) {
+		var dst bytes.Buffer
+		if err := ConcatEarlyAndMain(&dst, bytes.NewReader(mainBytes), &early); err != ErrEarlyCompressed {
+			t.Fatalf("expected ErrEarlyCompressed, got %v", err)
+		}
+	})
+}
+
+func TestConcat(t *testing.T) {
+	var parts [3]bytes.Buffer
+
+	for i, name := range []string{"a", "b", "c"} {
+		w := NewWriter(&parts[i])
+		if i == 1 {
+			if err := w.StartCompressionType(Gzip); err != nil {
+				t.Fatalf("StartCompressionType: %s", err)
+			}
+		}
+		if err := w.WriteFile(name, 0o644, []byte(name)); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %s", err)
+		}
+	}
+
+	var (
+		a   = bytes.Clone(parts[0].Bytes())
+		b   = bytes.Clone(parts[1].Bytes())
+		c   = bytes.Clone(parts[2].Bytes())
+		dst bytes.Buffer
+	)
+
+	if err := Concat(&dst, &parts[0], &parts[1], &parts[2]); err != nil {
+		t.Fatalf("Concat: %s", err)
+	}
+
+	var (
+		raw  = dst.Bytes()
+		offB = len(a) + int(PaddingForConcat(int64(len(a))))
+		endB = offB + len(b)
+		offC = endB + int(PaddingForConcat(int64(endB)))
+	)
+
+	if !bytes.Equal(raw[:len(a)], a) || !bytes.Equal(raw[offB:endB], b) || !bytes.Equal(raw[offC:], c) {
+		t.Fatalf("parts not copied verbatim at aligned offsets")
+	}
+
+	if offB%StartCompressionAlignment != 0 || offC%StartCompressionAlignment != 0 {
+		t.Errorf("expected aligned parts, got offsets %d and %d", offB, offC)
+	}
+
+	var bad = bytes.NewReader([]byte("not an archive"))
+	if err := Concat(&dst, bad); err == nil {
+		t.Errorf("expected error for unrecognized part")
+	}
+}
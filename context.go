@@ -0,0 +1,100 @@
+package initramfs
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// The amount of file data copied by [Writer.ReadFromContext] and
+// [Reader.WriteToContext] between checks for cancellation.
+const ContextCopyChunkSize = 64 << 10
+
+// Copy n bytes from src to dst, checking ctx for cancellation before each
+// chunk. Returns [io.EOF] if src provides fewer than n bytes, as [io.CopyN].
+func copyNContext(ctx context.Context, dst io.Writer, src io.Reader, n int64) (written int64, err error) {
+	if ctx.Done() == nil {
+		// Can never be cancelled
+		return io.CopyN(dst, src, n)
+	}
+
+	for written < n {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		k, err := io.CopyN(dst, src, min(n-written, ContextCopyChunkSize))
+		written += k
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// As [Writer.ReadFrom], but copies the data in chunks (see
+// [ContextCopyChunkSize]) and returns the error of ctx promptly once it is
+// cancelled. Any file data not yet written is zero filled by the next call to
+// [Writer.WriteHeader], [Writer.WriteTrailer] or [Writer.Close].
+func (iw *Writer) ReadFromContext(ctx context.Context, r io.Reader) (n int64, err error) {
+	if iw.closed {
+		return 0, os.ErrClosed
+	}
+
+	if rem := iw.fileRemaining; rem == 0 {
+		if lr, ok := r.(interface{ Len() int }); ok && lr.Len() == 0 {
+			return 0, nil
+		}
+		return 0, ErrFileTooLarge
+	} else {
+		var dst = iw.curW
+		if iw.dropping {
+			dst = io.Discard
+		} else if iw.sumPending {
+			dst = sumWriter{dst, &iw.sum}
+		}
+
+		n, err = copyNContext(ctx, dst, r, rem)
+		if n > 0 {
+			if !iw.dropping {
+				iw.written += n
+			}
+			iw.fileRemaining -= n
+
+			if iw.fileRemaining == 0 {
+				iw.entryDone()
+			}
+		}
+
+		if err == nil {
+			if lr, ok := r.(interface{ Len() int }); ok && lr.Len() > 0 {
+				err = ErrFileTooLarge
+			}
+		}
+
+		return
+	}
+}
+
+// As [Reader.WriteTo], but copies the data in chunks (see
+// [ContextCopyChunkSize]) and returns the error of ctx promptly once it is
+// cancelled. Any file data not yet copied is skipped by the next call to
+// [Reader.Next].
+func (r *Reader) WriteToContext(ctx context.Context, w io.Writer) (n int64, err error) {
+	if rem := r.fileR.N; rem == 0 {
+		return 0, io.EOF
+	} else {
+		if r.sumActive {
+			w = sumWriter{w, &r.sum}
+		}
+
+		n, err = copyNContext(ctx, w, r.br, rem)
+		r.fileR.N -= n
+
+		if err == nil && r.sumActive && r.fileR.N == 0 {
+			err = r.checkSum()
+		}
+		return
+	}
+}
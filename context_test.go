@@ -0,0 +1,106 @@
+package initramfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// Cancels the context once the first read has been made.
+type cancellingReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (cr *cancellingReader) Read(p []byte) (int, error) {
+	cr.cancel()
+	return cr.r.Read(p)
+}
+
+func TestWriter_ReadFromContext(t *testing.T) {
+	var (
+		data = bytes.Repeat([]byte{'x'}, 3*ContextCopyChunkSize)
+		buf  bytes.Buffer
+		w    = NewWriter(&buf)
+	)
+
+	var hdr = Header{Mode: Mode_File | 0o644, Filename: "big"}
+	if err := hdr.SetDataSize(int64(len(data))); err != nil {
+		t.Fatalf("SetDataSize: %s", err)
+	}
+	if err := w.WriteHeader(&hdr); err != nil {
+		t.Fatalf("WriteHeader: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n, err := w.ReadFromContext(ctx, &cancellingReader{bytes.NewReader(data), cancel})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if n != ContextCopyChunkSize {
+		t.Errorf("expected %d bytes before cancellation, got %d", ContextCopyChunkSize, n)
+	}
+
+	// The remaining data is zero filled
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	r := NewReader(&buf)
+	testNextNamed(t, r, ".")
+	testNextNamed(t, r, "big")
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+
+	var expect = append(data[:n:n], make([]byte, len(data)-int(n))...)
+	if !bytes.Equal(got, expect) {
+		t.Errorf("unexpected data following cancellation")
+	}
+}
+
+func TestReader_WriteToContext(t *testing.T) {
+	var (
+		data = bytes.Repeat([]byte{'x'}, 3*ContextCopyChunkSize)
+		buf  bytes.Buffer
+		w    = NewWriter(&buf)
+	)
+
+	if err := w.WriteFile("big", 0o644, data); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteFile("small", 0o644, []byte("small")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	r := NewReader(&buf)
+	testNextNamed(t, r, ".")
+	testNextNamed(t, r, "big")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if n, err := r.WriteToContext(ctx, io.Discard); n != 0 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected nothing copied and context.Canceled, got %d and %v", n, err)
+	}
+
+	// The uncopied data is skipped
+	testNextNamed(t, r, "small")
+
+	var out bytes.Buffer
+	if _, err := r.WriteToContext(context.Background(), &out); err != nil {
+		t.Fatalf("WriteToContext: %s", err)
+	}
+	if out.String() != "small" {
+		t.Errorf("expected data %q, got %q", "small", out.String())
+	}
+}
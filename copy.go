@@ -0,0 +1,263 @@
+package initramfs
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// Copy an archive from src to dst, reproducing its segment structure: each
+// compressed segment in src is decompressed using the global [CompressReaders]
+// and the entries are recompressed in dst using the [CompressWriter] registered
+// for the same [Lookahead] in [CompressWriters].
+//
+// Entries are copied through [Writer.WriteHeader], so headers and alignment
+// are normalized in the process.
+func CopyPreservingSegments(dst io.Writer, src io.Reader) error {
+	var (
+		r  = NewReader(src)
+		iw = NewWriter(dst)
+	)
+
+	for {
+		if err := copyEntries(iw, r); err != nil {
+			return err
+		}
+
+		compressed, typ, err := r.ContinueCompressed(nil)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if iw.compressed {
+			if err := iw.EndCompression(); err != nil {
+				return err
+			}
+		}
+
+		if !compressed {
+			// An uncompressed archive follows the end of a compressed segment
+			continue
+		}
+
+		if err := iw.StartCompressionType(typ); err != nil {
+			return err
+		}
+	}
+
+	if iw.compressed {
+		if err := iw.EndCompression(); err != nil {
+			return err
+		}
+	}
+
+	return iw.Flush()
+}
+
+// Copy entries from the current segment of r until the end of the input or
+// the start of compressed data.
+func copyEntries(iw *Writer, r *Reader) error {
+	for {
+		hdr, err := r.Next()
+		switch {
+		case err == ErrCompressedContentAhead, err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+
+		if err := iw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if hdr.DataSize > 0 {
+			if _, err := iw.ReadFrom(r); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Copy an archive from src to dst, replacing the compression of every
+// compressed segment with out, while preserving the exact layout of the
+// entries. Compressed segments are decompressed using crs (or the global
+// [CompressReaders] if nil), and the decompressed bytes are recompressed
+// verbatim, with each new segment padded to [StartCompressionAlignment] as per
+// [PaddingForConcat]. Any uncompressed parts (such as an early microcode
+// archive) are copied verbatim, without being compressed.
+//
+// A compressed segment ends where its decompressor reports the end of the
+// stream, after which any padding and further segments may follow. Returns
+// [ErrNoCompressReader] if a segment has no reader in crs, or an
+// [UnexpectedContentError] for content that is neither a newc cpio header,
+// zero padding nor recognized compressed data, with the offset being relative
+// to the start of the uncompressed part.
+func Recompress(dst io.Writer, src io.Reader, out CompressWriter, crs CompressReaderMap) error {
+	if crs == nil {
+		crs = CompressReaders
+	}
+
+	var (
+		br = bufio.NewReader(src)
+		cw = &countWriter{w: dst}
+	)
+
+	for {
+		la, err := PeekLookahead(br)
+		if err != nil {
+			return err
+		}
+
+		if la == EOF {
+			return nil
+		} else if !la.Compression() {
+			if err := copyUncompressed(cw, br); err != nil {
+				return err
+			}
+			continue
+		}
+
+		dec, ok := crs[la]
+		if !ok {
+			return ErrNoCompressReader
+		}
+
+		dr, err := dec(br)
+		if err != nil {
+			return err
+		}
+
+		if _, err := cw.Write(zeroPadding[:PaddingForConcat(cw.n)]); err != nil {
+			return err
+		}
+
+		w, err := out(cw)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(w, dr); err != nil {
+			return err
+		}
+
+		if closer, ok := w.(io.Closer); ok {
+			err = closer.Close()
+		} else if flusher, ok := w.(Flusher); ok {
+			err = flusher.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Copy the uncompressed archive at the start of br verbatim, entry by entry,
+// until the end of the input or the start of compressed data.
+func copyUncompressed(dst io.Writer, br *bufio.Reader) error {
+	var n int64 // Relative to the start of this part, for alignment
+
+	var copyN = func(k int64) error {
+		m, err := io.CopyN(dst, br, k)
+		n += m
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	for {
+		// Any zero padding, such as that between entries or following a
+		// trailer, is copied as is
+		var zeros int64
+		for {
+			b, err := br.ReadByte()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			} else if b != 0 {
+				br.UnreadByte()
+				break
+			}
+			zeros++
+		}
+
+		for pad := zeros; pad > 0; {
+			k, err := dst.Write(zeroPadding[:min(pad, int64(len(zeroPadding)))])
+			if err != nil {
+				return err
+			}
+			pad -= int64(k)
+		}
+		n += zeros
+
+		la, err := PeekLookahead(br)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case la == EOF, la.Compression():
+			return nil
+		case la != CpioFile:
+			peek, _ := br.Peek(8)
+			return &UnexpectedContentError{Offset: n, Peek: bytes.Clone(peek)}
+		}
+
+		var hdr Header
+
+		k, err := hdr.readFrom(io.TeeReader(br, dst), DefaultMaxFilenameSize)
+		n += k
+		if err != nil {
+			return err
+		}
+
+		if err := copyN(alignFill(n, 4) + int64(hdr.DataSize)); err != nil {
+			return err
+		}
+	}
+}
+
+// Copy the remainder of the current (possibly decompressed) stream of src to
+// dst verbatim, such that an uncompressed archive is reproduced byte for byte.
+// Any remaining data of the current file is copied first, followed by each
+// header exactly as read, its file data, and the padding between entries (see
+// [Reader.LastGap]), unlike [CopyPreservingSegments] which normalizes headers
+// and alignment.
+//
+// Returns nil upon reaching the end of the input, having copied any trailing
+// padding, or [ErrCompressedContentAhead] if compressed content follows,
+// having copied the padding before it (see [Reader.ContinueCompressed]). Any
+// other error, such as an [UnexpectedContentError], is returned as is.
+func CopyRaw(dst io.Writer, src *Reader) error {
+	if err := copyFileRemaining(dst, src); err != nil {
+		return err
+	}
+
+	src.raw = dst
+	defer func() { src.raw = nil }()
+
+	for {
+		var hdr Header
+		if err := src.next(&hdr); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := copyFileRemaining(dst, src); err != nil {
+			return err
+		}
+	}
+}
+
+func copyFileRemaining(dst io.Writer, src *Reader) error {
+	if src.FileRemaining() == 0 {
+		return nil
+	}
+
+	_, err := src.WriteTo(dst)
+	return err
+}
@@ -0,0 +1,259 @@
+package initramfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestCopyPreservingSegments(t *testing.T) {
+	var src bytes.Buffer
+
+	w := NewWriter(&src)
+	if err := w.WriteFile(MicrocodePath_GenuineIntel, 0o644, []byte("microcode")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+	if err := w.StartCompressionType(Gzip); err != nil {
+		t.Fatalf("StartCompressionType: %s", err)
+	}
+	if err := w.WriteFile("init", 0o755, []byte("#!/bin/sh\n")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	var dst bytes.Buffer
+	if err := CopyPreservingSegments(&dst, &src); err != nil {
+		t.Fatalf("CopyPreservingSegments: %s", err)
+	}
+
+	var (
+		r    = NewReader(&dst)
+		hdrs headerList
+	)
+
+	hdrs.readAll(r)
+
+	if codec := r.CurrentCodec(); codec != UnknownLookahead {
+		t.Errorf("expected uncompressed first segment, got %s", codec)
+	}
+
+	if _, _, err := r.ContinueCompressed(nil); err != nil {
+		t.Fatalf("ContinueCompressed: %s", err)
+	}
+
+	if codec := r.CurrentCodec(); codec != Gzip {
+		t.Errorf("expected gzip second segment, got %s", codec)
+	}
+
+	hdrs.readAll(r)
+	hdrs.expectNames(t,
+		".",
+		"kernel",
+		"kernel/x86",
+		"kernel/x86/microcode",
+		MicrocodePath_GenuineIntel,
+		TrailerFilename,
+		".",
+		"init",
+		TrailerFilename,
+	)
+}
+
+func TestCopyPreservingSegments_Concatenated(t *testing.T) {
+	// Each gzip segment is followed by zero padding, and the second by
+	// another segment
+	var src = testConcatenatedArchive(t, "early", "first", "second")
+
+	var dst bytes.Buffer
+	if err := CopyPreservingSegments(&dst, bytes.NewReader(src)); err != nil {
+		t.Fatalf("CopyPreservingSegments: %s", err)
+	}
+
+	testExpectConcatenated(t, NewReader(&dst), "early", "first", "second")
+}
+
+func TestWriter_EndCompression(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	if err := w.EndCompression(); err != ErrNotCompressed {
+		t.Fatalf("expected ErrNotCompressed, got %v", err)
+	}
+
+	if err := w.StartCompressionType(Gzip); err != nil {
+		t.Fatalf("StartCompressionType: %s", err)
+	}
+
+	testMkdirHeader(t, w, "compressed", nil)
+
+	if err := w.EndCompression(); err != nil {
+		t.Fatalf("EndCompression: %s", err)
+	}
+
+	if err := w.StartCompressionType(Gzip); err != nil {
+		t.Fatalf("StartCompressionType: %s", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	if _, err := r.Next(); err != ErrCompressedContentAhead {
+		t.Fatalf("expected ErrCompressedContentAhead, got %v", err)
+	}
+
+	if _, _, err := r.ContinueCompressed(nil); err != nil {
+		t.Fatalf("ContinueCompressed: %s", err)
+	}
+
+	testNextNamed(t, r, ".")
+	testNextNamed(t, r, "compressed")
+}
+
+func TestRecompress(t *testing.T) {
+	var src = testSegmentedArchive(t, true)
+
+	var dst bytes.Buffer
+	if err := Recompress(&dst, bytes.NewReader(src), testGzipWriterLevel(t, gzip.BestCompression), nil); err != nil {
+		t.Fatalf("Recompress: %s", err)
+	}
+
+	// The uncompressed part is unchanged, and the decompressed bytes of the
+	// compressed segment are identical
+	var decompressed = func(b []byte) ([]byte, []byte) {
+		var i = bytes.Index(b, []byte{0x1f, 0x8b})
+		if i < 0 {
+			t.Fatalf("no gzip segment found")
+		}
+
+		gr, err := gzip.NewReader(bytes.NewReader(b[i:]))
+		if err != nil {
+			t.Fatalf("gzip NewReader: %s", err)
+		}
+
+		data, err := io.ReadAll(gr)
+		if err != nil {
+			t.Fatalf("gzip ReadAll: %s", err)
+		}
+
+		return b[:i], data
+	}
+
+	var (
+		srcPrefix, srcData = decompressed(src)
+		dstPrefix, dstData = decompressed(dst.Bytes())
+	)
+
+	if !bytes.Equal(srcPrefix, dstPrefix) {
+		t.Errorf("uncompressed part differs")
+	}
+	if !bytes.Equal(srcData, dstData) {
+		t.Errorf("decompressed segment differs")
+	}
+
+	if err := Recompress(io.Discard, bytes.NewReader(src), GzipWriter, CompressReaderMap{}); err != ErrNoCompressReader {
+		t.Errorf("expected ErrNoCompressReader, got %v", err)
+	}
+
+	var ucErr *UnexpectedContentError
+	if err := Recompress(io.Discard, bytes.NewReader(append(bytes.Clone(srcPrefix[:HeaderSize+4]), "garbage!"...)), GzipWriter, nil); !errors.As(err, &ucErr) {
+		t.Errorf("expected UnexpectedContentError, got %v", err)
+	}
+}
+
+func TestRecompress_Concatenated(t *testing.T) {
+	// Each gzip segment is followed by zero padding, and the second by
+	// another segment
+	var src = testConcatenatedArchive(t, "early", "first", "second")
+
+	var dst bytes.Buffer
+	if err := Recompress(&dst, bytes.NewReader(src), testGzipWriterLevel(t, gzip.BestSpeed), nil); err != nil {
+		t.Fatalf("Recompress: %s", err)
+	}
+
+	testExpectConcatenated(t, NewReader(&dst), "early", "first", "second")
+}
+
+func TestCopyRaw(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	w.SetTrailerPadding(512)
+
+	if err := w.WriteFile("a", 0o644, []byte("x")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.SetHeaderAlignment(512); err != nil {
+		t.Fatalf("SetHeaderAlignment: %s", err)
+	}
+	if err := w.WriteFile("bb", 0o644, []byte("hello")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var raw = buf.Bytes()
+
+	// Details that would be normalized by re-serializing: lowercase hex and a
+	// non-zero byte of the alignment following a filename
+	var i = bytes.Index(raw, []byte("000081A4"))
+	copy(raw[i:], "000081a4")
+	i = bytes.Index(raw, []byte("bb\x00"))
+	raw[i+3] = 'Z'
+
+	for _, partial := range []bool{false, true} {
+		var (
+			out bytes.Buffer
+			r   = NewReader(bytes.NewReader(raw))
+		)
+
+		if partial {
+			// Stop before the data of a file, which is then copied by CopyRaw
+			testNextNamed(t, r, ".")
+			testNextNamed(t, r, "a")
+			out.Write(raw[:r.Offset()])
+		}
+
+		if err := CopyRaw(&out, r); err != nil {
+			t.Fatalf("CopyRaw: %s", err)
+		}
+
+		if !bytes.Equal(out.Bytes(), raw) {
+			t.Errorf("partial %v: copy differs from the original (%d vs %d bytes)", partial, out.Len(), len(raw))
+		}
+	}
+
+	// Stops at compressed content, having copied the padding before it
+	buf.Reset()
+	buf.Write(raw)
+
+	w = NewWriter(&buf)
+	if err := w.StartCompressionType(Gzip); err != nil {
+		t.Fatalf("StartCompressionType: %s", err)
+	}
+	if err := w.WriteFile("c", 0o644, []byte("compressed")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	var out bytes.Buffer
+	if err := CopyRaw(&out, NewReader(bytes.NewReader(buf.Bytes()))); err != ErrCompressedContentAhead {
+		t.Fatalf("expected ErrCompressedContentAhead, got %v", err)
+	}
+
+	if !bytes.Equal(out.Bytes(), raw) {
+		t.Errorf("uncompressed prefix differs from the original (%d vs %d bytes)", out.Len(), len(raw))
+	}
+}
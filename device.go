@@ -0,0 +1,76 @@
+package initramfs
+
+// The kernel opens `/dev/console` for the stdin, stdout and stderr of `/init`.
+// If the node does not exist within the initramfs, `/init` will be started
+// without any standard file descriptors. See [Documentation/admin-guide/devices.txt].
+//
+// [Documentation/admin-guide/devices.txt]: https://www.kernel.org/doc/Documentation/admin-guide/devices.txt
+const (
+	ConsoleDevicePath      = "dev/console"
+	ConsoleMajor           = 5
+	ConsoleMinor           = 1
+	ConsoleMode       Mode = Mode_CharDevice | 0o600
+)
+
+// Permissions for the `/dev` directory when it is created by
+// [Writer.WriteConsoleDevice].
+const DevDirPerm Mode = 0o755
+
+// Add the `/dev/console` character device node (major 5, minor 1) to the
+// archive, creating the `/dev` directory first if it has not already been
+// added.
+func (iw *Writer) WriteConsoleDevice() error {
+	if err := iw.MkdirAll("dev", DevDirPerm); err != nil {
+		return err
+	}
+
+	return iw.WriteCharDevice(ConsoleDevicePath, ConsoleMode, ConsoleMajor, ConsoleMinor)
+}
+
+// Add a character device node with the given permissions and device numbers.
+// Any file type bits in mode are replaced.
+func (iw *Writer) WriteCharDevice(name string, mode Mode, major, minor uint32) error {
+	return iw.writeNode(name, Mode_CharDevice|(mode&^Mode_FileTypeMask), major, minor)
+}
+
+// Add a block device node with the given permissions and device numbers. Any
+// file type bits in mode are replaced.
+func (iw *Writer) WriteBlockDevice(name string, mode Mode, major, minor uint32) error {
+	return iw.writeNode(name, Mode_BlockDevice|(mode&^Mode_FileTypeMask), major, minor)
+}
+
+// Add a named pipe (FIFO) with the given permissions. Any file type bits in
+// mode are replaced.
+func (iw *Writer) WriteFIFO(name string, mode Mode) error {
+	return iw.writeNode(name, Mode_FIFO|(mode&^Mode_FileTypeMask), 0, 0)
+}
+
+func (iw *Writer) writeNode(name string, mode Mode, major, minor uint32) error {
+	var hdr = Header{
+		Mode:     mode,
+		RMajor:   major,
+		RMinor:   minor,
+		Filename: name,
+	}
+
+	return iw.WriteHeader(&hdr)
+}
+
+// Combine major and minor device numbers into a Linux dev_t, as found in
+// [syscall.Stat_t] and as expected by mknod(2).
+func Makedev(major, minor uint32) uint64 {
+	var (
+		maj = uint64(major)
+		min = uint64(minor)
+	)
+	return (maj&0xfff)<<8 | (maj&^0xfff)<<32 | (min & 0xff) | (min&^0xff)<<12
+}
+
+// Split a Linux dev_t into its major and minor device numbers, suitable for the
+// Major/Minor and RMajor/RMinor fields of a [Header]. This is the inverse of
+// [Makedev].
+func SplitDev(dev uint64) (major, minor uint32) {
+	major = uint32(((dev >> 8) & 0xfff) | ((dev >> 32) &^ 0xfff))
+	minor = uint32((dev & 0xff) | ((dev >> 12) &^ 0xff))
+	return
+}
@@ -0,0 +1,103 @@
+package initramfs
+
+import "testing"
+
+func TestWriter_WriteConsoleDevice(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	if err := w.WriteConsoleDevice(); err != nil {
+		t.Fatalf("WriteConsoleDevice: %s", err)
+	}
+
+	var hdrs headerList
+	hdrs.readAll(r)
+	hdrs.expectNames(t,
+		".",
+		"dev",
+		ConsoleDevicePath,
+	)
+
+	if len(hdrs) != 3 {
+		t.Fatalf("expected 3 headers, got %d", len(hdrs))
+	}
+
+	if got := hdrs[1].Mode; got != Mode_Dir|DevDirPerm {
+		t.Errorf("expected dev mode %s, got %s", Mode_Dir|DevDirPerm, got)
+	}
+
+	var hdr = hdrs[2]
+
+	if !hdr.Mode.CharDevice() {
+		t.Errorf("expected char device, got %s", hdr.Mode)
+	}
+
+	if got := hdr.Mode.Perms(); got != 0o600 {
+		t.Errorf("expected perms 0o600, got %#o", got)
+	}
+
+	if hdr.RMajor != 5 || hdr.RMinor != 1 {
+		t.Errorf("expected device 5,1, got %d,%d", hdr.RMajor, hdr.RMinor)
+	}
+}
+
+func TestWriter_WriteDeviceNodes(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	if err := w.WriteCharDevice("null", Mode_File|0o666, 1, 3); err != nil {
+		t.Fatalf("WriteCharDevice: %s", err)
+	}
+	if err := w.WriteBlockDevice("sda", 0o660, 8, 0); err != nil {
+		t.Fatalf("WriteBlockDevice: %s", err)
+	}
+	if err := w.WriteFIFO("pipe", 0o644); err != nil {
+		t.Fatalf("WriteFIFO: %s", err)
+	}
+
+	var hdrs headerList
+	hdrs.readAll(r)
+	hdrs.expectNames(t, ".", "null", "sda", "pipe")
+
+	if len(hdrs) != 4 {
+		t.Fatalf("expected 4 headers, got %d", len(hdrs))
+	}
+
+	for _, tc := range []struct {
+		hdr          *Header
+		mode         Mode
+		major, minor uint32
+	}{
+		{&hdrs[1], Mode_CharDevice | 0o666, 1, 3},
+		{&hdrs[2], Mode_BlockDevice | 0o660, 8, 0},
+		{&hdrs[3], Mode_FIFO | 0o644, 0, 0},
+	} {
+		if tc.hdr.Mode != tc.mode {
+			t.Errorf("%s: expected mode %s, got %s", tc.hdr.Filename, tc.mode, tc.hdr.Mode)
+		}
+		if tc.hdr.RMajor != tc.major || tc.hdr.RMinor != tc.minor {
+			t.Errorf("%s: expected device %d,%d, got %d,%d", tc.hdr.Filename, tc.major, tc.minor, tc.hdr.RMajor, tc.hdr.RMinor)
+		}
+		if tc.hdr.DataSize != 0 {
+			t.Errorf("%s: expected zero DataSize, got %d", tc.hdr.Filename, tc.hdr.DataSize)
+		}
+	}
+}
+
+func TestMakedev(t *testing.T) {
+	for _, tc := range []struct {
+		major, minor uint32
+		dev          uint64
+	}{
+		{5, 1, 0x501},
+		{8, 0, 0x800},
+		{259, 65536, 0x1001_0300},
+		{4096, 256, 0x1000_0010_0000},
+	} {
+		if got := Makedev(tc.major, tc.minor); got != tc.dev {
+			t.Errorf("Makedev(%d, %d): expected %#x, got %#x", tc.major, tc.minor, tc.dev, got)
+		}
+
+		if major, minor := SplitDev(tc.dev); major != tc.major || minor != tc.minor {
+			t.Errorf("SplitDev(%#x): expected %d,%d, got %d,%d", tc.dev, tc.major, tc.minor, major, minor)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package initramfs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// How an entry differs between two archives.
+type DiffKind int
+
+const (
+	DiffAdded    DiffKind = iota + 1 // Only present in the second archive
+	DiffRemoved                      // Only present in the first archive
+	DiffModified                     // Present in both, but different
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffModified:
+		return "modified"
+	default:
+		return fmt.Sprintf("DiffKind(%d)", int(k))
+	}
+}
+
+// An entry that differs between two archives, see [Diff].
+type DiffEntry struct {
+	Filename string // Normalized
+	Kind     DiffKind
+
+	// For modified entries, which aspects differ.
+	ModeChanged bool
+	SizeChanged bool
+	DataChanged bool
+}
+
+func (d DiffEntry) String() string {
+	if d.Kind != DiffModified {
+		return fmt.Sprintf("%s %s", d.Kind, d.Filename)
+	}
+
+	var what []string
+	if d.ModeChanged {
+		what = append(what, "mode")
+	}
+	if d.SizeChanged {
+		what = append(what, "size")
+	}
+	if d.DataChanged {
+		what = append(what, "data")
+	}
+
+	return fmt.Sprintf("%s %s (%s)", d.Kind, d.Filename, strings.Join(what, ", "))
+}
+
+// Summary of an entry for comparison.
+type diffSummary struct {
+	mode Mode
+	size uint32
+	sum  [sha256.Size]byte
+}
+
+// Compare the entries of two archives, including any compressed segments (see
+// [CompressReaders]), by normalized filename. An entry is modified if its mode,
+// data size or data (compared by SHA-256 digest, so that file data need not be
+// held in memory) differ. Other metadata, such as ownership and modification
+// times, is ignored. If a filename appears more than once in an archive, the
+// last entry is used, as it is what the kernel would leave in place.
+//
+// The differences are returned sorted by filename.
+func Diff(a, b *Reader) ([]DiffEntry, error) {
+	sa, err := summarizeEntries(a)
+	if err != nil {
+		return nil, err
+	}
+
+	sb, err := summarizeEntries(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []DiffEntry
+
+	for name, x := range sa {
+		y, ok := sb[name]
+		if !ok {
+			diffs = append(diffs, DiffEntry{Filename: name, Kind: DiffRemoved})
+			continue
+		}
+
+		var d = DiffEntry{
+			Filename:    name,
+			Kind:        DiffModified,
+			ModeChanged: x.mode != y.mode,
+			SizeChanged: x.size != y.size,
+			DataChanged: x.sum != y.sum,
+		}
+
+		if d.ModeChanged || d.SizeChanged || d.DataChanged {
+			diffs = append(diffs, d)
+		}
+	}
+
+	for name := range sb {
+		if _, ok := sa[name]; !ok {
+			diffs = append(diffs, DiffEntry{Filename: name, Kind: DiffAdded})
+		}
+	}
+
+	slices.SortFunc(diffs, func(x, y DiffEntry) int { return strings.Compare(x.Filename, y.Filename) })
+
+	return diffs, nil
+}
+
+func summarizeEntries(r *Reader) (map[string]diffSummary, error) {
+	var entries = make(map[string]diffSummary)
+
+	err := r.walk(func(hdr *Header) error {
+		if hdr.Trailer() {
+			return nil
+		}
+
+		var h = sha256.New()
+		if hdr.DataSize > 0 {
+			if _, err := io.Copy(h, r); err != nil {
+				return err
+			}
+		}
+
+		var s = diffSummary{mode: hdr.Mode, size: hdr.DataSize}
+		h.Sum(s.sum[:0])
+
+		entries[normalizeName(hdr.Filename)] = s
+		return nil
+	})
+
+	return entries, err
+}
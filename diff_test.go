@@ -0,0 +1,65 @@
+package initramfs
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	var build = func(files map[string]string, modes map[string]Mode) *Reader {
+		var buf bytes.Buffer
+
+		w := NewWriter(&buf)
+		for _, name := range slices.Sorted(maps.Keys(files)) {
+			var mode = modes[name]
+			if mode == 0 {
+				mode = 0o644
+			}
+
+			if err := w.WriteFile(name, mode, []byte(files[name])); err != nil {
+				t.Fatalf("WriteFile: %s", err)
+			}
+		}
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+
+		return NewReader(&buf)
+	}
+
+	var (
+		a = build(map[string]string{
+			"etc/hosts":    "127.0.0.1 localhost\n",
+			"etc/hostname": "alpha\n",
+			"etc/motd":     "welcome\n",
+			"init":         "#!/bin/sh\n",
+			"old":          "",
+		}, nil)
+		b = build(map[string]string{
+			"/etc/hosts":   "127.0.0.1 localhost\n",
+			"etc/hostname": "bravo\n",
+			"etc/motd":     "welcome to the machine\n",
+			"init":         "#!/bin/sh\n",
+			"new":          "",
+		}, map[string]Mode{"init": 0o755})
+	)
+
+	diffs, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("Diff: %s", err)
+	}
+
+	var expect = []DiffEntry{
+		{Filename: "etc/hostname", Kind: DiffModified, DataChanged: true},
+		{Filename: "etc/motd", Kind: DiffModified, SizeChanged: true, DataChanged: true},
+		{Filename: "init", Kind: DiffModified, ModeChanged: true},
+		{Filename: "new", Kind: DiffAdded},
+		{Filename: "old", Kind: DiffRemoved},
+	}
+
+	if !slices.Equal(diffs, expect) {
+		t.Errorf("expected %v, got %v", expect, diffs)
+	}
+}
@@ -1,5 +1,7 @@
 package initramfs
 
+import "strings"
+
 // Current practise is to align Intel x86 kernel microcode update data to a 16
 // byte boundary, although this may only be necessary for older kernel versions.
 //
@@ -16,3 +18,56 @@ const (
 	MicrocodePath_AuthenticAMD = "kernel/x86/microcode/AuthenticAMD.bin"
 	MicrocodePath_GenuineIntel = "kernel/x86/microcode/GenuineIntel.bin"
 )
+
+// Write the AMD and Intel x86 microcode update data to an early initramfs at
+// [MicrocodePath_AuthenticAMD] and [MicrocodePath_GenuineIntel] respectively,
+// with the Intel data aligned to [MicrocodeDataAlignment]. The data of each
+// vendor is typically the concatenation of every update file for that vendor.
+//
+// A vendor whose data is nil is skipped. The parent directories are created as
+// needed, and the trailer is not written.
+func WriteMicrocode(iw *Writer, amd, intel []byte) error {
+	if amd != nil {
+		if err := iw.WriteFile(MicrocodePath_AuthenticAMD, 0o644, amd); err != nil {
+			return err
+		}
+	}
+
+	if intel != nil {
+		if err := iw.SetDataAlignment(MicrocodeDataAlignment); err != nil {
+			return err
+		}
+
+		if err := iw.WriteFile(MicrocodePath_GenuineIntel, 0o644, intel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The Linux kernel can load ACPI table overrides and additional SSDTs from an
+// initramfs, when built with CONFIG_ACPI_TABLE_UPGRADE. Like microcode, the
+// tables must appear in the uncompressed early part of the image. See
+// [Upgrading ACPI tables via initrd].
+//
+// [Upgrading ACPI tables via initrd]: https://www.kernel.org/doc/html/latest/admin-guide/acpi/initrd_table_override.html
+const ACPIOverridePath = "kernel/firmware/acpi/"
+
+// Write an ACPI table (such as "DSDT.aml" or "SSDT1.aml") as a regular file at
+// [ACPIOverridePath]/name, creating the parent directories as needed.
+//
+// Returns [ErrUnsafePath] if name is not a single path element, and
+// [ErrAlreadyCompressed] if compression is being applied, as the kernel only
+// looks for tables in the uncompressed early part of the image.
+func (iw *Writer) WriteACPITable(name string, data []byte) error {
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return ErrUnsafePath
+	}
+
+	if iw.compressed {
+		return ErrAlreadyCompressed
+	}
+
+	return iw.WriteFile(ACPIOverridePath+name, 0o644, data)
+}
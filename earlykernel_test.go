@@ -0,0 +1,107 @@
+package initramfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestWriteMicrocode(t *testing.T) {
+	var (
+		amd   = []byte("amd microcode")
+		intel = []byte("intel microcode")
+	)
+
+	for _, tc := range []struct {
+		amd, intel []byte
+		expect     []string
+	}{
+		{amd, intel, []string{".", "kernel", "kernel/x86", "kernel/x86/microcode", MicrocodePath_AuthenticAMD, MicrocodePath_GenuineIntel, TrailerFilename}},
+		{nil, intel, []string{".", "kernel", "kernel/x86", "kernel/x86/microcode", MicrocodePath_GenuineIntel, TrailerFilename}},
+		{amd, nil, []string{".", "kernel", "kernel/x86", "kernel/x86/microcode", MicrocodePath_AuthenticAMD, TrailerFilename}},
+	} {
+		w, r := testWriterReader(t)
+
+		if err := WriteMicrocode(w, tc.amd, tc.intel); err != nil {
+			t.Fatalf("WriteMicrocode: %s", err)
+		}
+
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+
+		var names []string
+		for _, hdr := range r.All() {
+			names = append(names, hdr.Filename)
+
+			var expect []byte
+			switch hdr.Filename {
+			case MicrocodePath_AuthenticAMD:
+				expect = amd
+			case MicrocodePath_GenuineIntel:
+				expect = intel
+
+				if hdr.DataOffset%MicrocodeDataAlignment != 0 {
+					t.Errorf("Intel microcode data offset %d is not aligned", hdr.DataOffset)
+				}
+			default:
+				continue
+			}
+
+			if data, err := io.ReadAll(r); err != nil || !bytes.Equal(data, expect) {
+				t.Errorf("%s: unexpected data %q (%v)", hdr.Filename, data, err)
+			}
+		}
+
+		if len(names) != len(tc.expect) {
+			t.Fatalf("expected %q, got %q", tc.expect, names)
+		}
+		for i := range names {
+			if names[i] != tc.expect[i] {
+				t.Errorf("entry %d: expected %q, got %q", i, tc.expect[i], names[i])
+			}
+		}
+	}
+}
+
+func TestWriter_WriteACPITable(t *testing.T) {
+	var table = []byte("DSDT table data")
+
+	w, r := testWriterReader(t)
+
+	for _, name := range []string{"", "..", "x/DSDT.aml"} {
+		if err := w.WriteACPITable(name, table); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("WriteACPITable %q: expected ErrUnsafePath, got %v", name, err)
+		}
+	}
+
+	if err := w.WriteACPITable("DSDT.aml", table); err != nil {
+		t.Fatalf("WriteACPITable: %s", err)
+	}
+
+	if err := w.StartCompression(GzipWriter); err != nil {
+		t.Fatalf("StartCompression: %s", err)
+	}
+
+	if err := w.WriteACPITable("SSDT1.aml", table); !errors.Is(err, ErrAlreadyCompressed) {
+		t.Errorf("WriteACPITable while compressing: expected ErrAlreadyCompressed, got %v", err)
+	}
+
+	if err := w.EndCompression(); err != nil {
+		t.Fatalf("EndCompression: %s", err)
+	}
+
+	for _, name := range []string{".", "kernel", "kernel/firmware", "kernel/firmware/acpi"} {
+		testNextNamed(t, r, name)
+	}
+
+	var hdr = testNextNamed(t, r, ACPIOverridePath+"DSDT.aml")
+	if !hdr.Mode.File() {
+		t.Errorf("expected a regular file, got %s", hdr.Mode)
+	}
+
+	if data, err := io.ReadAll(r); err != nil || !bytes.Equal(data, table) {
+		t.Errorf("unexpected data %q (%v)", data, err)
+	}
+}
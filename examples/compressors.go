@@ -3,22 +3,16 @@ package examples
 import (
 	"io"
 
-	"github.com/klauspost/compress/zstd"
-	"github.com/ulikunitz/xz"
-
-	"go.pdmccormick.com/initramfs"
+	"go.pdmccormick.com/initramfs/compressors"
 )
 
-// An Xz [go.pdmccormick.com/initramfs.CompressReader] using the [github.com/ulikunitz/xz] package.
-func XzReader(r io.Reader) (io.Reader, error) { return xz.NewReader(r) }
-
-// An Zstd [go.pdmccormick.com/initramfs.CompressReader] using the [github.com/klauspost/compress/zstd]
-func ZstdReader(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) }
+// An Xz [go.pdmccormick.com/initramfs.CompressReader], see [compressors.XzReader].
+func XzReader(r io.Reader) (io.Reader, error) { return compressors.XzReader(r) }
 
-// Adds [XzReader] and [ZstdReader] to the global [go.pdmccormick.com/initramfs.CompressReaders] map.
-func SetupCompressReaders() {
-	var crs = initramfs.CompressReaders
+// An Zstd [go.pdmccormick.com/initramfs.CompressReader], see [compressors.ZstdReader].
+func ZstdReader(r io.Reader) (io.Reader, error) { return compressors.ZstdReader(r) }
 
-	crs[initramfs.Xz] = XzReader
-	crs[initramfs.Zstd] = ZstdReader
-}
+// Adds every compression reader and writer in
+// [go.pdmccormick.com/initramfs/compressors] to the global maps, see
+// [compressors.RegisterAll].
+func SetupCompressReaders() { compressors.RegisterAll() }
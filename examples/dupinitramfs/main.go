@@ -107,8 +107,16 @@ func (dup *Dup) Process(r io.Reader) error {
 
 	defer dup.Close()
 
-	for i := 0; ; i++ {
-		w, err := dup.openOutput(i)
+	for seg, err := range ir.Segments() {
+		if err != nil {
+			return err
+		}
+
+		if seg.Compression != initramfs.UnknownLookahead {
+			log.Printf("Found %s compressed stream", seg.Compression)
+		}
+
+		w, err := dup.openOutput(seg.Index)
 		if err != nil {
 			return err
 		}
@@ -117,33 +125,20 @@ func (dup *Dup) Process(r io.Reader) error {
 
 		defer iw.Close()
 
-		if err := copyInitramfs(ir, iw); err != nil {
+		if err := copyInitramfs(ir, seg, iw); err != nil {
 			return err
 		}
 
 		if err := iw.WriteTrailer(); err != nil {
 			return fmt.Errorf("WriteTrailer: %w", err)
 		}
-
-		isCompressed, compressType, err := ir.ContinueCompressed(nil)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-
-			return fmt.Errorf("ContinueCompressed: %w", err)
-		}
-
-		if isCompressed {
-			log.Printf("Found %s compressed stream", compressType)
-		}
 	}
 
 	return nil
 }
 
-func copyInitramfs(r *initramfs.Reader, w *initramfs.Writer) error {
-	for _, hdr := range r.All() {
+func copyInitramfs(r *initramfs.Reader, seg initramfs.Segment, w *initramfs.Writer) error {
+	for hdr := range seg.Headers {
 		if hdr.Trailer() {
 			break
 		}
@@ -66,62 +66,47 @@ func main() {
 }
 
 func writeEarly(iw *initramfs.Writer, amdGlob, intelGlob string) error {
-	var files = []struct {
-		SrcPattern string
-		Dst        string
-		Alignment  int
-	}{
-		{amdGlob, initramfs.MicrocodePath_AuthenticAMD, 0},
-		{intelGlob, initramfs.MicrocodePath_GenuineIntel, initramfs.MicrocodeDataAlignment},
+	amd, err := concatenateVendor(amdGlob, initramfs.MicrocodePath_AuthenticAMD)
+	if err != nil {
+		return err
 	}
 
-	for _, file := range files {
-		if file.SrcPattern == "" {
-			continue
-		}
+	intel, err := concatenateVendor(intelGlob, initramfs.MicrocodePath_GenuineIntel)
+	if err != nil {
+		return err
+	}
 
-		var data = new(bytes.Buffer)
-		matches, err := concatenateAll(file.SrcPattern, data)
-		if err != nil {
-			return err
-		}
+	if err := initramfs.WriteMicrocode(iw, amd, intel); err != nil {
+		return fmt.Errorf("WriteMicrocode: %w", err)
+	}
 
-		if len(matches) == 0 {
-			log.Printf("No files matching %s found, skipping %s", file.SrcPattern, file.Dst)
-			continue
-		}
+	if err := iw.WriteTrailer(); err != nil {
+		return err
+	}
 
-		log.Printf("Concatenating %d files (%d bytes total) from %s", len(matches), data.Len(), file.SrcPattern)
-
-		var (
-			mode = initramfs.Mode_File.WithPerms(0o664)
-			hdr  = initramfs.Header{
-				Filename: file.Dst,
-				Mode:     mode,
-				DataSize: uint32(data.Len()),
-			}
-		)
-
-		if alignTo := file.Alignment; alignTo > 0 {
-			if err := iw.SetDataAlignment(alignTo); err != nil {
-				return fmt.Errorf("SetDataAlignment %d: %w", alignTo, err)
-			}
-		}
+	return nil
+}
 
-		if err := iw.WriteHeader(&hdr); err != nil {
-			return fmt.Errorf("WriteHeader: %w", err)
-		}
+// Returns nil if there is no pattern or no files match it.
+func concatenateVendor(pattern, dst string) ([]byte, error) {
+	if pattern == "" {
+		return nil, nil
+	}
 
-		if _, err := iw.ReadFrom(data); err != nil {
-			return fmt.Errorf("ReadFrom: %w", err)
-		}
+	var data = new(bytes.Buffer)
+	matches, err := concatenateAll(pattern, data)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := iw.WriteTrailer(); err != nil {
-		return err
+	if len(matches) == 0 {
+		log.Printf("No files matching %s found, skipping %s", pattern, dst)
+		return nil, nil
 	}
 
-	return nil
+	log.Printf("Concatenating %d files (%d bytes total) from %s", len(matches), data.Len(), pattern)
+
+	return data.Bytes(), nil
 }
 
 func concatenateAll(pattern string, out *bytes.Buffer) (matches []string, err error) {
@@ -2,11 +2,13 @@ module go.pdmccormick.com/initramfs/examples
 
 replace go.pdmccormick.com/initramfs => ../
 
+replace go.pdmccormick.com/initramfs/compressors => ../compressors
+
 go 1.23.0
 
 require (
 	github.com/klauspost/compress v1.17.8
+	github.com/ulikunitz/xz v0.5.12
 	go.pdmccormick.com/initramfs v0.0.0-00010101000000-000000000000
+	go.pdmccormick.com/initramfs/compressors v0.0.0-00010101000000-000000000000
 )
-
-require github.com/ulikunitz/xz v0.5.12
@@ -66,6 +66,14 @@ type CompressionEntry struct {
 	Compression string `json:"Compression"`
 }
 
+// Emitted for `070702` entries, comparing the stored checksum with one computed
+// from the file data.
+type ChecksumEntry struct {
+	*initramfs.Header
+	ComputedChecksum uint32 `json:"ComputedChecksum"`
+	ChecksumMatch    bool   `json:"ChecksumMatch"`
+}
+
 func (p *Processor) start() {
 	fmt.Fprintf(p.W, "[\n")
 }
@@ -97,40 +105,73 @@ func (p *Processor) emitEntry(entry any) error {
 }
 
 func (p *Processor) Scan(r *initramfs.Reader, dumpHex bool) error {
-Loop:
-	for {
-		hdr, err := r.Next()
-		switch {
-		case err == initramfs.ErrCompressedContentAhead:
-			if compressed, typ, err := r.ContinueCompressed(nil); err != nil {
+	for seg, err := range r.Segments() {
+		if err != nil {
+			return err
+		}
+
+		if seg.Compression != initramfs.UnknownLookahead {
+			if err := p.emitEntry(CompressionEntry{Compression: seg.Compression.String()}); err != nil {
 				return err
-			} else if typ.EOF() {
-				return nil
-			} else if compressed {
-				if err := p.emitEntry(CompressionEntry{Compression: typ.String()}); err != nil {
-					return err
-				}
-				continue Loop
-			} else {
-				break Loop
 			}
-		case err == io.EOF:
-			return nil
-		case err != nil:
+		}
+
+		for hdr := range seg.Headers {
+			if err := p.scanEntry(r, &hdr, dumpHex); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *Processor) scanEntry(r *initramfs.Reader, hdr *initramfs.Header, dumpHex bool) error {
+	var head headWriter
+
+	if hdr.Magic == initramfs.Magic_070702 {
+		if dumpHex {
+			head.buf = make([]byte, 0, 512)
+		}
+
+		// Stream the data through the checksum, keeping only what is dumped
+		var sum initramfs.ChecksumWriter
+		if _, err := io.Copy(io.MultiWriter(&sum, &head), r); err != nil {
 			return err
 		}
 
+		p.emitEntry(ChecksumEntry{
+			Header:           hdr,
+			ComputedChecksum: sum.Sum32(),
+			ChecksumMatch:    sum.Sum32() == hdr.Checksum,
+		})
+	} else {
 		p.emitEntry(hdr)
 
 		if dumpHex && hdr.DataSize > 0 {
 			var data [512]byte
-			if n, err := r.Read(data[:]); err != nil {
+			n, err := r.Read(data[:])
+			if err != nil {
 				return err
-			} else if n > 0 {
-				fmt.Println("\n" + hex.Dump(data[:n]))
 			}
+			head.buf = data[:n]
 		}
 	}
 
+	if len(head.buf) > 0 {
+		fmt.Println("\n" + hex.Dump(head.buf))
+	}
+
 	return nil
 }
+
+// Keeps the first bytes written to it, up to the capacity of buf, discarding
+// the rest.
+type headWriter struct {
+	buf []byte
+}
+
+func (hw *headWriter) Write(p []byte) (int, error) {
+	hw.buf = append(hw.buf, p[:min(len(p), cap(hw.buf)-len(hw.buf))]...)
+	return len(p), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"go.pdmccormick.com/initramfs"
+)
+
+func TestProcessor_Checksums(t *testing.T) {
+	var files = []struct {
+		name     string
+		data     string
+		checksum uint32
+	}{
+		{"good.txt", "Hello World!\n", initramfs.ComputeChecksum([]byte("Hello World!\n"))},
+		{"corrupt.txt", "Hello World?\n", initramfs.ComputeChecksum([]byte("Hello World!\n"))},
+	}
+
+	var archive bytes.Buffer
+
+	iw := initramfs.NewWriter(&archive)
+	for _, file := range files {
+		var hdr = initramfs.Header{
+			Magic:    initramfs.Magic_070702,
+			Mode:     initramfs.Mode_File | 0o644,
+			DataSize: uint32(len(file.data)),
+			Checksum: file.checksum,
+			Filename: file.name,
+		}
+
+		if err := iw.WriteHeader(&hdr); err != nil {
+			t.Fatalf("WriteHeader: %s", err)
+		}
+
+		if _, err := iw.Write([]byte(file.data)); err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+	}
+
+	if err := iw.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var (
+		out  bytes.Buffer
+		proc = Processor{W: &out}
+	)
+
+	proc.start()
+	if err := proc.Scan(initramfs.NewReader(&archive), false); err != nil {
+		t.Fatalf("Scan: %s", err)
+	}
+	proc.stop()
+
+	var entries []struct {
+		Filename         string
+		Checksum         uint32
+		ComputedChecksum *uint32
+		ChecksumMatch    *bool
+	}
+
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+		t.Fatalf("Unmarshal: %s\n%s", err, out.String())
+	}
+
+	var matches = map[string]bool{}
+	for _, entry := range entries {
+		if entry.ChecksumMatch != nil {
+			matches[entry.Filename] = *entry.ChecksumMatch
+		}
+	}
+
+	if match, ok := matches["good.txt"]; !ok || !match {
+		t.Errorf("expected good.txt to match, got %v (present %v)", match, ok)
+	}
+
+	if match, ok := matches["corrupt.txt"]; !ok || match {
+		t.Errorf("expected corrupt.txt to mismatch, got %v (present %v)", match, ok)
+	}
+}
@@ -46,9 +46,16 @@ func main() {
 }
 
 func list(out io.Writer, r *initramfs.Reader) error {
-Loop:
-	for {
-		for _, hdr := range r.All() {
+	for seg, err := range r.Segments() {
+		if err != nil {
+			return err
+		}
+
+		if seg.Compression != initramfs.UnknownLookahead && !*hideCompressFlag {
+			fmt.Fprintf(out, "# compression %s\n\n", seg.Compression)
+		}
+
+		for hdr := range seg.Headers {
 			if hdr.Trailer() && *hideTrailerFlag {
 				continue
 			}
@@ -56,9 +63,9 @@ Loop:
 			var suffix string
 
 			if hdr.Mode.Symlink() {
-				data, err := io.ReadAll(r)
+				target, err := r.ReadSymlinkTarget()
 				if err == nil {
-					suffix = fmt.Sprintf(" -> %s", string(data))
+					suffix = fmt.Sprintf(" -> %s", target)
 				}
 			}
 
@@ -68,20 +75,7 @@ Loop:
 				fmt.Fprintf(out, "\n")
 			}
 		}
-
-		if compressed, typ, err := r.ContinueCompressed(nil); err != nil {
-			if err == io.EOF {
-				return nil
-			}
-			return err
-		} else if compressed {
-			if !*hideCompressFlag {
-				fmt.Printf("# compression %s\n\n", typ.String())
-			}
-			continue Loop
-		} else {
-			break Loop
-		}
 	}
+
 	return nil
 }
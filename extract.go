@@ -0,0 +1,270 @@
+package initramfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Options for [ExtractWithOptions].
+type ExtractOptions struct {
+	// When extracting without sufficient privileges, creating device nodes and
+	// changing file ownership will fail. If set, such failures are recorded in
+	// Skipped rather than stopping the extraction.
+	TolerateUnprivileged bool
+
+	// If set, device nodes are not created, and each is instead recorded in
+	// Skipped with [ErrDeviceSkipped]. FIFOs and sockets are still created.
+	SkipDevices bool
+
+	// If set, the ownership of each extracted entry is given by this function
+	// of the uid and gid in its header. When extracting as a non-root user,
+	// this may map everything to the current user, for example.
+	UidGidMap func(uid, gid uint32) (uint32, uint32)
+
+	// The errors that were tolerated because of TolerateUnprivileged, or
+	// devices skipped because of SkipDevices.
+	Skipped []error
+}
+
+var ErrDeviceSkipped = errors.New("initramfs: device node skipped")
+
+// Extract every entry of the archive into dir. See [ExtractWithOptions].
+func Extract(r *Reader, dir string) error { return ExtractWithOptions(r, dir, nil) }
+
+// Extract every entry of the archive, including any compressed segments, into
+// dir, recreating regular files, directories, symlinks, FIFOs, sockets and
+// device nodes, and applying the mode, modification time and ownership from
+// each header. Leading slashes in filenames are ignored, as they are by the
+// kernel.
+//
+// Returns [ErrUnsafePath] for any entry whose filename contains a ".."
+// component, or whose parent directory within dir is a symlink, as either
+// could be used to write outside of dir.
+//
+// As with the kernel, hard linked regular files (see [Header.HardLinked]) that
+// share an Inode, Major and Minor with an earlier entry since the last trailer
+// are recreated as hard links to it, and any file data is written to the shared
+// file. This supports both the data being stored with the first link, and the
+// classic cpio convention of storing it only with the last.
+func ExtractWithOptions(r *Reader, dir string, opts *ExtractOptions) error {
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+
+	var x = extractor{
+		r:     r,
+		root:  dir,
+		opts:  opts,
+		links: make(map[hardLinkKey]string),
+	}
+
+	if err := r.walk(x.extract); err != nil {
+		return err
+	}
+
+	// Apply directory metadata last, deepest first, so that adding entries to
+	// a directory does not disturb its modification time or permissions
+	slices.Reverse(x.dirs)
+
+	for _, d := range x.dirs {
+		if err := x.applyMetadata(d.path, &d.hdr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type extractor struct {
+	r     *Reader
+	root  string
+	opts  *ExtractOptions
+	dirs  []extractedDir
+	links map[hardLinkKey]string // Path of the first extracted hard link
+}
+
+type extractedDir struct {
+	path string
+	hdr  Header
+}
+
+func (x *extractor) extract(hdr *Header) error {
+	if hdr.Trailer() {
+		clear(x.links)
+		return nil
+	}
+
+	target, err := x.safePath(hdr)
+	if err != nil {
+		return &fs.PathError{Op: "extract", Path: hdr.Filename, Err: err}
+	}
+
+	if !hdr.Mode.Dir() {
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+
+		// Never write through an existing symlink
+		if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	switch mode := hdr.Mode; {
+	case mode.Dir():
+		if fi, err := os.Lstat(target); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+		}
+
+		if err := os.MkdirAll(target, 0o700); err != nil {
+			return err
+		}
+
+		x.dirs = append(x.dirs, extractedDir{target, *hdr})
+		return nil
+
+	case mode.File():
+		var flag = os.O_CREATE | os.O_EXCL | os.O_WRONLY
+
+		if hdr.HardLinked() {
+			var key = hdr.hardLinkKey()
+
+			if first, ok := x.links[key]; ok {
+				if err := os.Link(first, target); err != nil {
+					return err
+				}
+				flag = os.O_WRONLY
+			} else {
+				x.links[key] = target
+			}
+		}
+
+		f, err := os.OpenFile(target, flag, 0o600)
+		if err != nil {
+			return err
+		}
+
+		if hdr.DataSize > 0 {
+			_, err = io.Copy(f, x.r)
+		}
+
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+
+		if err != nil {
+			return err
+		}
+
+	case mode.Symlink():
+		linkTarget, err := x.r.ReadSymlinkTarget()
+		if err != nil {
+			return err
+		}
+
+		if err := os.Symlink(linkTarget, target); err != nil {
+			return err
+		}
+
+	case mode.FIFO(), mode.Socket(), mode.CharDevice(), mode.BlockDevice():
+		if x.opts.SkipDevices && (mode.CharDevice() || mode.BlockDevice()) {
+			x.opts.Skipped = append(x.opts.Skipped, &fs.PathError{Op: "extract", Path: hdr.Filename, Err: ErrDeviceSkipped})
+			return nil
+		}
+
+		if err := mknod(target, hdr); err != nil {
+			return x.tolerate(err)
+		}
+
+	default:
+		return &fs.PathError{Op: "extract", Path: hdr.Filename, Err: ErrUnsupportedFileType}
+	}
+
+	return x.applyMetadata(target, hdr)
+}
+
+// Resolve the header to a path within the root (see [Header.SafePath]),
+// additionally rejecting any parent directory that is a symlink.
+func (x *extractor) safePath(hdr *Header) (string, error) {
+	target, err := hdr.SafePath(x.root)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(x.root, target)
+	if err != nil {
+		return "", err
+	}
+
+	var parent = x.root
+
+	for _, elem := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if elem == "." {
+			continue
+		}
+
+		parent = filepath.Join(parent, elem)
+
+		fi, err := os.Lstat(parent)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		} else if err != nil {
+			return "", err
+		}
+
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			return "", ErrUnsafePath
+		}
+	}
+
+	return target, nil
+}
+
+func (x *extractor) applyMetadata(target string, hdr *Header) error {
+	var uid, gid = hdr.Uid, hdr.Gid
+	if x.opts.UidGidMap != nil {
+		uid, gid = x.opts.UidGidMap(uid, gid)
+	}
+
+	if err := os.Lchown(target, int(uid), int(gid)); err != nil {
+		if err := x.tolerate(err); err != nil {
+			return err
+		}
+	}
+
+	if hdr.Mode.Symlink() {
+		return nil
+	}
+
+	const chmodBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+	if err := os.Chmod(target, hdr.Mode.FileMode()&chmodBits); err != nil {
+		return err
+	}
+
+	if hdr.Mode.Dir() || hdr.Mode.File() {
+		if err := os.Chtimes(target, time.Time{}, hdr.Mtime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Record the error and continue if it is due to a lack of privileges and the
+// options allow for this.
+func (x *extractor) tolerate(err error) error {
+	if x.opts.TolerateUnprivileged && errors.Is(err, fs.ErrPermission) {
+		x.opts.Skipped = append(x.opts.Skipped, err)
+		return nil
+	}
+	return err
+}
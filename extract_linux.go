@@ -0,0 +1,17 @@
+package initramfs
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// Create a FIFO, socket or device node.
+func mknod(path string, hdr *Header) error {
+	var dev = Makedev(hdr.RMajor, hdr.RMinor)
+
+	if err := syscall.Mknod(path, uint32(hdr.Mode.FileType())|0o600, int(dev)); err != nil {
+		return &fs.PathError{Op: "mknod", Path: path, Err: err}
+	}
+
+	return nil
+}
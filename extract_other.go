@@ -0,0 +1,13 @@
+//go:build !linux
+
+package initramfs
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// Creating FIFOs, sockets and device nodes is only supported on Linux.
+func mknod(path string, hdr *Header) error {
+	return &fs.PathError{Op: "mknod", Path: path, Err: errors.ErrUnsupported}
+}
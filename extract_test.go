@@ -0,0 +1,282 @@
+package initramfs
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestExtract(t *testing.T) {
+	var (
+		b     bytes.Buffer
+		w     = NewWriter(&b)
+		mtime = time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+		uid   = uint32(os.Getuid())
+		gid   = uint32(os.Getgid())
+	)
+
+	testMkdirHeader(t, w, "/etc", &Header{Mode: Mode_Dir | 0o750, Mtime: mtime, Uid: uid, Gid: gid})
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o640, Mtime: mtime, Uid: uid, Gid: gid, DataSize: 10, Filename: "/etc/hostname"})
+	w.Write([]byte("initramfs\n"))
+	testWriteHeader(t, w, &Header{Mode: Mode_Symlink | 0o777, Uid: uid, Gid: gid, DataSize: 8, Filename: "/etc/name"})
+	w.Write([]byte("hostname"))
+	testWriteHeader(t, w, &Header{Mode: Mode_FIFO | 0o600, Uid: uid, Gid: gid, Filename: "/run/fifo"})
+	testWriteHeader(t, w, &Header{Mode: Mode_CharDevice | 0o666, Uid: uid, Gid: gid, RMajor: 1, RMinor: 3, Filename: "/dev/null"})
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var (
+		dir  = t.TempDir()
+		opts = ExtractOptions{TolerateUnprivileged: true}
+	)
+
+	if err := ExtractWithOptions(NewReader(&b), dir, &opts); err != nil {
+		if runtime.GOOS != "linux" && errors.Is(err, errors.ErrUnsupported) {
+			t.Skipf("Extract: %s", err)
+		}
+		t.Fatalf("Extract: %s", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "etc/hostname"))
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	} else if string(data) != "initramfs\n" {
+		t.Errorf("expected hostname data, got %q", data)
+	}
+
+	var testcases = []struct {
+		name  string
+		mode  fs.FileMode
+		mtime bool
+	}{
+		{"etc", fs.ModeDir | 0o750, true},
+		{"etc/hostname", 0o640, true},
+		{"etc/name", fs.ModeSymlink, false},
+		{"run/fifo", fs.ModeNamedPipe | 0o600, false},
+	}
+
+	for _, tc := range testcases {
+		fi, err := os.Lstat(filepath.Join(dir, tc.name))
+		if err != nil {
+			t.Errorf("Lstat: %s", err)
+			continue
+		}
+
+		if tc.mode.Type() == fs.ModeSymlink {
+			if fi.Mode().Type() != fs.ModeSymlink {
+				t.Errorf("%s: expected symlink, got %s", tc.name, fi.Mode())
+			}
+		} else if fi.Mode() != tc.mode {
+			t.Errorf("%s: expected mode %s, got %s", tc.name, tc.mode, fi.Mode())
+		}
+
+		if tc.mtime && !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s: expected mtime %s, got %s", tc.name, mtime, fi.ModTime())
+		}
+	}
+
+	if target, err := os.Readlink(filepath.Join(dir, "etc/name")); err != nil {
+		t.Errorf("Readlink: %s", err)
+	} else if target != "hostname" {
+		t.Errorf("expected symlink target hostname, got %s", target)
+	}
+
+	if fi, err := os.Lstat(filepath.Join(dir, "dev/null")); err == nil {
+		if fi.Mode().Type() != fs.ModeDevice|fs.ModeCharDevice {
+			t.Errorf("dev/null: expected char device, got %s", fi.Mode())
+		}
+	} else if len(opts.Skipped) == 0 {
+		t.Errorf("dev/null: expected node or skipped error, got %s", err)
+	}
+}
+
+func TestExtract_UnsafePath(t *testing.T) {
+	t.Run("dotdot", func(t *testing.T) {
+		var (
+			b bytes.Buffer
+			w = NewWriter(&b)
+		)
+
+		if err := w.writeHeader(&Header{Mode: Mode_File | 0o644, Filename: "a/../../evil"}); err != nil {
+			t.Fatalf("writeHeader: %s", err)
+		}
+
+		var dir = t.TempDir()
+		if err := Extract(NewReader(&b), filepath.Join(dir, "root")); !errors.Is(err, ErrUnsafePath) {
+			t.Fatalf("expected ErrUnsafePath, got %v", err)
+		}
+
+		if _, err := os.Lstat(filepath.Join(dir, "evil")); err == nil {
+			t.Fatal("file was written outside of the root")
+		}
+	})
+
+	t.Run("symlink parent", func(t *testing.T) {
+		var (
+			b       bytes.Buffer
+			w       = NewWriter(&b)
+			outside = t.TempDir()
+		)
+
+		testWriteHeader(t, w, &Header{Mode: Mode_Symlink | 0o777, DataSize: uint32(len(outside)), Filename: "link"})
+		w.Write([]byte(outside))
+		if err := w.writeHeader(&Header{Mode: Mode_File | 0o644, Filename: "link/evil"}); err != nil {
+			t.Fatalf("writeHeader: %s", err)
+		}
+
+		if err := Extract(NewReader(&b), t.TempDir()); !errors.Is(err, ErrUnsafePath) {
+			t.Fatalf("expected ErrUnsafePath, got %v", err)
+		}
+
+		if _, err := os.Lstat(filepath.Join(outside, "evil")); err == nil {
+			t.Fatal("file was written through a symlink")
+		}
+	})
+}
+
+func TestExtract_UidGidMap(t *testing.T) {
+	var (
+		b   bytes.Buffer
+		w   = NewWriter(&b)
+		uid = uint32(os.Getuid())
+		gid = uint32(os.Getgid())
+	)
+
+	testMkdirHeader(t, w, "/etc", &Header{Mode: Mode_Dir | 0o755, Uid: 1234, Gid: 5678})
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Uid: 1234, Gid: 5678, Filename: "/etc/hostname"})
+	testWriteHeader(t, w, &Header{Mode: Mode_CharDevice | 0o666, RMajor: 1, RMinor: 3, Filename: "/dev/null"})
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var (
+		dir    = t.TempDir()
+		mapped [][2]uint32
+		opts   = ExtractOptions{
+			SkipDevices: true,
+			UidGidMap: func(u, g uint32) (uint32, uint32) {
+				mapped = append(mapped, [2]uint32{u, g})
+				return uid, gid
+			},
+		}
+	)
+
+	if err := ExtractWithOptions(NewReader(&b), dir, &opts); err != nil {
+		if runtime.GOOS != "linux" && errors.Is(err, errors.ErrUnsupported) {
+			t.Skipf("Extract: %s", err)
+		}
+		t.Fatalf("Extract: %s", err)
+	}
+
+	if len(opts.Skipped) != 1 || !errors.Is(opts.Skipped[0], ErrDeviceSkipped) {
+		t.Errorf("expected dev/null to be skipped, got %v", opts.Skipped)
+	}
+
+	if _, err := os.Lstat(filepath.Join(dir, "dev/null")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected dev/null to not exist, got %v", err)
+	}
+
+	var sawOriginal bool
+	for _, ids := range mapped {
+		if ids == [2]uint32{1234, 5678} {
+			sawOriginal = true
+		}
+	}
+	if !sawOriginal {
+		t.Errorf("expected mapping to be called with original ids, got %v", mapped)
+	}
+
+	for _, name := range []string{"etc", "etc/hostname"} {
+		fi, err := os.Lstat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Lstat: %s", err)
+		}
+
+		hdr, err := NewHeaderFromFileInfo(name, fi)
+		if err != nil {
+			t.Fatalf("NewHeaderFromFileInfo: %s", err)
+		}
+
+		if runtime.GOOS == "linux" && (hdr.Uid != uid || hdr.Gid != gid) {
+			t.Errorf("%s: expected owner %d:%d, got %d:%d", name, uid, gid, hdr.Uid, hdr.Gid)
+		}
+	}
+}
+
+func TestExtract_HardLinks(t *testing.T) {
+	var testcases = []struct {
+		name  string
+		sizes [3]uint32 // Of links a, b and c
+	}{
+		{"data-first", [3]uint32{5, 0, 0}},
+		{"data-last", [3]uint32{0, 0, 5}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				b   bytes.Buffer
+				w   = NewWriter(&b)
+				uid = uint32(os.Getuid())
+				gid = uint32(os.Getgid())
+			)
+
+			for i, name := range []string{"a", "b", "c"} {
+				testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Uid: uid, Gid: gid, Inode: 42, NumLinks: 3, DataSize: tc.sizes[i], Filename: name})
+				if tc.sizes[i] > 0 {
+					w.Write([]byte("hello"))
+				}
+			}
+			// An unrelated file sharing the inode number after a trailer
+			if err := w.WriteTrailer(); err != nil {
+				t.Fatalf("WriteTrailer: %s", err)
+			}
+			testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Uid: uid, Gid: gid, Inode: 42, NumLinks: 2, DataSize: 5, Filename: "d"})
+			w.Write([]byte("other"))
+			if err := w.WriteTrailer(); err != nil {
+				t.Fatalf("WriteTrailer: %s", err)
+			}
+
+			var dir = t.TempDir()
+
+			if err := ExtractWithOptions(NewReader(&b), dir, &ExtractOptions{TolerateUnprivileged: true}); err != nil {
+				if runtime.GOOS != "linux" && errors.Is(err, errors.ErrUnsupported) {
+					t.Skipf("Extract: %s", err)
+				}
+				t.Fatalf("Extract: %s", err)
+			}
+
+			first, err := os.Stat(filepath.Join(dir, "a"))
+			if err != nil {
+				t.Fatalf("Stat: %s", err)
+			}
+
+			for _, name := range []string{"a", "b", "c"} {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatalf("ReadFile: %s", err)
+				} else if string(data) != "hello" {
+					t.Errorf("%s: expected %q, got %q", name, "hello", data)
+				}
+
+				if fi, err := os.Stat(filepath.Join(dir, name)); err != nil {
+					t.Fatalf("Stat: %s", err)
+				} else if !os.SameFile(first, fi) {
+					t.Errorf("%s: expected a hard link to a", name)
+				}
+			}
+
+			if fi, err := os.Stat(filepath.Join(dir, "d")); err != nil {
+				t.Fatalf("Stat: %s", err)
+			} else if os.SameFile(first, fi) {
+				t.Errorf("d: expected a separate file after the trailer")
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package initramfs
+
+import "io/fs"
+
+// Create a header describing the file, as returned by [os.Stat] or
+// [os.Lstat], to be added to an archive under the given name.
+//
+// The Filename, Mode, Mtime and (for regular files) DataSize fields are
+// populated from fi. Where supported by the platform, such as when fi.Sys()
+// is a [syscall.Stat_t] on Linux, the Uid, Gid, NumLinks, Inode, Major,
+// Minor, RMajor and RMinor fields are populated as well.
+//
+// For symlinks, DataSize is left as 0 and it is the responsibility of the
+// caller to set it to the length of the link target, which must then be
+// written as the file data.
+//
+// Returns [ErrFileTooLarge] if a regular file exceeds [MaxDataSize].
+func NewHeaderFromFileInfo(name string, fi fs.FileInfo) (*Header, error) {
+	var hdr = Header{
+		Filename: name,
+		Mode:     ModeFromFileMode(fi.Mode()),
+		Mtime:    fi.ModTime(),
+	}
+
+	if hdr.Mode.File() {
+		if err := hdr.SetDataSize(fi.Size()); err != nil {
+			return nil, err
+		}
+	}
+
+	if sys := fi.Sys(); sys != nil {
+		fillHeaderFromSys(&hdr, sys)
+	}
+
+	return &hdr, nil
+}
@@ -0,0 +1,17 @@
+package initramfs
+
+import "syscall"
+
+func fillHeaderFromSys(hdr *Header, sys any) {
+	st, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+
+	hdr.Inode = uint32(st.Ino)
+	hdr.Uid = st.Uid
+	hdr.Gid = st.Gid
+	hdr.NumLinks = uint32(st.Nlink)
+	hdr.Major, hdr.Minor = SplitDev(uint64(st.Dev))
+	hdr.RMajor, hdr.RMinor = SplitDev(uint64(st.Rdev))
+}
@@ -0,0 +1,5 @@
+//go:build !linux
+
+package initramfs
+
+func fillHeaderFromSys(hdr *Header, sys any) {}
@@ -0,0 +1,76 @@
+package initramfs
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestNewHeaderFromFileInfo(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		name = filepath.Join(dir, "hello.txt")
+	)
+
+	if err := os.WriteFile(name, []byte("Hello World!\n"), 0o640); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	if err := os.Symlink("hello.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatalf("Symlink: %s", err)
+	}
+
+	var testcases = []struct {
+		name     string
+		fileType Mode
+		perms    int
+		dataSize uint32
+	}{
+		{"hello.txt", Mode_File, 0o640, 13},
+		{"link", Mode_Symlink, -1, 0},
+		{".", Mode_Dir, -1, 0},
+	}
+
+	for _, tc := range testcases {
+		fi, err := os.Lstat(filepath.Join(dir, tc.name))
+		if err != nil {
+			t.Fatalf("Lstat: %s", err)
+		}
+
+		hdr, err := NewHeaderFromFileInfo(tc.name, fi)
+		if err != nil {
+			t.Fatalf("NewHeaderFromFileInfo %s: %s", tc.name, err)
+		}
+
+		if hdr.Filename != tc.name {
+			t.Errorf("%s: expected filename %s, got %s", tc.name, tc.name, hdr.Filename)
+		}
+
+		if got := hdr.Mode.FileType(); got != tc.fileType {
+			t.Errorf("%s: expected file type %#o, got %#o", tc.name, uint32(tc.fileType), uint32(got))
+		}
+
+		if tc.perms >= 0 && hdr.Mode.Perms() != tc.perms {
+			t.Errorf("%s: expected perms %#o, got %#o", tc.name, tc.perms, hdr.Mode.Perms())
+		}
+
+		if hdr.DataSize != tc.dataSize {
+			t.Errorf("%s: expected data size %d, got %d", tc.name, tc.dataSize, hdr.DataSize)
+		}
+
+		if !hdr.Mtime.Equal(fi.ModTime()) {
+			t.Errorf("%s: expected mtime %s, got %s", tc.name, fi.ModTime(), hdr.Mtime)
+		}
+
+		if runtime.GOOS == "linux" {
+			if hdr.Uid != uint32(os.Getuid()) || hdr.Gid != uint32(os.Getgid()) {
+				t.Errorf("%s: expected owner %d:%d, got %d:%d", tc.name, os.Getuid(), os.Getgid(), hdr.Uid, hdr.Gid)
+			}
+
+			if hdr.Inode == 0 || hdr.NumLinks == 0 {
+				t.Errorf("%s: expected inode and link count, got %d and %d", tc.name, hdr.Inode, hdr.NumLinks)
+			}
+		}
+	}
+}
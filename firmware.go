@@ -0,0 +1,48 @@
+package initramfs
+
+import (
+	"io"
+	"io/fs"
+	"path"
+)
+
+// The directory from which the Linux kernel's firmware loader reads firmware
+// files, such as when drivers are probed from within the initramfs.
+const FirmwarePath = "lib/firmware/"
+
+// The permissions of any directories created for firmware files, so that they
+// remain readable regardless of the writer's default (see [WithDefaultDirPerm]).
+const FirmwareDirPerm Mode = 0o755
+
+// Write a firmware file at [FirmwarePath]/relPath, with exactly size bytes of
+// contents read from r (see [Writer.WriteFileReader]). Any intermediate
+// directories that do not yet exist are created with [FirmwareDirPerm].
+//
+// Returns [ErrUnsafePath] if relPath is not a valid, relative, slash separated
+// path (see [io/fs.ValidPath]).
+func (iw *Writer) WriteFirmware(relPath string, r io.Reader, size int64) error {
+	if !fs.ValidPath(relPath) || relPath == "." {
+		return ErrUnsafePath
+	}
+
+	if err := iw.MkdirAll(path.Dir(FirmwarePath+relPath), FirmwareDirPerm); err != nil {
+		return err
+	}
+
+	return iw.WriteFileReader(FirmwarePath+relPath, 0o644, size, r)
+}
+
+// Add the firmware tree rooted at dir within fsys beneath [FirmwarePath], as
+// per [Writer.AddFS], such that dir/vendor/blob.bin is written as
+// lib/firmware/vendor/blob.bin. [FirmwarePath] itself, and its parents, are
+// created with [FirmwareDirPerm] if they do not yet exist, while directories
+// within the tree take their permissions from fsys.
+//
+// Any error is returned as an [io/fs.PathError] naming the offending path.
+func (iw *Writer) AddFirmwareDir(fsys fs.FS, dir string) error {
+	if err := iw.MkdirAll(path.Clean(FirmwarePath), FirmwareDirPerm); err != nil {
+		return err
+	}
+
+	return iw.addFSTree("AddFirmwareDir", fsys, dir, FirmwarePath)
+}
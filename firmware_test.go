@@ -0,0 +1,80 @@
+package initramfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWriter_WriteFirmware(t *testing.T) {
+	var blob = []byte("firmware blob")
+
+	w, r := testWriterReader(t)
+
+	for _, relPath := range []string{"", ".", "../etc/passwd", "/abs.bin"} {
+		if err := w.WriteFirmware(relPath, bytes.NewReader(blob), int64(len(blob))); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("WriteFirmware %q: expected ErrUnsafePath, got %v", relPath, err)
+		}
+	}
+
+	if err := w.WriteFirmware("vendor/blob.bin", bytes.NewReader(blob), int64(len(blob))); err != nil {
+		t.Fatalf("WriteFirmware: %s", err)
+	}
+
+	for _, name := range []string{".", "lib", "lib/firmware", "lib/firmware/vendor"} {
+		if hdr := testNextNamed(t, r, name); !hdr.Mode.Dir() || hdr.Mode.Perms() != 0o755 {
+			t.Errorf("%s: expected a 0755 directory, got %s", name, hdr.Mode)
+		}
+	}
+
+	testNextNamed(t, r, FirmwarePath+"vendor/blob.bin")
+
+	if data, err := io.ReadAll(r); err != nil || !bytes.Equal(data, blob) {
+		t.Errorf("unexpected data %q (%v)", data, err)
+	}
+}
+
+func TestWriter_AddFirmwareDir(t *testing.T) {
+	var fsys = fstest.MapFS{
+		"src/firmware/vendor/a.bin": &fstest.MapFile{Data: []byte("a"), Mode: 0o644},
+		"src/firmware/b.bin":        &fstest.MapFile{Data: []byte("b"), Mode: 0o644},
+		"src/other.txt":             &fstest.MapFile{Data: []byte("other"), Mode: 0o644},
+	}
+
+	w, r := testWriterReader(t)
+
+	if err := w.AddFirmwareDir(fsys, "src/firmware"); err != nil {
+		t.Fatalf("AddFirmwareDir: %s", err)
+	}
+
+	var hdrs headerList
+	for _, hdr := range r.All() {
+		hdrs = append(hdrs, hdr)
+
+		if hdr.Mode.File() {
+			var src = "src/firmware/" + strings.TrimPrefix(hdr.Filename, FirmwarePath)
+
+			if data, err := io.ReadAll(r); err != nil || !bytes.Equal(data, fsys[src].Data) {
+				t.Errorf("%s: unexpected data %q (%v)", hdr.Filename, data, err)
+			}
+		}
+	}
+
+	hdrs.expectNames(t,
+		".",
+		"lib",
+		"lib/firmware",
+		"lib/firmware/b.bin",
+		"lib/firmware/vendor",
+		"lib/firmware/vendor/a.bin",
+	)
+
+	var pathErr *fs.PathError
+	if err := w.AddFirmwareDir(fsys, "missing"); !errors.As(err, &pathErr) {
+		t.Errorf("expected a PathError, got %v", err)
+	}
+}
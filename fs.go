@@ -0,0 +1,299 @@
+package initramfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"time"
+)
+
+// Returns an [io/fs.FileInfo] describing the header. The Name is the base name
+// of the Filename, and Sys returns the *Header itself.
+func (hdr *Header) FileInfo() fs.FileInfo { return headerFileInfo{hdr} }
+
+type headerFileInfo struct{ hdr *Header }
+
+var _ fs.FileInfo = headerFileInfo{}
+
+func (fi headerFileInfo) Name() string       { return path.Base(normalizeName(fi.hdr.Filename)) }
+func (fi headerFileInfo) Size() int64        { return int64(fi.hdr.DataSize) }
+func (fi headerFileInfo) Mode() fs.FileMode  { return fi.hdr.Mode.FileMode() }
+func (fi headerFileInfo) ModTime() time.Time { return fi.hdr.Mtime }
+func (fi headerFileInfo) IsDir() bool        { return fi.hdr.Mode.Dir() }
+func (fi headerFileInfo) Sys() any           { return fi.hdr }
+
+// The mode given to any parent directories that are not explicitly present in
+// an archive read by [NewFS].
+const SyntheticDirMode = Mode_Dir | 0o755
+
+// An [io/fs.FS] backed by the fully scanned contents of an archive. See
+// [NewFS].
+type FS struct {
+	entries map[string]*fsEntry
+}
+
+var (
+	_ fs.FS         = (*FS)(nil)
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+)
+
+type fsEntry struct {
+	hdr      Header
+	data     io.ReaderAt // Of exactly hdr.DataSize bytes, or nil if empty
+	children []string    // Base names, sorted
+}
+
+// Scan the entire archive, including any compressed segments, and buffer the
+// headers in memory to provide an [io/fs.FS].
+//
+// If the input given to [NewReader] is an [io.ReaderAt] and [io.Seeker] (such
+// as an [os.File] or [bytes.Reader]), only the offset of each file's data is
+// recorded, and the data is read from the input when the file is opened. The
+// input must therefore remain unchanged for as long as the FS is in use. The
+// data of entries within compressed segments, or from any other input, is
+// buffered in memory as it is read.
+//
+// Filenames are normalized to be relative to the root of the archive. Parent
+// directories that are not explicitly present as entries are synthesized with
+// [SyntheticDirMode]. If the same name appears more than once, the last entry
+// wins, as it would when the kernel unpacks the archive.
+func NewFS(r *Reader) (*FS, error) {
+	var fsys = FS{
+		entries: map[string]*fsEntry{
+			".": {hdr: Header{Mode: SyntheticDirMode, Filename: "."}},
+		},
+	}
+
+	err := r.walk(func(hdr *Header) error {
+		if hdr.Trailer() {
+			return nil
+		}
+
+		var entry = fsEntry{hdr: *hdr}
+		entry.hdr.Filename = normalizeName(hdr.Filename)
+
+		if hdr.DataSize > 0 {
+			data, err := r.fsData(hdr)
+			if err != nil {
+				return err
+			}
+			entry.data = data
+		}
+
+		fsys.add(&entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range fsys.entries {
+		slices.Sort(entry.children)
+	}
+
+	return &fsys, nil
+}
+
+// Returns the data of the current entry, located in the input if possible,
+// otherwise read into memory. The size in the header is not trusted for the
+// purposes of allocation.
+func (r *Reader) fsData(hdr *Header) (io.ReaderAt, error) {
+	if ra, ok := r.r.(io.ReaderAt); ok {
+		if s, ok := r.r.(io.Seeker); ok {
+			if _, base, err := r.seekBase(s); err == nil {
+				return io.NewSectionReader(ra, base+hdr.DataOffset, int64(hdr.DataSize)), nil
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if n, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	} else if n != int64(hdr.DataSize) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return bytes.NewReader(buf.Bytes()), nil
+}
+
+func (fsys *FS) add(entry *fsEntry) {
+	var name = entry.hdr.Filename
+
+	if prev, ok := fsys.entries[name]; ok {
+		entry.children = prev.children
+		fsys.entries[name] = entry
+		return
+	}
+
+	fsys.entries[name] = entry
+
+	// Link into the parent directory, synthesizing it if necessary
+	if name == "." {
+		return
+	}
+
+	var dir = path.Dir(name)
+
+	parent, ok := fsys.entries[dir]
+	if !ok {
+		parent = &fsEntry{hdr: Header{Mode: SyntheticDirMode, Filename: dir}}
+		fsys.add(parent)
+	}
+
+	parent.children = append(parent.children, path.Base(name))
+}
+
+func (fsys *FS) lookup(op, name string) (*fsEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	entry, ok := fsys.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	return entry, nil
+}
+
+// Open the named file. Symlinks are not followed, and opening one provides
+// its target as the file data.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	entry, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.hdr.Mode.Dir() {
+		return &fsDir{fsys: fsys, entry: entry}, nil
+	}
+
+	return &fsFile{entry: entry, SectionReader: entry.section()}, nil
+}
+
+// Read the named directory, returning its entries sorted by filename.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !entry.hdr.Mode.Dir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+
+	return fsys.dirEntries(entry), nil
+}
+
+// Read the named file and return its contents.
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	entry, err := fsys.lookup("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.hdr.Mode.Dir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+	}
+
+	data, err := io.ReadAll(entry.section())
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	} else if len(data) != int(entry.hdr.DataSize) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: io.ErrUnexpectedEOF}
+	}
+
+	return data, nil
+}
+
+// Returns a [io/fs.FileInfo] describing the named file. See [Header.FileInfo].
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	entry, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.hdr.FileInfo(), nil
+}
+
+func (fsys *FS) dirEntries(entry *fsEntry) []fs.DirEntry {
+	var (
+		prefix  = entry.hdr.Filename + "/"
+		entries = make([]fs.DirEntry, 0, len(entry.children))
+	)
+
+	if prefix == "./" {
+		prefix = ""
+	}
+
+	for _, name := range entry.children {
+		var child = fsys.entries[prefix+name]
+		entries = append(entries, fs.FileInfoToDirEntry(child.hdr.FileInfo()))
+	}
+
+	return entries
+}
+
+var (
+	errNotDir = errors.New("not a directory")
+	errIsDir  = errors.New("is a directory")
+)
+
+// Returns a new reader of the file data, independent of any other.
+func (entry *fsEntry) section() *io.SectionReader {
+	if entry.data == nil {
+		return io.NewSectionReader(bytes.NewReader(nil), 0, 0)
+	}
+	return io.NewSectionReader(entry.data, 0, int64(entry.hdr.DataSize))
+}
+
+type fsFile struct {
+	entry *fsEntry
+	*io.SectionReader
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.entry.hdr.FileInfo(), nil }
+func (f *fsFile) Close() error               { return nil }
+
+type fsDir struct {
+	fsys    *FS
+	entry   *fsEntry
+	entries []fs.DirEntry
+	offset  int
+}
+
+var _ fs.ReadDirFile = (*fsDir)(nil)
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.entry.hdr.FileInfo(), nil }
+func (d *fsDir) Close() error               { return nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.hdr.Filename, Err: errIsDir}
+}
+
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		d.entries = d.fsys.dirEntries(d.entry)
+	}
+
+	var rem = d.entries[d.offset:]
+
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rem, nil
+	}
+
+	if len(rem) == 0 {
+		return nil, io.EOF
+	}
+
+	rem = rem[:min(n, len(rem))]
+	d.offset += len(rem)
+
+	return rem, nil
+}
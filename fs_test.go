@@ -0,0 +1,138 @@
+package initramfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	var b bytes.Buffer
+
+	w := NewWriter(&b)
+	testMkdirAll(t, w, "/etc", 0o755)
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, DataSize: 10, Filename: "/etc/hostname"})
+	w.Write([]byte("initramfs\n"))
+	testWriteHeader(t, w, &Header{Mode: Mode_Symlink | 0o777, DataSize: 7, Filename: "/bin/sh"})
+	w.Write([]byte("busybox"))
+
+	// Parent directories of this file are deliberately not present
+	if err := w.writeHeader(&Header{Mode: Mode_File | 0o644, DataSize: 5, Filename: "lib/modules/e1000.ko"}); err != nil {
+		t.Fatalf("writeHeader: %s", err)
+	}
+	w.Write([]byte("\x7fELF\n"))
+
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	fsys, err := NewFS(NewReader(&b))
+	if err != nil {
+		t.Fatalf("NewFS: %s", err)
+	}
+
+	if err := fstest.TestFS(fsys, "etc/hostname", "bin/sh", "lib/modules/e1000.ko"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := fs.ReadFile(fsys, "etc/hostname")
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	} else if string(data) != "initramfs\n" {
+		t.Errorf("expected hostname data, got %q", data)
+	}
+
+	entries, err := fs.ReadDir(fsys, "lib")
+	if err != nil {
+		t.Fatalf("ReadDir: %s", err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != "modules" || !entries[0].IsDir() {
+		t.Fatalf("expected synthesized modules directory, got %v", entries)
+	}
+
+	fi, err := fs.Stat(fsys, "bin/sh")
+	if err != nil {
+		t.Fatalf("Stat: %s", err)
+	}
+
+	if fi.Mode().Type() != fs.ModeSymlink {
+		t.Errorf("expected symlink, got %s", fi.Mode())
+	}
+
+	if hdr, ok := fi.Sys().(*Header); !ok || hdr.Filename != "bin/sh" {
+		t.Errorf("expected Sys to be the header, got %v", fi.Sys())
+	}
+}
+
+func TestFS_ReaderAt(t *testing.T) {
+	var b bytes.Buffer
+
+	// Leading data before the archive, which offsets are not relative to
+	b.WriteString("junk")
+
+	w := NewWriter(&b)
+	if err := w.WriteFile("etc/hostname", 0o644, []byte("initramfs\n")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var (
+		data = b.Bytes()
+		in   = bytes.NewReader(data)
+	)
+	in.Seek(4, io.SeekStart)
+
+	fsys, err := NewFS(NewReader(in))
+	if err != nil {
+		t.Fatalf("NewFS: %s", err)
+	}
+
+	// The data is read from the input when needed, rather than buffered
+	copy(data[bytes.Index(data, []byte("initramfs\n")):], "INITRAMFS\n")
+
+	got, err := fs.ReadFile(fsys, "etc/hostname")
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	} else if string(got) != "INITRAMFS\n" {
+		t.Errorf("expected data read from the input, got %q", got)
+	}
+
+	if err := fstest.TestFS(fsys, "etc/hostname"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFS_TruncatedData(t *testing.T) {
+	var b bytes.Buffer
+
+	w := NewWriter(&b)
+	if err := w.WriteFile("big", 0o644, []byte("small")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var (
+		data = b.Bytes()
+		hdrs headerList
+	)
+	hdrs.readAll(NewReader(bytes.NewReader(data)))
+	if len(hdrs) != 3 || hdrs[1].Filename != "big" {
+		t.Fatalf("unexpected archive layout: %v", hdrs)
+	}
+
+	// Claim the largest possible size, which must not be allocated up front
+	const fileSizeOffset = 6 + 6*8
+	copy(data[hdrs[1].HeaderOffset+fileSizeOffset:], "FFFFFFFF")
+
+	if _, err := NewFS(NewReader(struct{ io.Reader }{bytes.NewReader(data)})); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package initramfs
+
+import (
+	"errors"
+	"slices"
+)
+
+var ErrUnknownHardLink = errors.New("initramfs: no prior regular file entry with that inode and NumLinks of at least 2")
+
+// A regular file that may be the target of later hard links.
+type hardLink struct {
+	hdr   Header // As first written
+	count uint32 // Number of entries written so far
+}
+
+// When enabled, any regular file entry that shares its Inode (along with Mode,
+// Major and Minor) with an earlier entry is written with a DataSize of 0, so
+// that the file data is only stored once. The kernel will create such entries
+// as hard links to the first, provided that every entry has a NumLinks of at
+// least 2 (as is the case when headers are created from [io/fs.FileInfo] with
+// [NewHeaderFromFileInfo]).
+//
+// [Writer.WriteHeader] updates the header passed to it, so callers should
+// consult DataSize afterwards to determine whether any data is to be written.
+//
+// The set of known files is forgotten after each trailer, mirroring the kernel.
+func (iw *Writer) SetCoalesceHardLinks(coalesce bool) { iw.coalesceLinks = coalesce }
+
+// Write a hard link named name to the regular file previously written with the
+// given inode number, which must have had a NumLinks of at least 2. The entry
+// copies the metadata of that file and has no data.
+//
+// Returns [ErrUnknownHardLink] if there is no such file since the last trailer.
+func (iw *Writer) WriteHardLink(name string, inode uint32) error {
+	var key = inode
+	if iw.reproducible {
+		key = iw.inodeMap[inode]
+	}
+
+	return iw.writeHardLink(name, key)
+}
+
+// Write a hard link to the regular file written with the given inode number as
+// assigned by the writer, which is not remapped again.
+func (iw *Writer) writeHardLink(name string, inode uint32) error {
+	link, ok := iw.links[inode]
+	if !ok {
+		return ErrUnknownHardLink
+	}
+
+	var hdr = link.hdr
+	hdr.Filename = name
+	hdr.DataSize = 0
+
+	iw.keepInode = true
+	defer func() { iw.keepInode = false }()
+
+	return iw.WriteHeader(&hdr)
+}
+
+// Record the header if it could be the target of later hard links, or if it is
+// itself a hard link to an earlier entry, update NumLinks and (when coalescing)
+// drop its data.
+func (iw *Writer) trackHardLink(hdr *Header) {
+	if !hdr.Mode.File() || hdr.NumLinks < 2 {
+		return
+	}
+
+	link, ok := iw.links[hdr.Inode]
+	if !ok || link.hdr.Mode != hdr.Mode || link.hdr.Major != hdr.Major || link.hdr.Minor != hdr.Minor {
+		iw.links[hdr.Inode] = &hardLink{hdr: *hdr, count: 1}
+		return
+	}
+
+	link.count++
+
+	hdr.NumLinks = max(hdr.NumLinks, link.count)
+
+	if iw.coalesceLinks {
+		hdr.DataSize = 0
+	}
+}
+
+// Reports whether the header is a regular file with more than one link, and so
+// may share its Inode and file data with other entries.
+func (hdr *Header) HardLinked() bool { return hdr.Mode.File() && hdr.NumLinks >= 2 }
+
+// Identifies the members of a group of hard linked entries, as the kernel does.
+type hardLinkKey struct {
+	inode, major, minor uint32
+}
+
+func (hdr *Header) hardLinkKey() hardLinkKey {
+	return hardLinkKey{hdr.Inode, hdr.Major, hdr.Minor}
+}
+
+// Returns the names of every group of hard linked entries (see
+// [Header.HardLinked]) read so far that share an Inode, for groups with more
+// than one member. The map is only complete once the entire archive has been
+// read. Inodes are not distinguished between segments of a concatenated
+// archive.
+//
+// Each group includes the member that carries the file data, see
+// [Reader.HardLinkDataName].
+func (r *Reader) HardLinkGroups() map[uint32][]string {
+	var groups = make(map[uint32][]string)
+
+	for inode, names := range r.links {
+		if len(names) > 1 {
+			groups[inode] = slices.Clone(names)
+		}
+	}
+
+	return groups
+}
+
+// Returns the name of the hard linked entry with the given inode that carries
+// the file data, as read so far.
+//
+// This is the last member of the group with a non-zero DataSize. The classic
+// cpio convention is to store the data only with the last link, whereas the
+// kernel (and [Writer.SetCoalesceHardLinks]) allow for it to be stored with the
+// first and every later link to be empty. Extraction code should therefore
+// create the data-carrying member as a regular file, and then every other
+// member of the group as a hard link to it.
+func (r *Reader) HardLinkDataName(inode uint32) (name string, ok bool) {
+	name, ok = r.linkData[inode]
+	return
+}
+
+func (r *Reader) trackHardLink(hdr *Header) {
+	if !hdr.HardLinked() {
+		return
+	}
+
+	r.links[hdr.Inode] = append(r.links[hdr.Inode], hdr.Filename)
+
+	if hdr.DataSize > 0 {
+		r.linkData[hdr.Inode] = hdr.Filename
+	}
+}
@@ -0,0 +1,150 @@
+package initramfs
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestWriter_CoalesceHardLinks(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	w.SetCoalesceHardLinks(true)
+
+	for _, name := range []string{"bin/busybox", "bin/sh"} {
+		var hdr = Header{
+			Mode:     Mode_File | 0o755,
+			Inode:    100,
+			NumLinks: 3,
+			DataSize: 7,
+			Filename: name,
+		}
+
+		if err := w.WriteHeader(&hdr); err != nil {
+			t.Fatalf("WriteHeader %s: %s", name, err)
+		}
+
+		if hdr.DataSize > 0 {
+			if _, err := w.Write([]byte("busybox")); err != nil {
+				t.Fatalf("Write %s: %s", name, err)
+			}
+		}
+	}
+
+	if err := w.WriteHardLink("bin/ls", 100); err != nil {
+		t.Fatalf("WriteHardLink: %s", err)
+	}
+
+	if err := w.WriteHardLink("bin/cat", 999); !errors.Is(err, ErrUnknownHardLink) {
+		t.Fatalf("expected ErrUnknownHardLink, got %v", err)
+	}
+
+	var hdrs headerList
+	for _, hdr := range r.All() {
+		hdrs = append(hdrs, hdr)
+
+		if hdr.Mode.File() {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll %s: %s", hdr.Filename, err)
+			}
+
+			var expect = ""
+			if hdr.Filename == "bin/busybox" {
+				expect = "busybox"
+			}
+			if string(data) != expect {
+				t.Errorf("%s: expected data %q, got %q", hdr.Filename, expect, data)
+			}
+		}
+	}
+
+	hdrs.expectNames(t, ".", "bin", "bin/busybox", "bin/sh", "bin/ls")
+
+	for _, hdr := range hdrs[2:] {
+		if hdr.Inode != 100 {
+			t.Errorf("%s: expected inode 100, got %d", hdr.Filename, hdr.Inode)
+		}
+		if hdr.NumLinks != 3 {
+			t.Errorf("%s: expected NumLinks 3, got %d", hdr.Filename, hdr.NumLinks)
+		}
+		if hdr.Mode != Mode_File|0o755 {
+			t.Errorf("%s: expected mode %s, got %s", hdr.Filename, Mode_File|0o755, hdr.Mode)
+		}
+	}
+}
+
+func TestWriter_WriteHardLinkAfterTrailer(t *testing.T) {
+	w, _ := testWriterReader(t)
+
+	var hdr = Header{Mode: Mode_File | 0o644, Inode: 7, NumLinks: 2, Filename: "a"}
+	if err := w.WriteHeader(&hdr); err != nil {
+		t.Fatalf("WriteHeader: %s", err)
+	}
+
+	if err := w.WriteHardLink("b", 7); err != nil {
+		t.Fatalf("WriteHardLink: %s", err)
+	}
+
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	if err := w.WriteHardLink("c", 7); !errors.Is(err, ErrUnknownHardLink) {
+		t.Fatalf("expected ErrUnknownHardLink, got %v", err)
+	}
+}
+
+func TestReader_HardLinkGroups(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	testMkdirAll(t, w, "bin", 0o755)
+
+	// Classic cpio convention, with the data stored with the last link
+	for _, name := range []string{"bin/ls", "bin/cat", "bin/busybox"} {
+		var hdr = Header{Mode: Mode_File | 0o755, Inode: 42, NumLinks: 3, Filename: name}
+		if name == "bin/busybox" {
+			hdr.DataSize = 7
+		}
+
+		testWriteHeader(t, w, &hdr)
+
+		if hdr.DataSize > 0 {
+			if _, err := w.Write([]byte("busybox")); err != nil {
+				t.Fatalf("Write: %s", err)
+			}
+		}
+	}
+
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Inode: 50, NumLinks: 2, Filename: "lonely"})
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Inode: 60, Filename: "single"})
+
+	var linked []string
+	for _, hdr := range r.All() {
+		if hdr.HardLinked() {
+			linked = append(linked, hdr.Filename)
+		}
+	}
+
+	if !slices.Equal(linked, []string{"bin/ls", "bin/cat", "bin/busybox", "lonely"}) {
+		t.Errorf("unexpected hard linked entries %v", linked)
+	}
+
+	var groups = r.HardLinkGroups()
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group, got %v", groups)
+	}
+
+	if names := groups[42]; !slices.Equal(names, []string{"bin/ls", "bin/cat", "bin/busybox"}) {
+		t.Errorf("unexpected group members %v", names)
+	}
+
+	if name, ok := r.HardLinkDataName(42); !ok || name != "bin/busybox" {
+		t.Errorf("expected data carried by bin/busybox, got %q (%v)", name, ok)
+	}
+
+	if _, ok := r.HardLinkDataName(50); ok {
+		t.Errorf("expected no data-carrying member for inode 50")
+	}
+}
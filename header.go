@@ -5,6 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -22,9 +28,15 @@ func (offs *InvalidByteError) Error() string { return fmt.Sprintf("InvalidByteEr
 func invalidByteError(k int) error { var err = InvalidByteError(k); return &err }
 
 // Magic identifiers for cpio archive member file headers.
+//
+// The kernel only understands the "newc" format, identified by [Magic_070701]
+// and [Magic_070702]. The old portable ASCII (odc) format, [Magic_070707], as
+// produced by `cpio -H odc`, can be read and converted but not unpacked by the
+// kernel, and so is not written by [Writer].
 const (
 	Magic_070701 = `070701`
 	Magic_070702 = `070702`
+	Magic_070707 = `070707`
 )
 
 // The sentinel filename that indicates end-of-archive.
@@ -93,9 +105,119 @@ func (m Mode) String() string {
 		s[9] = 'x'
 	}
 
+	if m.SUID() {
+		setSpecialSlot(&s[3], 's')
+	}
+	if m.SGID() {
+		setSpecialSlot(&s[6], 's')
+	}
+	if m.Sticky() {
+		setSpecialSlot(&s[9], 't')
+	}
+
 	return string(s[:])
 }
 
+// As with `ls`, a special bit replaces the execute slot, and is capitalized
+// when the execute bit is absent.
+func setSpecialSlot(slot *byte, c byte) {
+	if *slot == 'x' {
+		*slot = c
+	} else {
+		*slot = c - 'a' + 'A'
+	}
+}
+
+var ErrMalformedMode = errors.New("initramfs: malformed mode")
+
+// The file type characters used by [Mode.String].
+var modeTypeChars = map[byte]Mode{
+	'-': Mode_File,
+	'd': Mode_Dir,
+	's': Mode_Socket,
+	'l': Mode_Symlink,
+	'b': Mode_BlockDevice,
+	'c': Mode_CharDevice,
+	'p': Mode_FIFO,
+}
+
+// Parse a mode, either in the symbolic form produced by [Mode.String] (such as
+// "drwxr-xr-x" or "-rwsr-xr-x"), or as an octal number (such as "0100755" or
+// "755"). The symbolic form may omit the leading file type character, in which
+// case the file type bits are 0, as they are for an octal number without them.
+//
+// Returns [ErrMalformedMode] if s is in neither form.
+func ParseMode(s string) (Mode, error) {
+	if s != "" && s[0] >= '0' && s[0] <= '7' {
+		v, err := strconv.ParseUint(s, 8, 32)
+		if err != nil || v > uint64(Mode_FileTypeMask|Mode_SUID|Mode_SGID|Mode_Sticky|Mode_PermsMask) {
+			return 0, fmt.Errorf("%w: %q", ErrMalformedMode, s)
+		}
+		return Mode(v), nil
+	}
+
+	var (
+		m     Mode
+		perms = s
+		bad   = fmt.Errorf("%w: %q", ErrMalformedMode, s)
+	)
+
+	switch len(s) {
+	case 10:
+		ftype, ok := modeTypeChars[s[0]]
+		if !ok {
+			return 0, bad
+		}
+		m = ftype
+		perms = s[1:]
+	case 9:
+	default:
+		return 0, bad
+	}
+
+	// Each of user, group and other, along with the special bit that shares
+	// its execute slot
+	for i, special := range [...]struct {
+		bit Mode
+		c   byte
+	}{{Mode_SUID, 's'}, {Mode_SGID, 's'}, {Mode_Sticky, 't'}} {
+		var (
+			slots = perms[i*3 : i*3+3]
+			shift = 6 - 3*i
+		)
+
+		switch slots[0] {
+		case 'r':
+			m |= 0o4 << shift
+		case '-':
+		default:
+			return 0, bad
+		}
+
+		switch slots[1] {
+		case 'w':
+			m |= 0o2 << shift
+		case '-':
+		default:
+			return 0, bad
+		}
+
+		switch slots[2] {
+		case 'x':
+			m |= 0o1 << shift
+		case special.c:
+			m |= 0o1<<shift | special.bit
+		case special.c - 'a' + 'A':
+			m |= special.bit
+		case '-':
+		default:
+			return 0, bad
+		}
+	}
+
+	return m, nil
+}
+
 func (m Mode) FileType() Mode { return m & Mode_FileTypeMask }
 func (m Mode) Perms() int     { return int(m & Mode_PermsMask) }
 
@@ -106,9 +228,9 @@ func (m Mode) BlockDevice() bool { return m.FileType() == Mode_BlockDevice }
 func (m Mode) Dir() bool         { return m.FileType() == Mode_Dir }
 func (m Mode) CharDevice() bool  { return m.FileType() == Mode_CharDevice }
 func (m Mode) FIFO() bool        { return m.FileType() == Mode_FIFO }
-func (m Mode) SUID() bool        { return m.FileType() == Mode_SUID }
-func (m Mode) SGID() bool        { return m.FileType() == Mode_SGID }
-func (m Mode) Sticky() bool      { return m.FileType() == Mode_Sticky }
+func (m Mode) SUID() bool        { return m&Mode_SUID != 0 }
+func (m Mode) SGID() bool        { return m&Mode_SGID != 0 }
+func (m Mode) Sticky() bool      { return m&Mode_Sticky != 0 }
 
 func (m *Mode) SetFileType(ftype int) Mode {
 	*m = (*m &^ Mode_FileTypeMask) | (Mode(ftype) & Mode_FileTypeMask)
@@ -132,6 +254,75 @@ func (m *Mode) ClearBits(bits int) Mode {
 
 func (m Mode) WithPerms(perms int) Mode { return m.SetPerms(perms) }
 
+// Convert to the equivalent [io/fs.FileMode], including the file type,
+// permission bits and the setuid, setgid and sticky bits.
+func (m Mode) FileMode() fs.FileMode {
+	var fm = fs.FileMode(m & Mode_PermsMask)
+
+	switch m.FileType() {
+	case Mode_Socket:
+		fm |= fs.ModeSocket
+	case Mode_Symlink:
+		fm |= fs.ModeSymlink
+	case Mode_BlockDevice:
+		fm |= fs.ModeDevice
+	case Mode_Dir:
+		fm |= fs.ModeDir
+	case Mode_CharDevice:
+		fm |= fs.ModeDevice | fs.ModeCharDevice
+	case Mode_FIFO:
+		fm |= fs.ModeNamedPipe
+	}
+
+	if m&Mode_SUID != 0 {
+		fm |= fs.ModeSetuid
+	}
+	if m&Mode_SGID != 0 {
+		fm |= fs.ModeSetgid
+	}
+	if m&Mode_Sticky != 0 {
+		fm |= fs.ModeSticky
+	}
+
+	return fm
+}
+
+// Convert from an [io/fs.FileMode]. This is the inverse of [Mode.FileMode].
+// Any file type that has no equivalent (such as [io/fs.ModeIrregular]) is
+// treated as a regular file.
+func ModeFromFileMode(fm fs.FileMode) Mode {
+	var m = Mode(fm.Perm())
+
+	switch typ := fm.Type(); {
+	case typ&fs.ModeSocket != 0:
+		m |= Mode_Socket
+	case typ&fs.ModeSymlink != 0:
+		m |= Mode_Symlink
+	case typ&fs.ModeCharDevice != 0:
+		m |= Mode_CharDevice
+	case typ&fs.ModeDevice != 0:
+		m |= Mode_BlockDevice
+	case typ&fs.ModeDir != 0:
+		m |= Mode_Dir
+	case typ&fs.ModeNamedPipe != 0:
+		m |= Mode_FIFO
+	default:
+		m |= Mode_File
+	}
+
+	if fm&fs.ModeSetuid != 0 {
+		m |= Mode_SUID
+	}
+	if fm&fs.ModeSetgid != 0 {
+		m |= Mode_SGID
+	}
+	if fm&fs.ModeSticky != 0 {
+		m |= Mode_Sticky
+	}
+
+	return m
+}
+
 const (
 	Mode_FileTypeMask Mode = 0o170_000
 	Mode_Socket       Mode = 0o140_000 // File type for sockets.
@@ -157,13 +348,21 @@ const (
 	OtherExecute Mode = 0o001
 )
 
+// The largest file data size that can be represented by the newc format, which
+// limits each archive member to just under 4 GiB.
+const MaxDataSize = math.MaxUint32
+
 // Header for a file member within a cpio archive.
+//
+// As DataSize is a 32-bit field, an individual file cannot exceed
+// [MaxDataSize] bytes. Use [Header.SetDataSize] to convert from a larger
+// integer type with bounds checking.
 type Header struct {
 	HeaderOffset int64
 	DataOffset   int64
 
 	// Fixed length fields
-	Magic        string    // Either `070701` or `070702`
+	Magic        string    // Either `070701` or `070702`, or `070707` for odc
 	Inode        uint32    // File inode number
 	Mode         Mode      // File mode and permission bits
 	Uid          uint32    // File owner user id
@@ -189,31 +388,118 @@ func (hdr *Header) String() string {
 
 func (hdr *Header) Trailer() bool { return hdr.Filename == TrailerFilename }
 
-// Read and convert the textual form of the header and filename fields.
+var ErrUnsafePath = errors.New("initramfs: unsafe path")
+
+// Returns the Filename as a normalized, relative, slash separated path, with
+// any leading slashes removed and "." for the root.
+//
+// Returns [ErrUnsafePath] if the filename contains any ".." components.
+func (hdr *Header) CleanName() (string, error) {
+	for _, elem := range strings.Split(hdr.Filename, "/") {
+		if elem == ".." {
+			return "", ErrUnsafePath
+		}
+	}
+	return normalizeName(hdr.Filename), nil
+}
+
+// Returns the path at which this entry should be extracted beneath root, in
+// the native path format. See [Header.CleanName].
+func (hdr *Header) SafePath(root string) (string, error) {
+	name, err := hdr.CleanName()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, filepath.FromSlash(name)), nil
+}
+
+// Set DataSize, returning [ErrFileTooLarge] if n is negative or exceeds
+// [MaxDataSize].
+func (hdr *Header) SetDataSize(n int64) error {
+	if n < 0 || n > MaxDataSize {
+		return ErrFileTooLarge
+	}
+	hdr.DataSize = uint32(n)
+	return nil
+}
+
+// The default limit on the FilenameSize field of a header being read, which
+// comfortably exceeds the Linux PATH_MAX.
+const DefaultMaxFilenameSize = 64 << 10
+
+var ErrFilenameTooLong = errors.New("initramfs: header filename size exceeds maximum")
+
+// Read and convert the textual form of the header and filename fields, in
+// either the newc or odc format (see [Magic_070707]) according to the magic.
 //
-// Returns an [InvalidByteError] if an invalid hexadecimal byte value is
-// encountered. Returns [ErrMalformedFilename] if the filename field is missing
-// a trailing 0.
+// Returns an [InvalidByteError] if an invalid hexadecimal (or for odc, octal)
+// byte value is encountered. Returns [ErrMalformedFilename] if the filename field is missing
+// a trailing 0, or [ErrFilenameTooLong] if the filename size exceeds
+// [DefaultMaxFilenameSize].
 func (hdr *Header) ReadFrom(r io.Reader) (n int64, err error) {
-	var text rawTextHeader
-	n0, err := text.ReadFrom(r)
+	return hdr.readFrom(r, DefaultMaxFilenameSize)
+}
+
+func (hdr *Header) readFrom(r io.Reader, maxFilenameSize int) (n int64, err error) {
+	return hdr.readFromScratch(r, maxFilenameSize, new(headerScratch))
+}
+
+// Buffers for reading a header, which may be reused between headers to avoid
+// allocating for each.
+type headerScratch struct {
+	text     rawTextHeader
+	odc      rawODCHeader
+	filename []byte
+}
+
+func (hdr *Header) readFromScratch(r io.Reader, maxFilenameSize int, s *headerScratch) (n int64, err error) {
+	var text = &s.text
+	n0, err := io.ReadFull(r, text[:6])
+	n += int64(n0)
 	if err != nil {
 		return n, err
 	}
 
-	n += int64(n0)
+	// The length of the remaining fixed fields depends upon the magic
+	var (
+		isODC = string(text[:6]) == Magic_070707
+		odc   = &s.odc
+		rest  = text[6:]
+	)
+	if isODC {
+		copy(odc[:], text[:6])
+		rest = odc[6:]
+	}
 
-	if err := hdr.fromText(&text); err != nil {
+	n1, err := io.ReadFull(r, rest)
+	n += int64(n1)
+	if err == io.EOF {
+		return n, io.ErrUnexpectedEOF
+	} else if err != nil {
 		return n, err
 	}
 
-	var filename = make([]byte, hdr.FilenameSize)
-	n1, err := io.ReadFull(r, filename)
+	if isODC {
+		err = hdr.fromODC(odc)
+	} else {
+		err = hdr.fromText(text)
+	}
 	if err != nil {
 		return n, err
 	}
 
-	n += int64(n1)
+	if hdr.FilenameSize > uint32(maxFilenameSize) {
+		return n, ErrFilenameTooLong
+	}
+
+	var filename = slices.Grow(s.filename[:0], int(hdr.FilenameSize))[:hdr.FilenameSize]
+	s.filename = filename
+
+	n2, err := io.ReadFull(r, filename)
+	n += int64(n2)
+	if err != nil {
+		return n, err
+	}
 
 	if i := bytes.IndexByte(filename, 0); i == -1 {
 		return n, ErrMalformedFilename
@@ -226,6 +512,9 @@ func (hdr *Header) ReadFrom(r io.Reader) (n int64, err error) {
 
 // The length of the textual form of the header and filename fields.
 func (hdr *Header) Size() int {
+	if hdr.Magic == Magic_070707 {
+		return HeaderSizeODC + len(hdr.Filename) + 1
+	}
 	return HeaderSize + len(hdr.Filename) + 1
 }
 
@@ -241,7 +530,45 @@ func (hdr *Header) Bytes() []byte {
 	return buf.Bytes()
 }
 
-// Write the textual form of the header and filename fields.
+// Return the exact textual form of the fixed header fields in the newc format,
+// as written ahead of the filename, with the FilenameSize field taken from the
+// length of the Filename (as per [Header.WriteTo]).
+//
+// Returns [ErrBadHeaderMagic] if the Magic is not [Magic_070701] or
+// [Magic_070702].
+func (hdr *Header) RawBytes() (raw [HeaderSize]byte, err error) {
+	if hdr.Magic != Magic_070701 && hdr.Magic != Magic_070702 {
+		return raw, ErrBadHeaderMagic
+	}
+
+	var h = *hdr
+	h.FilenameSize = uint32(len(h.Filename) + 1)
+
+	err = h.toText((*rawTextHeader)(&raw))
+	return
+}
+
+// Read the exact textual form of the fixed fields of a newc header, without
+// the filename that follows, such as for hashing or byte-level comparison. See
+// [Header.RawBytes].
+//
+// Returns [io.ErrUnexpectedEOF] if the input ends part way through, and
+// [ErrBadHeaderMagic] if the magic is not [Magic_070701] or [Magic_070702].
+func ReadRawHeader(r io.Reader) (raw [HeaderSize]byte, err error) {
+	if _, err = (*rawTextHeader)(&raw).ReadFrom(r); err != nil {
+		return
+	}
+
+	if magic := string(raw[:6]); magic != Magic_070701 && magic != Magic_070702 {
+		return raw, ErrBadHeaderMagic
+	}
+
+	return raw, nil
+}
+
+// Write the textual form of the header and filename fields, in the odc format
+// if the Magic is [Magic_070707] and otherwise newc. Returns
+// [ErrODCFieldRange] if a field does not fit within the odc format.
 func (hdr *Header) WriteTo(w io.Writer) (n int64, err error) {
 	var (
 		filenameSize = len(hdr.Filename) + 1 // include trailing 0
@@ -251,6 +578,22 @@ func (hdr *Header) WriteTo(w io.Writer) (n int64, err error) {
 	hdr.FilenameSize = uint32(filenameSize)
 	copy(filename[:], []byte(hdr.Filename))
 
+	if hdr.Magic == Magic_070707 {
+		var odc rawODCHeader
+		if err := hdr.toODC(&odc); err != nil {
+			return 0, err
+		}
+
+		n0, err := w.Write(odc[:])
+		n = int64(n0)
+		if err != nil {
+			return n, err
+		}
+
+		n1, err := w.Write(filename)
+		return n + int64(n1), err
+	}
+
 	var text rawTextHeader
 	if err := hdr.toText(&text); err != nil {
 		return 0, err
@@ -472,6 +815,4 @@ func ReaderChecksum(r io.Reader) (sum uint32, err error) {
 
 		sum += ComputeChecksum(raw[:n])
 	}
-
-	return
 }
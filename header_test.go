@@ -1,7 +1,12 @@
 package initramfs
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -78,3 +83,259 @@ func TestHeader_ReadFrom(t *testing.T) {
 		})
 	}
 }
+
+func TestHeader_SetDataSize(t *testing.T) {
+	var hdr Header
+
+	for _, n := range []int64{-1, MaxDataSize + 1, 5 << 30} {
+		if err := hdr.SetDataSize(n); err != ErrFileTooLarge {
+			t.Errorf("%d: expected ErrFileTooLarge, got %v", n, err)
+		}
+	}
+
+	if err := hdr.SetDataSize(MaxDataSize); err != nil {
+		t.Fatalf("SetDataSize: %s", err)
+	} else if hdr.DataSize != MaxDataSize {
+		t.Errorf("expected %d, got %d", uint32(MaxDataSize), hdr.DataSize)
+	}
+}
+
+func TestMode_FileMode(t *testing.T) {
+	var testcases = []struct {
+		mode     Mode
+		fileMode fs.FileMode
+	}{
+		{Mode_File | 0o644, 0o644},
+		{Mode_Dir | 0o755, fs.ModeDir | 0o755},
+		{Mode_Symlink | 0o777, fs.ModeSymlink | 0o777},
+		{Mode_Socket | 0o600, fs.ModeSocket | 0o600},
+		{Mode_FIFO | 0o620, fs.ModeNamedPipe | 0o620},
+		{Mode_CharDevice | 0o600, fs.ModeDevice | fs.ModeCharDevice | 0o600},
+		{Mode_BlockDevice | 0o660, fs.ModeDevice | 0o660},
+		{Mode_File | Mode_SUID | 0o755, fs.ModeSetuid | 0o755},
+		{Mode_Dir | Mode_SGID | 0o775, fs.ModeDir | fs.ModeSetgid | 0o775},
+		{Mode_Dir | Mode_Sticky | 0o777, fs.ModeDir | fs.ModeSticky | 0o777},
+		{Mode_File | Mode_SUID | Mode_SGID | Mode_Sticky | 0o777, fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky | 0o777},
+	}
+
+	for i, tc := range testcases {
+		if got := tc.mode.FileMode(); got != tc.fileMode {
+			t.Errorf("#%d: %#o FileMode: expected %s, got %s", i, uint32(tc.mode), tc.fileMode, got)
+		}
+
+		if got := ModeFromFileMode(tc.fileMode); got != tc.mode {
+			t.Errorf("#%d: %s ModeFromFileMode: expected %#o, got %#o", i, tc.fileMode, uint32(tc.mode), uint32(got))
+		}
+	}
+
+	// Every combination of permission and special bits must round trip
+	for bits := Mode(0); bits <= 0o7777; bits++ {
+		var mode = Mode_File | bits
+		if got := ModeFromFileMode(mode.FileMode()); got != mode {
+			t.Fatalf("round trip %#o: got %#o", uint32(mode), uint32(got))
+		}
+	}
+}
+
+func TestMode_SpecialBits(t *testing.T) {
+	var testcases = []struct {
+		mode               Mode
+		suid, sgid, sticky bool
+		file, dir          bool
+	}{
+		{Mode_File | Mode_SUID | 0o755, true, false, false, true, false},
+		{Mode_File | Mode_SGID | 0o755, false, true, false, true, false},
+		{Mode_Dir | Mode_Sticky | 0o777, false, false, true, false, true},
+		{Mode_File | Mode_SUID | Mode_SGID | Mode_Sticky | 0o777, true, true, true, true, false},
+		{Mode_File | 0o777, false, false, false, true, false},
+	}
+
+	for i, tc := range testcases {
+		var m = tc.mode
+		if m.SUID() != tc.suid || m.SGID() != tc.sgid || m.Sticky() != tc.sticky || m.File() != tc.file || m.Dir() != tc.dir {
+			t.Errorf("#%d: %#o: expected SUID %v, SGID %v, Sticky %v, File %v, Dir %v, got %v, %v, %v, %v, %v", i, uint32(m),
+				tc.suid, tc.sgid, tc.sticky, tc.file, tc.dir, m.SUID(), m.SGID(), m.Sticky(), m.File(), m.Dir())
+		}
+	}
+}
+
+func TestMode_String(t *testing.T) {
+	var testcases = []struct {
+		mode   Mode
+		expect string
+	}{
+		{Mode_File | 0o644, "-rw-r--r--"},
+		{Mode_Dir | 0o755, "drwxr-xr-x"},
+		{Mode_File | Mode_SUID | 0o755, "-rwsr-xr-x"},
+		{Mode_File | Mode_SUID | 0o644, "-rwSr--r--"},
+		{Mode_File | Mode_SGID | 0o755, "-rwxr-sr-x"},
+		{Mode_Dir | Mode_SGID | 0o745, "drwxr-Sr-x"},
+		{Mode_Dir | Mode_Sticky | 0o777, "drwxrwxrwt"},
+		{Mode_Dir | Mode_Sticky | 0o776, "drwxrwxrwT"},
+		{Mode_File | Mode_SUID | Mode_SGID | Mode_Sticky | 0o777, "-rwsrwsrwt"},
+		{Mode_File | Mode_SUID | Mode_SGID | Mode_Sticky, "---S--S--T"},
+	}
+
+	for i, tc := range testcases {
+		if got := tc.mode.String(); got != tc.expect {
+			t.Errorf("#%d: %#o: expected %s, got %s", i, uint32(tc.mode), tc.expect, got)
+		}
+	}
+}
+
+func TestHeader_CleanName(t *testing.T) {
+	var testcases = []struct {
+		name   string
+		expect string
+		err    error
+	}{
+		{"/", ".", nil},
+		{"", ".", nil},
+		{".", ".", nil},
+		{"/dev/tty1", "dev/tty1", nil},
+		{"//lib//modules/./kernel/", "lib/modules/kernel", nil},
+		{"./init", "init", nil},
+		{"../etc/passwd", "", ErrUnsafePath},
+		{"/lib/../../etc/passwd", "", ErrUnsafePath},
+		{"lib/..", "", ErrUnsafePath},
+		{"lib/..foo", "lib/..foo", nil},
+	}
+
+	for i, tc := range testcases {
+		var hdr = Header{Filename: tc.name}
+
+		got, err := hdr.CleanName()
+		if err != tc.err {
+			t.Errorf("#%d %q: expected error %v, got %v", i, tc.name, tc.err, err)
+		} else if got != tc.expect {
+			t.Errorf("#%d %q: expected %q, got %q", i, tc.name, tc.expect, got)
+		}
+	}
+}
+
+func TestHeader_SafePath(t *testing.T) {
+	var hdr = Header{Filename: "/etc/passwd"}
+
+	if got, err := hdr.SafePath("root"); err != nil {
+		t.Fatalf("SafePath: %s", err)
+	} else if expect := filepath.Join("root", "etc", "passwd"); got != expect {
+		t.Errorf("expected %s, got %s", expect, got)
+	}
+
+	hdr.Filename = "../etc/passwd"
+	if _, err := hdr.SafePath("root"); err != ErrUnsafePath {
+		t.Errorf("expected ErrUnsafePath, got %v", err)
+	}
+}
+
+func TestHeader_ReadFromFilenameTooLong(t *testing.T) {
+	var hdr = Header{Magic: Magic_070701, Mode: Mode_File | 0o644, Filename: "init"}
+
+	var raw = hdr.Bytes()
+	copy(raw[6+11*8:], "FFFFFFFF") // FilenameSize
+
+	var got Header
+	if _, err := got.ReadFrom(bytes.NewReader(raw)); !errors.Is(err, ErrFilenameTooLong) {
+		t.Errorf("expected ErrFilenameTooLong, got %v", err)
+	}
+
+	r := NewReader(bytes.NewReader(hdr.Bytes()))
+	r.SetMaxFilenameSize(4)
+
+	if _, err := r.Next(); !errors.Is(err, ErrFilenameTooLong) {
+		t.Errorf("expected ErrFilenameTooLong, got %v", err)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	var testcases = []struct {
+		s      string
+		expect Mode
+	}{
+		{"-rw-r--r--", Mode_File | 0o644},
+		{"drwxr-xr-x", Mode_Dir | 0o755},
+		{"lrwxrwxrwx", Mode_Symlink | 0o777},
+		{"crw-------", Mode_CharDevice | 0o600},
+		{"brw-rw----", Mode_BlockDevice | 0o660},
+		{"prw-------", Mode_FIFO | 0o600},
+		{"srw-rw-rw-", Mode_Socket | 0o666},
+		{"rwxr-xr-x", 0o755},
+		{"-rwsr-xr-x", Mode_File | Mode_SUID | 0o755},
+		{"-rwSr--r--", Mode_File | Mode_SUID | 0o644},
+		{"drwxr-Sr-x", Mode_Dir | Mode_SGID | 0o745},
+		{"drwxrwxrwt", Mode_Dir | Mode_Sticky | 0o777},
+		{"drwxrwxrwT", Mode_Dir | Mode_Sticky | 0o776},
+		{"0100755", Mode_File | 0o755},
+		{"755", 0o755},
+		{"4755", Mode_SUID | 0o755},
+		{"0", 0},
+	}
+
+	for i, tc := range testcases {
+		got, err := ParseMode(tc.s)
+		if err != nil {
+			t.Errorf("#%d %q: %s", i, tc.s, err)
+		} else if got != tc.expect {
+			t.Errorf("#%d %q: expected %#o, got %#o", i, tc.s, uint32(tc.expect), uint32(got))
+		}
+	}
+
+	// Every symbolic form produced by String must round trip
+	for _, ftype := range []Mode{Mode_File, Mode_Dir, Mode_Symlink, Mode_CharDevice, Mode_BlockDevice, Mode_FIFO, Mode_Socket} {
+		for bits := Mode(0); bits <= 0o7777; bits++ {
+			var mode = ftype | bits
+			if got, err := ParseMode(mode.String()); err != nil || got != mode {
+				t.Fatalf("round trip %#o (%s): got %#o, %v", uint32(mode), mode, uint32(got), err)
+			}
+		}
+	}
+
+	for _, s := range []string{"", "rwx", "xrwxr-xr-x", "-rwxr-xr-xx", "-rwtr-xr-x", "-rwxr-xr-s", "-wrxr-xr-x", "0200000", "0o755", "89"} {
+		if _, err := ParseMode(s); !errors.Is(err, ErrMalformedMode) {
+			t.Errorf("%q: expected ErrMalformedMode, got %v", s, err)
+		}
+	}
+}
+
+func TestHeader_RawBytes(t *testing.T) {
+	var hdr = Header{
+		Magic:    Magic_070701,
+		Inode:    0x1234,
+		Mode:     Mode_File | 0o644,
+		DataSize: 5,
+		Mtime:    time.Unix(0x5F000000, 0),
+		Filename: "etc/hostname",
+	}
+
+	raw, err := hdr.RawBytes()
+	if err != nil {
+		t.Fatalf("RawBytes: %s", err)
+	}
+
+	var full = hdr.Bytes()
+	if !bytes.Equal(raw[:], full[:HeaderSize]) {
+		t.Errorf("expected %q, got %q", full[:HeaderSize], raw[:])
+	}
+
+	read, err := ReadRawHeader(bytes.NewReader(full))
+	if err != nil {
+		t.Fatalf("ReadRawHeader: %s", err)
+	}
+
+	if read != raw {
+		t.Errorf("ReadRawHeader: expected %q, got %q", raw[:], read[:])
+	}
+
+	if _, err := ReadRawHeader(bytes.NewReader(full[:HeaderSize-1])); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	hdr.Magic = Magic_070707
+	if _, err := hdr.RawBytes(); err != ErrBadHeaderMagic {
+		t.Errorf("RawBytes odc: expected ErrBadHeaderMagic, got %v", err)
+	}
+
+	if _, err := ReadRawHeader(bytes.NewReader(append(hdr.Bytes(), make([]byte, HeaderSize)...))); err != ErrBadHeaderMagic {
+		t.Errorf("ReadRawHeader odc: expected ErrBadHeaderMagic, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package initramfs
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrNotSeekable = errors.New("initramfs: input is not an uncompressed io.ReadSeeker")
+
+// The input as a seeker, provided that it is not being decompressed.
+func (r *Reader) seeker() (io.ReadSeeker, error) {
+	if s, ok := r.r.(io.ReadSeeker); ok {
+		return s, nil
+	}
+	return nil, ErrNotSeekable
+}
+
+// Returns the current position of the underlying input, along with the
+// position corresponding to the start of the archive, from which HeaderOffset
+// and DataOffset are measured.
+func (r *Reader) seekBase(s io.Seeker) (cur, base int64, err error) {
+	cur, err = s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+
+	var consumed = r.nread - r.fileR.N
+	base = cur - int64(r.br.Buffered()) - consumed
+	return
+}
+
+// Scan the remainder of the archive, returning every header. The data of each
+// file is skipped by seeking the input rather than reading it (so checksums
+// are not verified), which makes this suitable for quickly indexing a large
+// uncompressed archive. The data of any entry can then be retrieved with
+// [Reader.ExtractAt].
+//
+// The input given to [NewReader] must be an [io.ReadSeeker], otherwise
+// [ErrNotSeekable] is returned. Upon reaching compressed content, the headers
+// so far are returned along with [ErrCompressedContentAhead].
+func (r *Reader) BuildIndex() ([]Header, error) {
+	s, err := r.seeker()
+	if err != nil {
+		return nil, err
+	}
+
+	var hdrs []Header
+
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			return hdrs, nil
+		} else if err != nil {
+			return hdrs, err
+		}
+
+		hdrs = append(hdrs, *hdr)
+
+		if err := r.seekPastFile(s); err != nil {
+			return hdrs, err
+		}
+	}
+}
+
+// Skip any unread data of the current file, seeking the input when it extends
+// beyond what has been buffered.
+func (r *Reader) seekPastFile(s io.ReadSeeker) error {
+	var (
+		n        = r.fileR.N
+		buffered = int64(r.br.Buffered())
+	)
+
+	r.fileR.N = 0
+	r.sumActive = false
+
+	if n <= buffered {
+		_, err := r.br.Discard(int(n))
+		return err
+	}
+
+	if _, err := s.Seek(n-buffered, io.SeekCurrent); err != nil {
+		return err
+	}
+
+	r.br.Reset(s)
+	return nil
+}
+
+// Copy the data of the entry with the given header, as returned by
+// [Reader.BuildIndex] or [Reader.Next], to w by seeking the input to its
+// DataOffset. The position of the reader is unaffected.
+//
+// The input given to [NewReader] must be an [io.ReadSeeker], otherwise
+// [ErrNotSeekable] is returned. Returns [io.ErrUnexpectedEOF] if the input
+// ends before all of the data has been copied.
+func (r *Reader) ExtractAt(hdr *Header, w io.Writer) (err error) {
+	s, err := r.seeker()
+	if err != nil {
+		return err
+	}
+
+	cur, base, err := r.seekBase(s)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if _, serr := s.Seek(cur, io.SeekStart); err == nil {
+			err = serr
+		}
+	}()
+
+	if _, err := s.Seek(base+hdr.DataOffset, io.SeekStart); err != nil {
+		return err
+	}
+
+	if _, err := io.CopyN(w, s, int64(hdr.DataSize)); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	return nil
+}
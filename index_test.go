@@ -0,0 +1,74 @@
+package initramfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestReader_BuildIndex(t *testing.T) {
+	var files = map[string][]byte{
+		"small": []byte("hello"),
+		"large": bytes.Repeat([]byte("0123456789"), 1000),
+		"last":  []byte("goodbye"),
+	}
+
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	for _, name := range []string{"small", "large", "last"} {
+		if err := w.WriteFile(name, 0o644, files[name]); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	// Embed the archive within a larger input, starting part way through
+	var src = bytes.NewReader(append(bytes.Repeat([]byte{0xee}, 100), buf.Bytes()...))
+	if _, err := src.Seek(100, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %s", err)
+	}
+
+	r := NewReader(src)
+
+	hdrs, err := r.BuildIndex()
+	if err != nil {
+		t.Fatalf("BuildIndex: %s", err)
+	}
+
+	headerList(hdrs).expectNames(t, ".", "small", "large", "last", TrailerFilename)
+
+	for _, hdr := range hdrs {
+		if !hdr.Mode.File() {
+			continue
+		}
+
+		var data bytes.Buffer
+		if err := r.ExtractAt(&hdr, &data); err != nil {
+			t.Fatalf("ExtractAt %s: %s", hdr.Filename, err)
+		}
+
+		if !bytes.Equal(data.Bytes(), files[hdr.Filename]) {
+			t.Errorf("%s: unexpected data %.20q", hdr.Filename, data.Bytes())
+		}
+	}
+
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected EOF after ExtractAt, got %v", err)
+	}
+}
+
+func TestReader_BuildIndexNotSeekable(t *testing.T) {
+	r := NewReader(io.MultiReader(bytes.NewReader(nil)))
+
+	if _, err := r.BuildIndex(); !errors.Is(err, ErrNotSeekable) {
+		t.Errorf("expected ErrNotSeekable, got %v", err)
+	}
+
+	if err := r.ExtractAt(&Header{}, io.Discard); !errors.Is(err, ErrNotSeekable) {
+		t.Errorf("expected ErrNotSeekable, got %v", err)
+	}
+}
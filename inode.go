@@ -0,0 +1,58 @@
+package initramfs
+
+import "hash/fnv"
+
+// An [InodeAllocator] chooses the inode number for an entry being written
+// without one (a header with an Inode of 0). Should it return 0, or a value it
+// has already returned for another entry of the archive, the [Writer] probes
+// for the next unused value instead.
+//
+// The kernel does not otherwise care about inode values, using them only to
+// identify groups of hard links (along with NumLinks), so any stable and
+// distinct values are suitable.
+type InodeAllocator func(hdr *Header) uint32
+
+// Sets the allocator used by [Writer.WriteHeader] to assign inode numbers. When
+// nil (the default), inodes are assigned from a counter that increases with
+// every entry written.
+func (iw *Writer) SetInodeAllocator(alloc InodeAllocator) { iw.inodeAlloc = alloc }
+
+// Returns an [InodeAllocator] that derives each inode number from a hash of the
+// entry's (normalized) filename, so that the same path is given the same inode
+// regardless of the order in which entries are written, which is helpful for
+// reproducible builds. See [PathHashInode].
+//
+// Collisions are resolved by the [Writer] probing for the next unused value, so
+// the inode of a path is only dependent on write order in the unlikely case
+// that its hash collides with that of another path. The allocator holds no
+// state, so may be shared between writers.
+func InodeByPathHash() InodeAllocator { return inodeByName(PathHashInode) }
+
+// Returns the 32-bit FNV-1a hash of the normalized filename (relative to the
+// root, such that "/etc/hosts" and "etc/hosts" are equivalent).
+func PathHashInode(name string) uint32 {
+	var h = fnv.New32a()
+	h.Write([]byte(normalizeName(name)))
+	return h.Sum32()
+}
+
+// Returns an [InodeAllocator] that calls strategy with the normalized filename
+// of each entry.
+func inodeByName(strategy func(name string) uint32) InodeAllocator {
+	return func(hdr *Header) uint32 { return strategy(normalizeName(hdr.Filename)) }
+}
+
+// Call the allocator, probing for the next unused (and non-zero) value upon a
+// collision with an inode it has already assigned within the archive.
+func (iw *Writer) allocInode(hdr *Header) uint32 {
+	var ino = iw.inodeAlloc(hdr)
+	for {
+		if _, ok := iw.allocated[ino]; !ok && ino != 0 {
+			break
+		}
+		ino++
+	}
+
+	iw.allocated[ino] = struct{}{}
+	return ino
+}
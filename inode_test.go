@@ -0,0 +1,111 @@
+package initramfs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestInodeByPathHash(t *testing.T) {
+	var inodes = func(names ...string) map[string]uint32 {
+		var buf bytes.Buffer
+
+		w := NewWriter(&buf)
+		w.SetInodeAllocator(InodeByPathHash())
+
+		for _, name := range names {
+			if err := w.WriteFile(name, 0o644, nil); err != nil {
+				t.Fatalf("WriteFile: %s", err)
+			}
+		}
+
+		var m = make(map[string]uint32)
+		for _, hdr := range NewReader(&buf).All() {
+			if hdr.Inode == 0 {
+				t.Errorf("%s: unexpected inode 0", hdr.Filename)
+			}
+			m[hdr.Filename] = hdr.Inode
+		}
+		return m
+	}
+
+	var (
+		a = inodes("etc/hosts", "etc/passwd", "init")
+		b = inodes("init", "etc/passwd", "etc/hosts")
+	)
+
+	if len(a) != 5 || len(b) != 5 {
+		t.Fatalf("expected 5 entries, got %v and %v", a, b)
+	}
+
+	var seen = make(map[uint32]string)
+	for name, ino := range a {
+		if ino != b[name] {
+			t.Errorf("%s: inode %d differs from %d", name, ino, b[name])
+		}
+
+		if other, ok := seen[ino]; ok {
+			t.Errorf("%s: inode %d already used by %s", name, ino, other)
+		}
+		seen[ino] = name
+	}
+}
+
+func TestInodeByPathHash_Collision(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	w.SetInodeAllocator(InodeByPathHash())
+
+	for _, name := range []string{"a", "/a"} {
+		testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Filename: name})
+	}
+
+	var inodes []uint32
+	for _, hdr := range NewReader(&buf).All() {
+		if hdr.Filename == "a" || hdr.Filename == "/a" {
+			inodes = append(inodes, hdr.Inode)
+		}
+	}
+
+	if len(inodes) != 2 || inodes[1] != inodes[0]+1 {
+		t.Errorf("expected colliding path to probe to the next inode, got %v", inodes)
+	}
+}
+
+func TestWriter_ResetInodeAllocator(t *testing.T) {
+	var build = func(w *Writer) {
+		for _, name := range []string{"etc/hosts", "etc/passwd", "init"} {
+			if err := w.WriteFile(name, 0o644, []byte(name)); err != nil {
+				t.Fatalf("WriteFile: %s", err)
+			}
+		}
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+	}
+
+	var alloc = map[string]WriterOption{
+		"InodeByPathHash": func(iw *Writer) error {
+			iw.SetInodeAllocator(InodeByPathHash())
+			return nil
+		},
+		"WithInodeStrategy": WithInodeStrategy(func(string) uint32 { return 7 }),
+	}
+
+	for name, opt := range alloc {
+		var a, b bytes.Buffer
+
+		w, err := NewWriterOptions(&a, opt)
+		if err != nil {
+			t.Fatalf("NewWriterOptions: %s", err)
+		}
+		build(w)
+
+		w.Reset(&b)
+		build(w)
+
+		if !bytes.Equal(a.Bytes(), b.Bytes()) {
+			t.Errorf("%s: expected identical archives after Reset", name)
+		}
+	}
+}
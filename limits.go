@@ -0,0 +1,50 @@
+package initramfs
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrLimitExceeded = errors.New("initramfs: reader limit exceeded")
+
+// Limits the total number of bytes that may be decompressed across all
+// compressed segments of the archive, as a safeguard against maliciously
+// crafted input that expands enormously. Once more than n bytes have been
+// decompressed, [Reader.Next] and [Reader.Read] return [ErrLimitExceeded].
+// Read-ahead buffering counts towards the limit. A limit of 0 (the default)
+// disables this check.
+func (r *Reader) SetMaxDecompressedBytes(n int64) { r.maxDecompressed = n }
+
+// Limits the number of headers that [Reader.Next] will return, including
+// trailers, after which it returns [ErrLimitExceeded]. A limit of 0 (the
+// default) disables this check.
+func (r *Reader) SetMaxEntries(n int) { r.maxEntries = n }
+
+// Counts the bytes produced by a decompressor, before they are buffered for
+// parsing.
+type decompressedCounter struct {
+	dr io.Reader
+	r  *Reader
+}
+
+func (dc decompressedCounter) Read(p []byte) (int, error) {
+	var r = dc.r
+
+	if r.maxDecompressed > 0 {
+		if r.decompressed > r.maxDecompressed {
+			return 0, ErrLimitExceeded
+		}
+
+		// Read at most one byte beyond the limit, to detect crossing it
+		p = p[:min(int64(len(p)), r.maxDecompressed-r.decompressed+1)]
+	}
+
+	n, err := dc.dr.Read(p)
+	r.decompressed += int64(n)
+
+	if r.maxDecompressed > 0 && r.decompressed > r.maxDecompressed {
+		err = ErrLimitExceeded
+	}
+
+	return n, err
+}
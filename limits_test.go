@@ -0,0 +1,77 @@
+package initramfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestReader_SetMaxDecompressedBytes(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	if err := w.StartCompression(GzipWriter); err != nil {
+		t.Fatalf("StartCompression: %s", err)
+	}
+	if err := w.WriteFile("zeros", 0o644, make([]byte, 1<<20)); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	var raw = buf.Bytes()
+
+	var read = func(limit int64) error {
+		r := NewReader(bytes.NewReader(raw))
+		r.SetMaxDecompressedBytes(limit)
+
+		if _, _, err := r.ContinueCompressed(nil); err != nil {
+			return err
+		}
+
+		for {
+			hdr, err := r.Next()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			if hdr.DataSize > 0 {
+				if _, err := io.Copy(io.Discard, r); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := read(64 << 10); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+
+	if err := read(2 << 20); err != nil {
+		t.Errorf("expected no error within limit, got %v", err)
+	}
+}
+
+func TestReader_SetMaxEntries(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := w.WriteFile(name, 0o644, nil); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+	}
+
+	r.SetMaxEntries(3)
+
+	for _, name := range []string{".", "a", "b"} {
+		testNextNamed(t, r, name)
+	}
+
+	if _, err := r.Next(); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+}
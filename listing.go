@@ -0,0 +1,64 @@
+package initramfs
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Configures the output of [TextListing].
+type ListingOption func(l *listing)
+
+type listing struct {
+	omitMtime bool
+}
+
+// Omit the modification time from each line of the listing.
+func ListingWithoutMtime() ListingOption {
+	return func(l *listing) { l.omitMtime = true }
+}
+
+// Write a stable, human readable listing of every entry in the archive to w,
+// one line per entry, continuing through any compressed segments using the
+// global [CompressReaders]. This is suitable for comparing against a golden
+// file in tests.
+//
+// Each line consists of the mode, uid, gid, size (or major,minor for device
+// nodes), modification time in UTC as per [time.RFC3339] (unless omitted with
+// [ListingWithoutMtime]), and normalized filename, followed by " -> target" for
+// symlinks. Fields that vary between otherwise identical archives, such as
+// inode numbers and offsets, are excluded, as are trailers.
+func TextListing(r *Reader, w io.Writer, opts ...ListingOption) error {
+	var l listing
+	for _, opt := range opts {
+		opt(&l)
+	}
+
+	return r.walk(func(hdr *Header) error {
+		if hdr.Trailer() {
+			return nil
+		}
+
+		var size = fmt.Sprint(hdr.DataSize)
+		if hdr.Mode.CharDevice() || hdr.Mode.BlockDevice() {
+			size = fmt.Sprintf("%d,%d", hdr.RMajor, hdr.RMinor)
+		}
+
+		var mtime string
+		if !l.omitMtime {
+			mtime = " " + hdr.Mtime.UTC().Format(time.RFC3339)
+		}
+
+		var suffix string
+		if hdr.Mode.Symlink() {
+			target, err := r.ReadSymlinkTarget()
+			if err != nil {
+				return err
+			}
+			suffix = " -> " + target
+		}
+
+		_, err := fmt.Fprintf(w, "%s %d %d %s%s %s%s\n", hdr.Mode, hdr.Uid, hdr.Gid, size, mtime, normalizeName(hdr.Filename), suffix)
+		return err
+	})
+}
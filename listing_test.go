@@ -0,0 +1,53 @@
+package initramfs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTextListing(t *testing.T) {
+	t.Run("fixture", func(t *testing.T) {
+		var out bytes.Buffer
+
+		if err := TextListing(NewReader(testdataReader(t, "testdata/data.cpio.gz")), &out); err != nil {
+			t.Fatalf("TextListing: %s", err)
+		}
+
+		const golden = "-rw-rw-r-- 1000 1000 13 2006-01-02T22:04:05Z helloworld.txt\n"
+
+		if got := out.String(); got != golden {
+			t.Errorf("expected listing:\n%s\ngot:\n%s", golden, got)
+		}
+	})
+
+	t.Run("without mtime", func(t *testing.T) {
+		w, r := testWriterReader(t)
+
+		testMkdirAll(t, w, "/bin", 0o755)
+		if err := w.WriteSymlink("/bin/sh", "busybox", 0); err != nil {
+			t.Fatalf("WriteSymlink: %s", err)
+		}
+		if err := w.WriteConsoleDevice(); err != nil {
+			t.Fatalf("WriteConsoleDevice: %s", err)
+		}
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+
+		var out bytes.Buffer
+		if err := TextListing(r, &out, ListingWithoutMtime()); err != nil {
+			t.Fatalf("TextListing: %s", err)
+		}
+
+		const golden = "" +
+			"drwxr-xr-x 0 0 0 .\n" +
+			"drwxr-xr-x 0 0 0 bin\n" +
+			"lrwxrwxrwx 0 0 7 bin/sh -> busybox\n" +
+			"drwxr-xr-x 0 0 0 dev\n" +
+			"crw------- 0 0 5,1 dev/console\n"
+
+		if got := out.String(); got != golden {
+			t.Errorf("expected listing:\n%s\ngot:\n%s", golden, got)
+		}
+	})
+}
@@ -3,9 +3,12 @@ package initramfs
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/bits"
 )
 
 // Identify what kind of data comes next in a stream by looking ahead a few
@@ -30,17 +33,26 @@ const (
 	Lzo                        // Start of LZO compressed data
 	Lz4                        // Start of LZ4 compressed data
 	Zstd                       // Start of Zstd compressed data
+	CpioFileODC                // Start of odc cpio archive member file header, see [Magic_070707]
 )
 
 var (
 	magic_070701 = []byte(Magic_070701)
 	magic_070702 = []byte(Magic_070702)
+	magic_070707 = []byte(Magic_070707)
 )
 
 // Uses [bufio.Reader.Peek] to determine what kind of data follows. Does not
 // consume the input. Only returns non-EOF errors.
-func PeekLookahead(br *bufio.Reader) (la Lookahead, err error) {
-	peek, err := br.Peek(2)
+//
+// As [LzmaMagic] is weak, LZMA data is only identified if the rest of the
+// 13 byte .lzma header is also plausible.
+func PeekLookahead(br *bufio.Reader) (la Lookahead, err error) { return lookahead(br.Peek) }
+
+// As [PeekLookahead], with peek returning the next n bytes of the input as per
+// [bufio.Reader.Peek].
+func lookahead(peekN func(n int) ([]byte, error)) (la Lookahead, err error) {
+	peek, err := peekN(2)
 	if err != nil {
 		if errors.Is(err, io.EOF) {
 			return EOF, nil
@@ -56,10 +68,12 @@ func PeekLookahead(br *bufio.Reader) (la Lookahead, err error) {
 	var m = Magic(peek[0])<<8 | Magic(peek[1])
 	switch m {
 	case CpioFileMagic:
-		if peek, err = br.Peek(6); err != nil {
+		if peek, err = peekN(6); err != nil {
 			return UnknownLookahead, err
 		} else if bytes.Equal(peek, magic_070701) || bytes.Equal(peek, magic_070702) {
 			return CpioFile, nil
+		} else if bytes.Equal(peek, magic_070707) {
+			return CpioFileODC, nil
 		}
 
 	case GzipMagic1:
@@ -69,7 +83,9 @@ func PeekLookahead(br *bufio.Reader) (la Lookahead, err error) {
 	case Bzip2Magic:
 		return Bzip2, nil
 	case LzmaMagic:
-		return Lzma, nil
+		if peek, err := peekN(lzmaHeaderSize); err == nil && validLzmaHeader(peek) {
+			return Lzma, nil
+		}
 	case XzMagic:
 		return Xz, nil
 	case LzoMagic:
@@ -83,6 +99,33 @@ func PeekLookahead(br *bufio.Reader) (la Lookahead, err error) {
 	return UnknownLookahead, nil
 }
 
+// The properties byte, 32-bit dictionary size and 64-bit uncompressed size
+// at the start of a .lzma stream.
+const lzmaHeaderSize = 13
+
+// Reports whether p starts with a plausible .lzma header, as per the checks
+// made by xz-utils: the properties byte must be valid, the dictionary size
+// either 2^n or 2^n + 2^(n-1), and the uncompressed size either unknown (all
+// ones) or less than 256 GiB.
+func validLzmaHeader(p []byte) bool {
+	if len(p) < lzmaHeaderSize || p[0] >= 9*5*5 {
+		return false
+	}
+
+	var dictSize = binary.LittleEndian.Uint32(p[1:5])
+	if dictSize == 0 {
+		return false
+	}
+
+	var high = uint32(1) << (31 - bits.LeadingZeros32(dictSize))
+	if dictSize != high && dictSize != high|high>>1 {
+		return false
+	}
+
+	var size = binary.LittleEndian.Uint64(p[5:13])
+	return size == math.MaxUint64 || size < 1<<38
+}
+
 // Returns true if and only if the lookahead indicates the start of compressed data.
 func (la Lookahead) Compression() bool {
 	switch la {
@@ -99,6 +142,28 @@ func (la Lookahead) Compression() bool {
 	}
 }
 
+// Returns the kernel version in which the initramfs unpacker gained support for
+// this kind of content, or "" if not applicable. See the decompressor table in
+// [Linux kernel lib/decompress.c].
+func (la Lookahead) SupportedSince() string {
+	switch la {
+	case CpioFile, Gzip:
+		return "2.6.0"
+	case Bzip2, Lzma:
+		return "2.6.30"
+	case Lzo:
+		return "2.6.33"
+	case Xz:
+		return "2.6.38"
+	case Lz4:
+		return "3.11"
+	case Zstd:
+		return "5.9"
+	default:
+		return ""
+	}
+}
+
 // If the end of file was reached when looking ahead.
 func (la Lookahead) EOF() bool { return la == EOF }
 
@@ -126,6 +191,8 @@ func (la Lookahead) String() string {
 		return "lz4"
 	case Zstd:
 		return "zstd"
+	case CpioFileODC:
+		return "cpiofile-odc"
 	default:
 		return fmt.Sprintf("0x%x", int(la))
 	}
@@ -140,14 +207,14 @@ func (la Lookahead) String() string {
 type Magic uint16
 
 const (
-	CpioFileMagic Magic = 0x30_37 // A cpio archive member file header starts with "07" (either "070701" or "070702")
+	CpioFileMagic Magic = 0x30_37 // A cpio archive member file header starts with "07" (one of "070701", "070702" or "070707")
 	GzipMagic1    Magic = 0x1F_8B
 	GzipMagic2    Magic = 0x1F_9E
 	Bzip2Magic    Magic = 0x42_5A
 	LzmaMagic     Magic = 0x5D_00
 	XzMagic       Magic = 0xFD_37
 	LzoMagic      Magic = 0x89_4C
-	Lz4Magic      Magic = 0x02_21
+	Lz4Magic      Magic = 0x02_21 // The legacy frame format (0x184C2102 little-endian), being the only LZ4 format the kernel accepts
 	ZstdMagic     Magic = 0x28_B5
 )
 
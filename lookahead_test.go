@@ -3,7 +3,9 @@ package initramfs
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"io"
+	"math"
 	"testing"
 )
 
@@ -46,3 +48,57 @@ func TestPeekLookahead(t *testing.T) {
 		}
 	}
 }
+
+// The kernel only decompresses the LZ4 legacy frame format (as produced by
+// `lz4 -l`, see testdata/generate.sh), so the modern frame format and skippable
+// frames must not be mistaken for it.
+func TestPeekLookahead_Lz4Frames(t *testing.T) {
+	var testcases = []struct {
+		name string
+		data []byte
+		la   Lookahead
+	}{
+		{"legacy", []byte{0x02, 0x21, 0x4C, 0x18}, Lz4},
+		{"modern", []byte{0x04, 0x22, 0x4D, 0x18}, UnknownLookahead},
+		{"skippable", []byte{0x50, 0x2A, 0x4D, 0x18}, UnknownLookahead},
+	}
+
+	for _, tc := range testcases {
+		la, err := PeekLookahead(bufio.NewReader(bytes.NewReader(tc.data)))
+		if err != nil {
+			t.Errorf("%s: error: %s", tc.name, err)
+		} else if la != tc.la {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.la, la)
+		}
+	}
+}
+
+func TestPeekLookahead_Lzma(t *testing.T) {
+	var header = func(dictSize uint32, size uint64) []byte {
+		var p = []byte{0x5D}
+		p = binary.LittleEndian.AppendUint32(p, dictSize)
+		return binary.LittleEndian.AppendUint64(p, size)
+	}
+
+	var testcases = []struct {
+		name string
+		data []byte
+		la   Lookahead
+	}{
+		{"unknown size", header(8<<20, math.MaxUint64), Lzma},
+		{"known size", header(3<<20, 12345), Lzma},
+		{"odd dictionary size", header(8<<20+256, 12345), UnknownLookahead},
+		{"excessive size", header(8<<20, 1<<40), UnknownLookahead},
+		{"short", []byte{0x5D, 0x00, 0x00, 0x80}, UnknownLookahead},
+		{"payload", []byte("]\x00 is not an lzma stream"), UnknownLookahead},
+	}
+
+	for _, tc := range testcases {
+		la, err := PeekLookahead(bufio.NewReader(bytes.NewReader(tc.data)))
+		if err != nil {
+			t.Errorf("%s: error: %s", tc.name, err)
+		} else if la != tc.la {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.la, la)
+		}
+	}
+}
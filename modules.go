@@ -0,0 +1,179 @@
+package initramfs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// The directory beneath which the kernel modules of each kernel release are
+// found, as lib/modules/<release>/.
+const ModulesPath = "lib/modules/"
+
+var (
+	ErrMalformedModulesDep  = errors.New("initramfs: malformed modules.dep")
+	ErrModuleDependencyLoop = errors.New("initramfs: kernel module dependency loop")
+)
+
+// A kernel module to be written by [Writer.WriteModules].
+type ModuleSpec struct {
+	Path string // Relative to the release directory, such as "kernel/drivers/net/e1000.ko"
+	Data []byte
+
+	// The Path of each module that must be loaded before this one, as found in
+	// modules.dep (see [ParseModulesDep])
+	Deps []string
+}
+
+// Parse a modules.dep file as generated by depmod, which consists of lines of
+// the form "<module>: [<dependency>...]", returning the dependencies of each
+// module.
+//
+// Returns [ErrMalformedModulesDep], with the offending line number, for any
+// line without a colon.
+func ParseModulesDep(r io.Reader) (map[string][]string, error) {
+	var (
+		deps    = make(map[string][]string)
+		scanner = bufio.NewScanner(r)
+		lineNum int
+	)
+
+	for scanner.Scan() {
+		lineNum++
+
+		var line = strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%w: line %d: missing colon", ErrMalformedModulesDep, lineNum)
+		}
+
+		deps[name] = strings.Fields(rest)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return deps, nil
+}
+
+// Write the kernel modules beneath [ModulesPath]/release, ordered such that
+// each module follows those it depends upon (and otherwise in the order
+// given), followed by modules.order and modules.dep files listing them. The
+// directories are created with permissions 0755 if they do not yet exist.
+//
+// The written modules.dep is in the text format read by busybox modprobe;
+// tools that require the binary indexes should run depmod at boot instead.
+//
+// Returns [ErrUnsafePath] for an invalid release or module path, and
+// [ErrModuleDependencyLoop] if the dependencies amongst the modules form a
+// cycle. Dependencies that are not amongst the modules are listed in
+// modules.dep but are otherwise ignored.
+func (iw *Writer) WriteModules(release string, modules []ModuleSpec) error {
+	if !fs.ValidPath(release) || release == "." || strings.Contains(release, "/") {
+		return ErrUnsafePath
+	}
+
+	for i := range modules {
+		if !fs.ValidPath(modules[i].Path) || modules[i].Path == "." {
+			return &fs.PathError{Op: "WriteModules", Path: modules[i].Path, Err: ErrUnsafePath}
+		}
+	}
+
+	ordered, err := sortModules(modules)
+	if err != nil {
+		return err
+	}
+
+	var (
+		dir        = ModulesPath + release
+		order, dep strings.Builder
+	)
+
+	for _, mod := range ordered {
+		var name = dir + "/" + mod.Path
+
+		if err := iw.MkdirAll(path.Dir(name), 0o755); err != nil {
+			return err
+		}
+
+		if err := iw.WriteFile(name, 0o644, mod.Data); err != nil {
+			return &fs.PathError{Op: "WriteModules", Path: mod.Path, Err: err}
+		}
+
+		order.WriteString(mod.Path + "\n")
+
+		dep.WriteString(mod.Path + ":")
+		for _, d := range mod.Deps {
+			dep.WriteString(" " + d)
+		}
+		dep.WriteString("\n")
+	}
+
+	if err := iw.WriteFile(dir+"/modules.order", 0o644, []byte(order.String())); err != nil {
+		return err
+	}
+
+	return iw.WriteFile(dir+"/modules.dep", 0o644, []byte(dep.String()))
+}
+
+// Order the modules such that dependencies come first, otherwise preserving
+// the given order.
+func sortModules(modules []ModuleSpec) ([]*ModuleSpec, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	var (
+		byPath  = make(map[string]int, len(modules))
+		state   = make([]int, len(modules))
+		ordered = make([]*ModuleSpec, 0, len(modules))
+		visit   func(i int) error
+	)
+
+	for i := range modules {
+		byPath[modules[i].Path] = i
+	}
+
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w: %s", ErrModuleDependencyLoop, modules[i].Path)
+		}
+
+		state[i] = visiting
+
+		for _, d := range modules[i].Deps {
+			if j, ok := byPath[d]; ok {
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+
+		state[i] = visited
+		ordered = append(ordered, &modules[i])
+
+		return nil
+	}
+
+	for i := range modules {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
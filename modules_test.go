@@ -0,0 +1,107 @@
+package initramfs
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseModulesDep(t *testing.T) {
+	deps, err := ParseModulesDep(strings.NewReader(`
+kernel/drivers/net/e1000.ko:
+kernel/fs/overlayfs/overlay.ko: kernel/fs/fuse/fuse.ko kernel/lib/crc32.ko
+`))
+	if err != nil {
+		t.Fatalf("ParseModulesDep: %s", err)
+	}
+
+	if d, ok := deps["kernel/drivers/net/e1000.ko"]; !ok || len(d) != 0 {
+		t.Errorf("e1000.ko: expected no dependencies, got %q (%v)", d, ok)
+	}
+
+	if d := deps["kernel/fs/overlayfs/overlay.ko"]; len(d) != 2 || d[0] != "kernel/fs/fuse/fuse.ko" || d[1] != "kernel/lib/crc32.ko" {
+		t.Errorf("overlay.ko: unexpected dependencies %q", d)
+	}
+
+	if _, err := ParseModulesDep(strings.NewReader("kernel/a.ko\n")); !errors.Is(err, ErrMalformedModulesDep) {
+		t.Errorf("expected ErrMalformedModulesDep, got %v", err)
+	}
+}
+
+func TestWriter_WriteModules(t *testing.T) {
+	var modules = []ModuleSpec{
+		{Path: "kernel/c.ko", Data: []byte("c"), Deps: []string{"kernel/b.ko", "kernel/sub/a.ko"}},
+		{Path: "kernel/sub/a.ko", Data: []byte("a")},
+		{Path: "kernel/b.ko", Data: []byte("b"), Deps: []string{"kernel/sub/a.ko", "kernel/builtin.ko"}},
+	}
+
+	w, r := testWriterReader(t)
+
+	if err := w.WriteModules("../6.1", modules); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("expected ErrUnsafePath, got %v", err)
+	}
+
+	if err := w.WriteModules("6.1", modules); err != nil {
+		t.Fatalf("WriteModules: %s", err)
+	}
+
+	var (
+		hdrs  headerList
+		files = make(map[string]string)
+	)
+
+	for _, hdr := range r.All() {
+		hdrs = append(hdrs, hdr)
+
+		if hdr.Mode.File() {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll: %s", err)
+			}
+			files[hdr.Filename] = string(data)
+		}
+	}
+
+	hdrs.expectNames(t,
+		".",
+		"lib",
+		"lib/modules",
+		"lib/modules/6.1",
+		"lib/modules/6.1/kernel",
+		"lib/modules/6.1/kernel/sub",
+		"lib/modules/6.1/kernel/sub/a.ko",
+		"lib/modules/6.1/kernel/b.ko",
+		"lib/modules/6.1/kernel/c.ko",
+		"lib/modules/6.1/modules.order",
+		"lib/modules/6.1/modules.dep",
+	)
+
+	if expect, got := "kernel/sub/a.ko\nkernel/b.ko\nkernel/c.ko\n", files["lib/modules/6.1/modules.order"]; got != expect {
+		t.Errorf("modules.order: expected %q, got %q", expect, got)
+	}
+
+	var expectDep = "kernel/sub/a.ko:\n" +
+		"kernel/b.ko: kernel/sub/a.ko kernel/builtin.ko\n" +
+		"kernel/c.ko: kernel/b.ko kernel/sub/a.ko\n"
+	if got := files["lib/modules/6.1/modules.dep"]; got != expectDep {
+		t.Errorf("modules.dep: expected %q, got %q", expectDep, got)
+	}
+
+	if got := files["lib/modules/6.1/kernel/c.ko"]; got != "c" {
+		t.Errorf("c.ko: unexpected data %q", got)
+	}
+}
+
+func TestWriter_WriteModules_Loop(t *testing.T) {
+	var modules = []ModuleSpec{
+		{Path: "a.ko", Deps: []string{"b.ko"}},
+		{Path: "b.ko", Deps: []string{"a.ko"}},
+	}
+
+	w, _ := testWriterReader(t)
+
+	if err := w.WriteModules("6.1", modules); !errors.Is(err, ErrModuleDependencyLoop) {
+		t.Errorf("expected ErrModuleDependencyLoop, got %v", err)
+	}
+}
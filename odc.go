@@ -0,0 +1,140 @@
+package initramfs
+
+import (
+	"errors"
+	"time"
+)
+
+// The size of a member file header in the old portable ASCII (odc) cpio format,
+// whose fields are octal rather than hexadecimal and which has no alignment
+// padding. See [Magic_070707].
+const HeaderSizeODC = 76
+
+// 6 bytes magic, 8 fields at 6 bytes each, 2 fields at 11 bytes each
+var _ [HeaderSizeODC]byte = [6 + 8*6 + 2*11]byte{}
+
+var ErrODCFieldRange = errors.New("initramfs: header field value out of range for the odc format")
+
+// The raw octal characters of the fixed fields from an odc member file header.
+type rawODCHeader [HeaderSizeODC]byte
+
+// Offset and width of each odc field, following the magic.
+var odcFields = [...]struct{ offs, width int }{
+	{6, 6},   // dev
+	{12, 6},  // ino
+	{18, 6},  // mode
+	{24, 6},  // uid
+	{30, 6},  // gid
+	{36, 6},  // nlink
+	{42, 6},  // rdev
+	{48, 11}, // mtime
+	{59, 6},  // namesize
+	{65, 11}, // filesize
+}
+
+const (
+	odcDev = iota
+	odcIno
+	odcMode
+	odcUid
+	odcGid
+	odcNlink
+	odcRdev
+	odcMtime
+	odcNamesize
+	odcFilesize
+)
+
+// Decode the octal field. May return [InvalidByteError].
+func (odc *rawODCHeader) field(i int) (v uint64, err error) {
+	var f = odcFields[i]
+
+	for j := f.offs; j < f.offs+f.width; j++ {
+		var c = odc[j]
+		if c < '0' || c > '7' {
+			return 0, invalidByteError(j)
+		}
+		v = v<<3 | uint64(c-'0')
+	}
+
+	return v, nil
+}
+
+// Encode the octal field, returning [ErrODCFieldRange] if it does not fit.
+func (odc *rawODCHeader) setField(i int, v uint64) error {
+	var f = odcFields[i]
+
+	if v >= 1<<(3*f.width) {
+		return ErrODCFieldRange
+	}
+
+	for j := f.offs + f.width - 1; j >= f.offs; j-- {
+		odc[j] = '0' + byte(v&7)
+		v >>= 3
+	}
+
+	return nil
+}
+
+func (hdr *Header) fromODC(odc *rawODCHeader) error {
+	if string(odc[:6]) != Magic_070707 {
+		return ErrBadHeaderMagic
+	}
+
+	var fields [len(odcFields)]uint64
+	for i := range fields {
+		v, err := odc.field(i)
+		if err != nil {
+			return err
+		}
+		fields[i] = v
+	}
+
+	*hdr = Header{
+		Magic:    Magic_070707,
+		Inode:    uint32(fields[odcIno]),
+		Mode:     Mode(fields[odcMode]),
+		Uid:      uint32(fields[odcUid]),
+		Gid:      uint32(fields[odcGid]),
+		NumLinks: uint32(fields[odcNlink]),
+		Mtime:    time.Unix(int64(fields[odcMtime]), 0),
+		// Device numbers are encoded in the traditional 16-bit form
+		Major:        uint32(fields[odcDev] >> 8),
+		Minor:        uint32(fields[odcDev] & 0xff),
+		RMajor:       uint32(fields[odcRdev] >> 8),
+		RMinor:       uint32(fields[odcRdev] & 0xff),
+		FilenameSize: uint32(fields[odcNamesize]),
+		// Filename is excluded from this conversion
+	}
+
+	return hdr.SetDataSize(int64(fields[odcFilesize]))
+}
+
+func (hdr *Header) toODC(odc *rawODCHeader) error {
+	if hdr.Minor > 0xff || hdr.RMinor > 0xff {
+		return ErrODCFieldRange
+	}
+
+	copy(odc[:6], Magic_070707)
+
+	var fields = [...]uint64{
+		odcDev:      uint64(hdr.Major)<<8 | uint64(hdr.Minor),
+		odcIno:      uint64(hdr.Inode),
+		odcMode:     uint64(hdr.Mode),
+		odcUid:      uint64(hdr.Uid),
+		odcGid:      uint64(hdr.Gid),
+		odcNlink:    uint64(hdr.NumLinks),
+		odcRdev:     uint64(hdr.RMajor)<<8 | uint64(hdr.RMinor),
+		odcMtime:    uint64(hdr.mtimeUnix()),
+		odcNamesize: uint64(hdr.FilenameSize),
+		odcFilesize: uint64(hdr.DataSize),
+	}
+
+	for i, v := range fields {
+		if err := odc.setField(i, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
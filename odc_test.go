@@ -0,0 +1,131 @@
+package initramfs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// An odc archive as produced by `cpio -o -H odc`, with unaligned entries.
+func testODCArchive(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	for _, e := range []struct {
+		hdr  Header
+		data string
+	}{
+		{Header{Inode: 1, Mode: Mode_Dir | 0o755, NumLinks: 2, Filename: "etc"}, ""},
+		{Header{Inode: 2, Mode: Mode_File | 0o644, NumLinks: 1, Uid: 1000, Gid: 100, Mtime: time.Unix(1136239445, 0), Filename: "etc/hostname"}, "odc\n"},
+		{Header{Inode: 3, Mode: Mode_CharDevice | 0o600, NumLinks: 1, RMajor: 5, RMinor: 1, Filename: "dev/console"}, ""},
+		{Header{Inode: 4, Mode: Mode_Symlink | 0o777, NumLinks: 1, Filename: "sh"}, "busybox"},
+		{Header{NumLinks: 1, Filename: TrailerFilename}, ""},
+	} {
+		var hdr = e.hdr
+		hdr.Magic = Magic_070707
+		hdr.DataSize = uint32(len(e.data))
+
+		if _, err := hdr.WriteTo(&buf); err != nil {
+			t.Fatalf("WriteTo %s: %s", hdr.Filename, err)
+		}
+		buf.WriteString(e.data)
+	}
+
+	// Pad to a block, as cpio does
+	buf.Write(make([]byte, alignFill(int64(buf.Len()), 512)))
+
+	return buf.Bytes()
+}
+
+func TestHeader_ODC(t *testing.T) {
+	var hdr = Header{
+		Magic:    Magic_070707,
+		Inode:    0o1234,
+		Mode:     Mode_File | 0o644,
+		Uid:      1000,
+		Gid:      100,
+		NumLinks: 1,
+		Mtime:    time.Unix(1136239445, 0),
+		DataSize: 13,
+		Major:    8,
+		Minor:    1,
+		Filename: "helloworld.txt",
+	}
+
+	raw := hdr.Bytes()
+
+	const expect = "070707004001001234100644001750000144000001000000" + "10356321525" + "000017" + "00000000015" + "helloworld.txt\x00"
+	if string(raw) != expect {
+		t.Fatalf("expected %q, got %q", expect, raw)
+	}
+	if len(raw) != hdr.Size() {
+		t.Errorf("expected Size %d, got %d", len(raw), hdr.Size())
+	}
+
+	var got Header
+	if n, err := got.ReadFrom(bytes.NewReader(raw)); err != nil {
+		t.Fatalf("ReadFrom: %s", err)
+	} else if n != int64(len(raw)) {
+		t.Errorf("expected to read %d bytes, got %d", len(raw), n)
+	}
+
+	if got != hdr {
+		t.Errorf("expected %+v, got %+v", hdr, got)
+	}
+
+	hdr.Inode = 1 << 18
+	if _, err := hdr.WriteTo(io.Discard); !errors.Is(err, ErrODCFieldRange) {
+		t.Errorf("expected ErrODCFieldRange, got %v", err)
+	}
+}
+
+func TestReader_ODC(t *testing.T) {
+	var raw = testODCArchive(t)
+
+	if la, err := PeekLookahead(bufio.NewReader(bytes.NewReader(raw))); err != nil || la != CpioFileODC {
+		t.Fatalf("expected CpioFileODC lookahead, got %s (%v)", la, err)
+	}
+
+	r := NewReader(bytes.NewReader(raw))
+
+	var hdrs headerList
+	for _, hdr := range r.All() {
+		hdrs = append(hdrs, hdr)
+
+		switch hdr.Filename {
+		case "etc/hostname":
+			if data, err := io.ReadAll(r); err != nil || string(data) != "odc\n" {
+				t.Errorf("%s: unexpected data %q (%v)", hdr.Filename, data, err)
+			}
+			if hdr.Uid != 1000 || hdr.Gid != 100 || hdr.Mtime.Unix() != 1136239445 {
+				t.Errorf("%s: unexpected header %s", hdr.Filename, &hdr)
+			}
+		case "dev/console":
+			if !hdr.Mode.CharDevice() || hdr.RMajor != 5 || hdr.RMinor != 1 {
+				t.Errorf("%s: unexpected header %s", hdr.Filename, &hdr)
+			}
+		}
+	}
+	hdrs.expectNames(t, "etc", "etc/hostname", "dev/console", "sh", TrailerFilename)
+
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected EOF after trailer padding, got %v", err)
+	}
+}
+
+func TestWriter_RejectsODC(t *testing.T) {
+	w := NewWriter(io.Discard)
+
+	if err := w.SetDefaultMagic(Magic_070707); !errors.Is(err, ErrBadHeaderMagic) {
+		t.Errorf("SetDefaultMagic: expected ErrBadHeaderMagic, got %v", err)
+	}
+
+	var hdr = Header{Magic: Magic_070707, Mode: Mode_File | 0o644, Filename: "odc"}
+	if err := w.WriteHeader(&hdr); !errors.Is(err, ErrBadHeaderMagic) {
+		t.Errorf("WriteHeader: expected ErrBadHeaderMagic, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package initramfs
+
+import "io"
+
+// Configures a [Writer] created by [NewWriterOptions].
+type WriterOption func(iw *Writer) error
+
+// Create a writer with the given options applied in order. [NewWriter] is
+// equivalent to calling this without any options.
+//
+// Returns the first error from any option.
+func NewWriterOptions(w io.Writer, opts ...WriterOption) (*Writer, error) {
+	var iw = NewWriter(w)
+
+	for _, opt := range opts {
+		if err := opt(iw); err != nil {
+			return nil, err
+		}
+	}
+
+	return iw, nil
+}
+
+// Align the data of every regular file, see [Writer.SetAllDataAlignment].
+func WithDefaultAlignment(alignTo int) WriterOption {
+	return func(iw *Writer) error { return iw.SetAllDataAlignment(alignTo) }
+}
+
+// Produce reproducible output, see [Writer.SetReproducible].
+func WithReproducible() WriterOption {
+	return func(iw *Writer) error { return iw.SetReproducible(true) }
+}
+
+// Keep the Uid and Gid of headers in reproducible mode, see
+// [Writer.SetPreserveOwnership].
+func WithPreserveOwnership() WriterOption {
+	return func(iw *Writer) error {
+		iw.SetPreserveOwnership(true)
+		return nil
+	}
+}
+
+// Use the given permissions for directories that are created automatically,
+// either as parents of an entry or by [Writer.MkdirAll] with a perm of 0,
+// rather than [DefaultMkdirPerm].
+func WithDefaultDirPerm(perm Mode) WriterOption {
+	return func(iw *Writer) error {
+		iw.defaultDirPerm = perm & Mode_PermsMask
+		return nil
+	}
+}
+
+// Normalize and check filenames, see [Writer.SetStrictPaths].
+func WithStrictPaths() WriterOption {
+	return func(iw *Writer) error {
+		iw.SetStrictPaths(true)
+		return nil
+	}
+}
+
+// Write a trailer upon closing if needed, see [Writer.SetAutoTrailer].
+func WithAutoTrailer() WriterOption {
+	return func(iw *Writer) error {
+		iw.SetAutoTrailer(true)
+		return nil
+	}
+}
+
+// Assign the inode of each entry written without one from its normalized
+// filename, rather than from write order, such as with [PathHashInode]. Any
+// collision (or a value of 0) is resolved by probing for the next unused value.
+//
+// Only entries with an Inode of 0 are affected. Hard links written with a
+// shared Inode (see [Writer.SetCoalesceHardLinks] and [Writer.WriteHardLink])
+// keep it, unless in reproducible mode (see [Writer.SetReproducible]), where
+// each group is remapped to the inode derived from the name of its first
+// member, so that the links remain grouped.
+func WithInodeStrategy(strategy func(name string) uint32) WriterOption {
+	return func(iw *Writer) error {
+		iw.SetInodeAllocator(inodeByName(strategy))
+		return nil
+	}
+}
+
+// Rewrite or drop entries by filename, see [Writer.SetRewriteName].
+func WithRewriteName(fn func(name string) (newName string, keep bool)) WriterOption {
+	return func(iw *Writer) error {
+		iw.SetRewriteName(fn)
+		return nil
+	}
+}
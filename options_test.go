@@ -0,0 +1,106 @@
+package initramfs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestNewWriterOptions(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriterOptions(&buf,
+		WithDefaultDirPerm(0o755),
+		WithDefaultAlignment(16),
+		WithReproducible(),
+		WithStrictPaths(),
+	)
+	if err != nil {
+		t.Fatalf("NewWriterOptions: %s", err)
+	}
+
+	if err := w.WriteFile("/usr/../bin/tools", 0o755, []byte("data")); !errors.Is(err, ErrUnsafePath) {
+		t.Fatalf("expected ErrUnsafePath, got %v", err)
+	}
+
+	if err := w.WriteFile("/usr/bin/tools", 0o755, []byte("data")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	r := NewReader(&buf)
+
+	for _, name := range []string{".", "usr", "usr/bin"} {
+		hdr := testNextNamed(t, r, name)
+
+		if hdr.Mode != Mode_Dir|0o755 {
+			t.Errorf("%s: expected mode %s, got %s", name, Mode_Dir|0o755, hdr.Mode)
+		}
+	}
+
+	hdr := testNextNamed(t, r, "usr/bin/tools")
+
+	if hdr.DataOffset%16 != 0 {
+		t.Errorf("expected data aligned to 16, got offset %d", hdr.DataOffset)
+	}
+
+	if hdr.Inode != 4 {
+		t.Errorf("expected reproducible inode 4, got %d", hdr.Inode)
+	}
+}
+
+func TestNewWriterOptionsError(t *testing.T) {
+	var buf bytes.Buffer
+
+	if _, err := NewWriterOptions(&buf, WithDefaultAlignment(3)); !errors.Is(err, ErrBadAlignment) {
+		t.Errorf("expected ErrBadAlignment, got %v", err)
+	}
+}
+
+func TestWithInodeStrategy(t *testing.T) {
+	var build = func(strategy func(name string) uint32, names ...string) map[string]uint32 {
+		var buf bytes.Buffer
+
+		w, err := NewWriterOptions(&buf, WithInodeStrategy(strategy), WithReproducible())
+		if err != nil {
+			t.Fatalf("NewWriterOptions: %s", err)
+		}
+
+		for _, name := range names {
+			if err := w.WriteFile(name, 0o644, nil); err != nil {
+				t.Fatalf("WriteFile: %s", err)
+			}
+		}
+
+		// A hard linked pair given an arbitrary shared inode
+		for _, name := range []string{"bin/busybox", "bin/sh"} {
+			testWriteHeader(t, w, &Header{Mode: Mode_File | 0o755, Inode: 12345, NumLinks: 2, Filename: name})
+		}
+
+		var inodes = make(map[string]uint32)
+		for _, hdr := range NewReader(&buf).All() {
+			inodes[hdr.Filename] = hdr.Inode
+		}
+		return inodes
+	}
+
+	var (
+		a = build(PathHashInode, "etc/hosts", "init")
+		b = build(PathHashInode, "init", "etc/hosts")
+	)
+
+	for name, ino := range a {
+		if b[name] != ino {
+			t.Errorf("%s: inode %d differs from %d", name, ino, b[name])
+		}
+	}
+
+	if a["bin/sh"] != a["bin/busybox"] || a["bin/busybox"] != PathHashInode("bin/busybox") {
+		t.Errorf("expected hard links to share the inode of bin/busybox, got %v", a)
+	}
+
+	// Collisions, including with 0, are probed
+	var c = build(func(string) uint32 { return 0 }, "a", "b")
+	if c["."] != 1 || c["a"] != 2 || c["b"] != 3 {
+		t.Errorf("expected inodes assigned by probing, got %v", c)
+	}
+}
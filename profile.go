@@ -0,0 +1,78 @@
+package initramfs
+
+import (
+	"errors"
+	"io/fs"
+	"math"
+	"time"
+)
+
+// Describes the limitations of the system that will ultimately consume an
+// archive, so that the [Writer] can reject or warn about entries that the
+// target would not be able to handle. See [Writer.SetTargetProfile].
+//
+// The newc format itself is endian-agnostic (all fields are hexadecimal text),
+// so the checks only concern the range of field values.
+type TargetProfile struct {
+	Name string
+
+	// If non-zero, any entry with a later modification time is rejected with
+	// [ErrTargetMtime].
+	MaxMtime time.Time
+
+	// If non-zero, any entry with a larger DataSize is rejected with
+	// [ErrTargetDataSize].
+	MaxDataSize int64
+
+	// If set, device nodes whose major or minor number does not fit within 8
+	// bits (the legacy 16-bit dev_t) produce a warning wrapping
+	// [ErrTargetDevice]. See [Writer.Warnings].
+	LegacyDevT bool
+}
+
+// The profile for 32-bit targets, where time_t and off_t are signed 32-bit
+// values: modification times must not exceed 2038-01-19T03:14:07Z and files
+// must be smaller than 2 GiB. Device numbers beyond the legacy dev_t range are
+// warned about as older 32-bit userspace may not be able to represent them. As
+// the format is endian-agnostic, it applies to little and big-endian targets
+// alike.
+var Profile32Bit = TargetProfile{
+	Name:        "32bit",
+	MaxMtime:    time.Unix(math.MaxInt32, 0),
+	MaxDataSize: math.MaxInt32,
+	LegacyDevT:  true,
+}
+
+var (
+	ErrTargetMtime    = errors.New("initramfs: modification time is out of range for the target profile")
+	ErrTargetDataSize = errors.New("initramfs: data size is out of range for the target profile")
+	ErrTargetDevice   = errors.New("initramfs: device number is out of range for a legacy dev_t")
+)
+
+// Set the profile of the system that will consume the archive. Every
+// subsequent header will be checked against it. Use the zero value to disable
+// all checks.
+func (iw *Writer) SetTargetProfile(profile TargetProfile) { iw.profile = profile }
+
+// Returns any warnings raised by the target profile checks so far.
+func (iw *Writer) Warnings() []error { return iw.warnings }
+
+func (iw *Writer) checkTargetProfile(hdr *Header) error {
+	var p = &iw.profile
+
+	if !p.MaxMtime.IsZero() && hdr.Mtime.After(p.MaxMtime) {
+		return &fs.PathError{Op: "WriteHeader", Path: hdr.Filename, Err: ErrTargetMtime}
+	}
+
+	if p.MaxDataSize > 0 && int64(hdr.DataSize) > p.MaxDataSize {
+		return &fs.PathError{Op: "WriteHeader", Path: hdr.Filename, Err: ErrTargetDataSize}
+	}
+
+	if p.LegacyDevT && (hdr.Mode.CharDevice() || hdr.Mode.BlockDevice()) {
+		if hdr.RMajor > 0xff || hdr.RMinor > 0xff {
+			iw.warnings = append(iw.warnings, &fs.PathError{Op: "WriteHeader", Path: hdr.Filename, Err: ErrTargetDevice})
+		}
+	}
+
+	return nil
+}
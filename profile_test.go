@@ -0,0 +1,69 @@
+package initramfs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWriter_SetTargetProfile(t *testing.T) {
+	var testcases = []struct {
+		name    string
+		hdr     Header
+		err     error
+		warning error
+	}{
+		{
+			name: "ok",
+			hdr:  Header{Mode: Mode_File | 0o644, Mtime: time.Unix(1<<30, 0), DataSize: 1 << 20, Filename: "ok"},
+		},
+		{
+			name: "mtime",
+			hdr:  Header{Mode: Mode_File | 0o644, Mtime: time.Date(2038, 1, 20, 0, 0, 0, 0, time.UTC), Filename: "future"},
+			err:  ErrTargetMtime,
+		},
+		{
+			name: "data size",
+			hdr:  Header{Mode: Mode_File | 0o644, DataSize: 1 << 31, Filename: "huge"},
+			err:  ErrTargetDataSize,
+		},
+		{
+			name:    "device",
+			hdr:     Header{Mode: Mode_BlockDevice | 0o660, RMajor: 259, RMinor: 0, Filename: "nvme0n1"},
+			warning: ErrTargetDevice,
+		},
+		{
+			name: "legacy device",
+			hdr:  Header{Mode: Mode_BlockDevice | 0o660, RMajor: 8, RMinor: 0, Filename: "sda"},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, _ := testWriterReader(t)
+			w.SetTargetProfile(Profile32Bit)
+
+			if err := w.WriteHeader(&tc.hdr); !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+
+			var warnings = w.Warnings()
+			if tc.warning == nil {
+				if len(warnings) != 0 {
+					t.Fatalf("expected no warnings, got %v", warnings)
+				}
+			} else if len(warnings) != 1 || !errors.Is(warnings[0], tc.warning) {
+				t.Fatalf("expected warning %v, got %v", tc.warning, warnings)
+			}
+		})
+	}
+
+	t.Run("no profile", func(t *testing.T) {
+		w, _ := testWriterReader(t)
+
+		var hdr = Header{Mode: Mode_File | 0o644, Mtime: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC), Filename: "future"}
+		if err := w.WriteHeader(&hdr); err != nil {
+			t.Fatalf("WriteHeader: %s", err)
+		}
+	})
+}
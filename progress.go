@@ -0,0 +1,28 @@
+package initramfs
+
+// Set a function to be called once the data of each entry (other than
+// trailers) has been fully written, whether through [Writer.Write],
+// [Writer.ReadFrom] or zero filling, or immediately after the header for
+// entries without data. This includes the parent directories created
+// automatically. The header is as written, and written is the total output so
+// far as per [Writer.Written]. A nil fn removes any existing function.
+//
+// This is useful for reporting progress while writing a large archive.
+func (iw *Writer) SetOnEntry(fn func(hdr *Header, written int64)) { iw.onEntry = fn }
+
+// Returns the total number of bytes written to the underlying writer so far.
+// When compressing, this is the compressed output, which the [CompressWriter]
+// may buffer.
+func (iw *Writer) Written() int64 { return iw.out.n }
+
+func (iw *Writer) entryDone() {
+	if !iw.entryPending {
+		return
+	}
+	iw.entryPending = false
+
+	if iw.onEntry != nil {
+		var hdr = iw.entry
+		iw.onEntry(&hdr, iw.Written())
+	}
+}
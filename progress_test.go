@@ -0,0 +1,65 @@
+package initramfs
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriter_SetOnEntry(t *testing.T) {
+	var (
+		buf    bytes.Buffer
+		w      = NewWriter(&buf)
+		events []string
+		last   int64
+	)
+
+	w.SetOnEntry(func(hdr *Header, written int64) {
+		if written < last {
+			t.Errorf("%s: written went backwards from %d to %d", hdr.Filename, last, written)
+		}
+		last = written
+
+		events = append(events, fmt.Sprintf("%s %d", hdr.Filename, hdr.DataSize))
+	})
+
+	// Data via Write, in parts
+	var hdr = Header{Mode: Mode_File | 0o644, DataSize: 6, Filename: "etc/a"}
+	if err := w.WriteHeader(&hdr); err != nil {
+		t.Fatalf("WriteHeader: %s", err)
+	}
+	for _, part := range []string{"abc", "def"} {
+		if len(events) != 2 {
+			t.Errorf("expected no event for etc/a before its data is written, got %v", events)
+		}
+		if _, err := w.Write([]byte(part)); err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+	}
+
+	// Data via ReadFrom
+	if err := w.WriteFileReader("etc/b", 0o644, 3, strings.NewReader("xyz")); err != nil {
+		t.Fatalf("WriteFileReader: %s", err)
+	}
+
+	// Data zero filled by the following header
+	hdr = Header{Mode: Mode_File | 0o644, DataSize: 4, Filename: "etc/c"}
+	if err := w.WriteHeader(&hdr); err != nil {
+		t.Fatalf("WriteHeader: %s", err)
+	}
+
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var expect = []string{". 0", "etc 0", "etc/a 6", "etc/b 3", "etc/c 4"}
+	if !slices.Equal(events, expect) {
+		t.Errorf("expected events %v, got %v", expect, events)
+	}
+
+	if w.Written() != int64(buf.Len()) {
+		t.Errorf("expected Written %d, got %d", buf.Len(), w.Written())
+	}
+}
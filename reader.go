@@ -2,9 +2,15 @@ package initramfs
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"iter"
+	"path"
+	"time"
 )
 
 type Reader struct {
@@ -12,6 +18,33 @@ type Reader struct {
 	br    *bufio.Reader
 	nread int64
 	fileR io.LimitedReader
+	cur   Header
+	codec Lookahead
+	outer []outerStream // Enclosing the current compressed segment, innermost last
+
+	scratch headerScratch // Reused for reading each header
+	lastGap int64         // Bytes skipped before the most recent header
+	raw     io.Writer     // Receives the bytes of each header and any padding, see CopyRaw
+
+	maxSymlinkSize  int
+	maxFilenameSize int
+
+	links    map[uint32][]string // Hard link names by inode
+	linkData map[uint32]string   // Data-carrying hard link by inode
+
+	verifyChecksum bool
+	sumActive      bool // Verifying the checksum of the current file
+	sum            ChecksumWriter
+
+	maxDecompressed int64
+	decompressed    int64 // Across all compressed segments
+	maxEntries      int
+	entries         int
+
+	sawTrailer     bool // Whether the most recent header was a trailer
+	requireTrailer bool
+	stopAtTrailer  bool
+	strict         bool
 }
 
 var (
@@ -19,13 +52,89 @@ var (
 	_ io.WriterTo = (*Reader)(nil)
 )
 
-func NewReader(r io.Reader) *Reader {
-	var br = bufio.NewReader(r)
+// The smallest buffer size accepted by [NewReaderSize].
+const MinReaderSize = 512
+
+// Create a reader with the default buffer size of 4 KiB, see [NewReaderSize].
+func NewReader(r io.Reader) *Reader { return NewReaderSize(r, 4096) }
+
+// Create a reader whose internal buffer has at least the given size, as per
+// [bufio.NewReaderSize]. The same size is used for the decompressed data of any
+// compressed segments (see [Reader.ContinueCompressed]). Larger buffers can
+// improve throughput for large archives. Sizes smaller than [MinReaderSize]
+// are increased to it.
+func NewReaderSize(r io.Reader, size int) *Reader {
+	var br = bufio.NewReaderSize(r, max(size, MinReaderSize))
 	return &Reader{
 		r:     r,
 		br:    br,
 		fileR: io.LimitedReader{R: br},
+
+		maxSymlinkSize:  DefaultMaxSymlinkSize,
+		maxFilenameSize: DefaultMaxFilenameSize,
+
+		links:    make(map[uint32][]string),
+		linkData: make(map[uint32]string),
+	}
+}
+
+// Create a reader (see [NewReader]) that, if the input starts with compressed
+// data, immediately continues into it using crs (or the global
+// [CompressReaders] if nil), such that [Reader.Next] yields the headers of an
+// entirely compressed image without the caller needing to call
+// [Reader.ContinueCompressed]. Uncompressed input is read as is.
+//
+// Returns [ErrNoCompressReader] if the leading compression type has no reader,
+// or any error from peeking at the input or creating the decompressor.
+func NewAutoReader(r io.Reader, crs CompressReaderMap) (*Reader, error) {
+	var ir = NewReader(r)
+
+	la, err := PeekLookahead(ir.br)
+	if err != nil {
+		return nil, err
 	}
+
+	if la.Compression() {
+		if _, _, err := ir.ContinueCompressed(crs); err != nil {
+			return nil, err
+		}
+	}
+
+	return ir, nil
+}
+
+// Discard all state and begin reading a new archive from rd, reusing the
+// internal buffer. Settings such as [Reader.SetVerifyChecksum] and the limits
+// are retained. This allows a Reader to be pooled and reused for many archives.
+//
+// Reset must not be called part way through reading an archive that is still
+// needed, as any unread data is discarded.
+func (r *Reader) Reset(rd io.Reader) {
+	r.br.Reset(rd)
+
+	r.r = rd
+	r.nread = 0
+	r.fileR = io.LimitedReader{R: r.br}
+	r.cur = Header{}
+	r.codec = 0
+	r.outer = r.outer[:0]
+
+	clear(r.links)
+	clear(r.linkData)
+
+	r.sumActive = false
+	r.sum.Reset()
+	r.decompressed = 0
+	r.entries = 0
+	r.lastGap = 0
+	r.sawTrailer = false
+}
+
+// Create a reader for an archive confined to length bytes starting at offset
+// off within a larger file, such as an initramfs embedded within a firmware
+// image or a section of an executable. See [io.NewSectionReader].
+func NewSectionReader(r io.ReaderAt, off, length int64) *Reader {
+	return NewReader(io.NewSectionReader(r, off, length))
 }
 
 // Consumes input looking for the next file entry. Returns
@@ -41,17 +150,128 @@ func (r *Reader) Next() (*Header, error) {
 }
 
 // Reads file data up to the length indicated by [Header.DataSize].
-func (r *Reader) Read(buf []byte) (int, error) { return r.fileR.Read(buf) }
+//
+// If checksums are being verified (see [Reader.SetVerifyChecksum]), a
+// [*ChecksumError] is returned upon reading the last of the data if it does not
+// match.
+func (r *Reader) Read(buf []byte) (int, error) {
+	n, err := r.fileR.Read(buf)
+
+	if r.sumActive {
+		r.sum.Write(buf[:n])
+
+		if r.fileR.N == 0 {
+			if err := r.checkSum(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, err
+}
 
 // Copy all remaining current file data to the writer.
 func (r *Reader) WriteTo(w io.Writer) (n int64, err error) {
-	if rem := r.fileR.N; rem == 0 {
-		return 0, io.EOF
-	} else {
-		n, err = io.CopyN(w, r.br, rem)
-		r.fileR.N -= n
-		return
+	return r.WriteToContext(context.Background(), w)
+}
+
+// The default limit on the length of a symlink target, matching the Linux
+// PATH_MAX.
+const DefaultMaxSymlinkSize = 4096
+
+var (
+	ErrSymlinkTooLong = errors.New("initramfs: symlink target exceeds maximum size")
+	ErrNotSymlink     = errors.New("initramfs: current file is not a symlink")
+)
+
+var ErrMissingTrailer = errors.New("initramfs: archive ended without a trailer")
+
+// Returns the current read position, relative to the start of the current
+// (possibly decompressed) stream, as per [Header.HeaderOffset]. While reading
+// the data of a file this advances with each [Reader.Read].
+func (r *Reader) Offset() int64 { return r.nread - r.fileR.N }
+
+// Returns the number of padding bytes that were skipped between the end of the
+// file data of the previous entry (or the start of the current stream) and the
+// most recent header, including the usual alignment to 4 bytes. Together with
+// [Header.HeaderOffset], this allows the layout of an archive to be reproduced
+// exactly.
+func (r *Reader) LastGap() int64 { return r.lastGap }
+
+// Returns the number of bytes of data of the current file that are yet to be
+// read, which are skipped by the next call to [Reader.Next].
+func (r *Reader) FileRemaining() int64 { return r.fileR.N }
+
+// Reports whether the most recent header read was a trailer. Once
+// [Reader.Next] has returned [io.EOF], this distinguishes a complete archive
+// from one that was truncated between entries.
+func (r *Reader) SawTrailer() bool { return r.sawTrailer }
+
+// When enabled, [Reader.Next] returns [ErrMissingTrailer] rather than [io.EOF]
+// if the input ends without the most recent header being a trailer.
+func (r *Reader) SetRequireTrailer(require bool) { r.requireTrailer = require }
+
+// When enabled, [Reader.Next] returns [io.EOF] immediately after yielding the
+// first trailer, ignoring anything that follows, such as leftover alignment
+// bytes or an appended signature that would otherwise result in an
+// [UnexpectedContentError].
+//
+// With images made up of concatenated archives, such as an early microcode
+// archive followed by a compressed main archive, only the first archive is
+// then read, unless [Reader.ContinueUncompressed] is called to move on to the
+// next.
+func (r *Reader) SetStopAtTrailer(stop bool) { r.stopAtTrailer = stop }
+
+// Errors reported by [Reader.Next] in strict mode, see [Reader.SetStrict].
+var (
+	ErrUnexpectedPadding = errors.New("initramfs: unexpected padding between entries")
+	ErrNonZeroPadding    = errors.New("initramfs: alignment padding is not zero")
+)
+
+// When enabled, [Reader.Next] rejects content that the kernel would tolerate
+// but that does not strictly conform to the newc format, returning a
+// [*ValidationError] giving the offset along with:
+//   - [ErrMisalignedHeader] for a header that is not 4 byte aligned
+//   - [ErrUnexpectedPadding] for zero bytes between the entries of an archive,
+//     beyond those needed for alignment (padding after a trailer is allowed)
+//   - [ErrNonZeroPadding] for alignment padding after a filename that is not
+//     zero
+//   - [ErrBadHeaderMagic] for content that starts like a header but has an
+//     unknown magic, rather than an [UnexpectedContentError]
+//
+// Any other error from decoding a header is also returned as a
+// [*ValidationError]. By default the reader is lenient, as is the kernel.
+func (r *Reader) SetStrict(strict bool) { r.strict = strict }
+
+// Sets the maximum FilenameSize of a header that [Reader.Next] will accept,
+// which guards against excessive allocation due to a malformed header; see
+// [DefaultMaxFilenameSize]. Larger values result in [ErrFilenameTooLong].
+func (r *Reader) SetMaxFilenameSize(n int) { r.maxFilenameSize = n }
+
+// Sets the maximum length of a symlink target that [Reader.ReadSymlinkTarget]
+// will accept. See [DefaultMaxSymlinkSize].
+func (r *Reader) SetMaxSymlinkSize(n int) { r.maxSymlinkSize = n }
+
+// Reads the remaining file data of the current symlink entry as its target.
+//
+// Returns [ErrNotSymlink] if the current file is not a symlink, or
+// [ErrSymlinkTooLong] if the remaining data exceeds the maximum symlink size
+// (see [Reader.SetMaxSymlinkSize]), in which case no data is consumed.
+func (r *Reader) ReadSymlinkTarget() (string, error) {
+	if !r.cur.Mode.Symlink() {
+		return "", ErrNotSymlink
+	}
+
+	if r.fileR.N > int64(r.maxSymlinkSize) {
+		return "", ErrSymlinkTooLong
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
 	}
+
+	return string(data), nil
 }
 
 // Provides a sequence iterator that is equivalent to calling [Reader.Next]
@@ -71,7 +291,183 @@ func (r *Reader) All() iter.Seq2[int, Header] {
 	}
 }
 
+// Provides a sequence iterator that is equivalent to [Reader.All], but which
+// yields the same *Header on every step, overwritten with each header in turn,
+// avoiding a copy of each. The header is only valid until the next iteration
+// step, and must be copied if it is to be retained.
+func (r *Reader) AllPtr() iter.Seq[*Header] {
+	return func(yield func(hdr *Header) bool) {
+		var hdr = new(Header)
+		for {
+			if err := r.next(hdr); err != nil {
+				return
+			}
+
+			if !yield(hdr) {
+				return
+			}
+		}
+	}
+}
+
+// Provides a sequence iterator that is equivalent to calling [Reader.Next]
+// until EOF. Unlike [Reader.All], any error other than [io.EOF] that ends the
+// iteration is yielded as the final element (along with an empty header), such
+// as [ErrCompressedContentAhead] or an error due to a malformed or truncated
+// header. Iteration that ends without yielding an error reached the end of the
+// input cleanly.
+func (r *Reader) AllErr() iter.Seq2[Header, error] {
+	return func(yield func(hdr Header, err error) bool) {
+		for {
+			var hdr Header
+			if err := r.next(&hdr); err != nil {
+				if err != io.EOF {
+					yield(Header{}, err)
+				}
+				return
+			}
+
+			if !yield(hdr, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Provides a sequence iterator that is equivalent to [Reader.All], yielding
+// each header along with a reader of its file data, limited to its DataSize.
+// Any data left unread is skipped when iteration continues.
+//
+// The data reader is only valid until the next iteration step, after which it
+// returns [io.EOF].
+func (r *Reader) Files() iter.Seq2[*Header, io.Reader] {
+	return func(yield func(hdr *Header, data io.Reader) bool) {
+		for {
+			var hdr Header
+			if err := r.next(&hdr); err != nil {
+				return
+			}
+
+			if !yield(&hdr, &entryReader{r: r, entry: r.entries}) {
+				return
+			}
+		}
+	}
+}
+
+// Provides a sequence iterator like [Reader.Files], yielding only those
+// entries whose normalized filename (relative, without any leading slashes)
+// matches the pattern, as per [path.Match]. Trailers are never yielded.
+//
+// The data of entries that do not match is skipped, by seeking the input if
+// it is an uncompressed [io.ReadSeeker] (see [Reader.BuildIndex]).
+//
+// Iteration ends at the first error, which includes reaching compressed
+// content and an invalid pattern ([path.ErrBadPattern], checked before any
+// input is read). Use [Reader.GlobErr] to observe such errors.
+func (r *Reader) Glob(pattern string) iter.Seq2[*Header, io.Reader] {
+	return func(yield func(hdr *Header, data io.Reader) bool) {
+		r.glob(pattern, func(hdr *Header, err error) bool {
+			return err == nil && yield(hdr, &entryReader{r: r, entry: r.entries})
+		})
+	}
+}
+
+// Provides a sequence iterator like [Reader.Glob], in the manner of
+// [Reader.AllErr]: each matching header is yielded with a nil error, and its
+// file data may be read from the reader itself. Any error other than [io.EOF]
+// is yielded once (with a nil header) and ends the iteration, such as
+// [path.ErrBadPattern] for an invalid pattern, which is yielded before any
+// input is read.
+func (r *Reader) GlobErr(pattern string) iter.Seq2[*Header, error] {
+	return func(yield func(hdr *Header, err error) bool) {
+		r.glob(pattern, yield)
+	}
+}
+
+func (r *Reader) glob(pattern string, yield func(hdr *Header, err error) bool) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		yield(nil, err)
+		return
+	}
+
+	var s, _ = r.seeker()
+
+	for {
+		var hdr Header
+		if err := r.next(&hdr); err != nil {
+			if err != io.EOF {
+				yield(nil, err)
+			}
+			return
+		}
+
+		if !hdr.Trailer() {
+			// The pattern is known to be valid
+			if matched, _ := path.Match(pattern, normalizeName(hdr.Filename)); matched {
+				if !yield(&hdr, nil) {
+					return
+				}
+				continue
+			}
+		}
+
+		if s != nil && r.fileR.N > 0 {
+			if err := r.seekPastFile(s); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+	}
+}
+
+// Reads the file data of a single entry, see [Reader.Files].
+type entryReader struct {
+	r     *Reader
+	entry int // The entry count of the reader when yielded
+}
+
+func (er *entryReader) Read(p []byte) (int, error) {
+	if er.r.entries != er.entry {
+		return 0, io.EOF
+	}
+	return er.r.Read(p)
+}
+
+// Call fn for every header in the archive, continuing through any compressed
+// segments using the global [CompressReaders]. Returns nil upon reaching the
+// end of the input.
+func (r *Reader) walk(fn func(hdr *Header) error) error {
+	for {
+		hdr, err := r.Next()
+		switch {
+		case err == ErrCompressedContentAhead, err == io.EOF && len(r.outer) > 0:
+			if _, _, err := r.ContinueCompressed(nil); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+			continue
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+
+		if err := fn(hdr); err != nil {
+			return err
+		}
+	}
+}
+
 func (r *Reader) skipUnreadFile() (err error) {
+	if r.sumActive && r.fileR.N > 0 {
+		// The skipped data must still be verified
+		_, err = r.WriteTo(io.Discard)
+		return
+	}
+
 	if n := r.fileR.N; n > 0 {
 		r.fileR.N = 0
 		_, err = r.br.Discard(int(n))
@@ -84,6 +480,12 @@ func (r *Reader) advanceToNextHeader() error {
 		return err
 	}
 
+	if r.stopAtTrailer && r.sawTrailer {
+		return io.EOF
+	}
+
+	var padStart int64 = -1 // Of any excess padding beyond the alignment
+
 Advance:
 	for {
 		peek, err := PeekLookahead(r.br)
@@ -97,33 +499,100 @@ Advance:
 
 		switch peek {
 		case EOF:
+			if r.requireTrailer && !r.sawTrailer {
+				return ErrMissingTrailer
+			}
 			return io.EOF
 
 		case Padding:
+			var start = r.nread
 			if err := r.discardPadding(); err != nil {
 				return err
 			}
+
+			if r.nread > alignUp(start, 4) && padStart < 0 {
+				padStart = alignUp(start, 4)
+			}
 			continue Advance
 
-		case CpioFile:
+		case CpioFile, CpioFileODC:
+			if r.strict {
+				if r.nread%4 != 0 {
+					return &ValidationError{Offset: r.nread, Err: ErrMisalignedHeader}
+				}
+
+				if padStart >= 0 && !r.sawTrailer {
+					return &ValidationError{Offset: padStart, Err: ErrUnexpectedPadding}
+				}
+			}
 			break Advance
 
+		case UnknownLookahead:
+			if r.strict {
+				if peek, _ := r.br.Peek(2); CpioFileMagic.MatchBytes(peek) {
+					return &ValidationError{Offset: r.nread, Err: ErrBadHeaderMagic}
+				}
+			}
+			return r.unexpectedContent()
+
 		default:
-			return errors.New("initramfs: unknown error")
+			return r.unexpectedContent()
 		}
 	}
 
 	return nil
 }
 
+// Unexpected content was found where the [Reader] expected either a header,
+// padding or the start of compressed data.
+type UnexpectedContentError struct {
+	Offset int64  // Offset relative to the start of the current (possibly decompressed) stream
+	Peek   []byte // Up to the first 8 bytes of the unexpected content
+}
+
+func (e *UnexpectedContentError) Error() string {
+	return fmt.Sprintf("initramfs: unexpected content at offset %d: % x", e.Offset, e.Peek)
+}
+
+func (r *Reader) unexpectedContent() error {
+	peek, _ := r.br.Peek(8)
+	return &UnexpectedContentError{
+		Offset: r.nread,
+		Peek:   bytes.Clone(peek),
+	}
+}
+
 func (r *Reader) next(hdr *Header) error {
-	if err := r.advanceToNextHeader(); err != nil {
+	var end = r.nread // Of the previous entry, including its file data
+
+	err := r.advanceToNextHeader()
+
+	// Padding is only ever skipped as zeros
+	if r.raw != nil && r.nread > end {
+		if err := writeZeros(r.raw, r.nread-end); err != nil {
+			return err
+		}
+	}
+
+	if err != nil {
 		return err
 	}
 
+	r.lastGap = r.nread - end
+
+	if r.maxEntries > 0 && r.entries >= r.maxEntries {
+		return ErrLimitExceeded
+	}
+	r.entries++
+
 	var headerOffset = r.nread
 
-	n, err := hdr.ReadFrom(r.br)
+	var in io.Reader = r.br
+	if r.raw != nil {
+		in = io.TeeReader(r.br, r.raw)
+	}
+
+	n, err := hdr.readFromScratch(in, r.maxFilenameSize, &r.scratch)
 	if n > 0 {
 		r.nread += n
 	}
@@ -131,15 +600,33 @@ func (r *Reader) next(hdr *Header) error {
 	hdr.HeaderOffset = headerOffset
 
 	if err != nil {
+		if r.strict && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return &ValidationError{Offset: headerOffset, Err: err}
+		}
 		return err
 	}
 
-	if err := r.discardAlign(4); err != nil {
-		return err
+	// Unlike newc, the odc format has no alignment padding
+	if hdr.Magic != Magic_070707 {
+		if r.strict {
+			if err := r.checkZeroAlign(4); err != nil {
+				return err
+			}
+		}
+
+		if err := r.discardAlign(4); err != nil {
+			return err
+		}
 	}
 
 	hdr.DataOffset = r.nread
 	r.fileR.N = int64(hdr.DataSize)
+	r.cur = *hdr
+	r.sawTrailer = hdr.Trailer()
+	r.trackHardLink(hdr)
+
+	r.sumActive = r.verifyChecksum && hdr.Magic == Magic_070702 && hdr.Mode.File() && hdr.DataSize > 0
+	r.sum.Reset()
 
 	// Assume file has already been read for the purposes of tracking current read position
 	r.nread += r.fileR.N
@@ -147,12 +634,137 @@ func (r *Reader) next(hdr *Header) error {
 	return nil
 }
 
+// Scan forward from the current position to the next valid header (one whose
+// fixed fields all decode successfully) or the start of compressed data,
+// returning the number of bytes that were skipped. Any unread data of the
+// current file is skipped first, without being scanned or counted as skipped.
+//
+// This allows for recovering from an error returned by [Reader.Next] in the
+// middle of a corrupted archive, after which [Reader.Next] can be called
+// again. Returns [io.EOF] if the end of the input was reached first.
+func (r *Reader) Resync() (skipped int64, err error) {
+	// The unread data is already accounted for in the offset, and is not
+	// verified against any checksum, since it is being abandoned
+	r.sumActive = false
+	if err := r.skipUnreadFile(); err != nil {
+		return 0, err
+	}
+
+	for {
+		peek, err := r.br.Peek(r.br.Size())
+		if len(peek) == 0 {
+			return skipped, err
+		}
+
+		var n int
+		for ; n < len(peek); n++ {
+			// Wait for more data before deciding about a possible header
+			if err == nil && len(peek)-n < HeaderSize {
+				break
+			}
+
+			if validResyncPoint(peek[n:]) {
+				if err := r.discard(int64(n)); err != nil {
+					return skipped, err
+				}
+				return skipped + int64(n), nil
+			}
+		}
+
+		if err := r.discard(int64(n)); err != nil {
+			return skipped, err
+		}
+		skipped += int64(n)
+
+		if err != nil && n == len(peek) {
+			return skipped, err
+		}
+	}
+}
+
+// Reports whether p starts with a header that can be decoded, or with the magic
+// value of a compressed data stream.
+func validResyncPoint(p []byte) bool {
+	if len(p) >= HeaderSize && (bytes.HasPrefix(p, magic_070701) || bytes.HasPrefix(p, magic_070702)) {
+		var (
+			text rawTextHeader
+			bin  rawBinaryHeader
+		)
+		copy(text[:], p)
+		return text.toBinary(&bin) == nil
+	}
+
+	if len(p) >= HeaderSizeODC && bytes.HasPrefix(p, magic_070707) {
+		var (
+			odc rawODCHeader
+			hdr Header
+		)
+		copy(odc[:], p)
+		return hdr.fromODC(&odc) == nil
+	}
+
+	// The same checks as PeekLookahead, as some magic values are weak
+	la, err := lookahead(func(n int) ([]byte, error) {
+		if n > len(p) {
+			return p, io.EOF
+		}
+		return p[:n], nil
+	})
+
+	return err == nil && la.Compression()
+}
+
+// Attempt to continue reader into a further uncompressed archive concatenated
+// after the current one, such as once [Reader.Next] has returned [io.EOF] at a
+// trailer due to [Reader.SetStopAtTrailer]. Any unread file data and padding
+// are skipped, and if a header or compressed content follows, the state of the
+// previous archive (its trailer and hard links, see [Reader.HardLinkGroups]) is
+// discarded, such that [Reader.Next] resumes with the next archive. Offsets
+// continue to be relative to the start of the current stream.
+//
+// Returns false if compressed content follows instead, which may then be read
+// with [Reader.ContinueCompressed]. Returns [io.EOF] at the end of the input,
+// or an [UnexpectedContentError] if anything else follows.
+func (r *Reader) ContinueUncompressed() (isArchive bool, err error) {
+	if err := r.skipUnreadFile(); err != nil {
+		return false, err
+	}
+
+	if err := r.discardPadding(); err != nil {
+		return false, err
+	}
+
+	la, err := PeekLookahead(r.br)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case la == EOF:
+		return false, io.EOF
+	case !la.Compression() && la != CpioFile && la != CpioFileODC:
+		return false, r.unexpectedContent()
+	}
+
+	clear(r.links)
+	clear(r.linkData)
+	r.sawTrailer = false
+
+	return !la.Compression(), nil
+}
+
 var ErrCompressedContentAhead = errors.New("initramfs: compressed content ahead")
 
 var ErrNoCompressReader = errors.New("initramfs: no suitable CompressReader found")
 
 // Attempt to continue reader into the start of a compressed data stream.
 //
+// If the current compressed segment has been read to its end, reading resumes
+// from the input that follows it, such that any padding and further segments
+// may be read. This relies upon the decompressor not reading beyond the end of
+// its stream, as is the case with [GzipReader]. Offsets are then relative to
+// the start of that input once more.
+//
 // Returns [ErrNoCompressReader] if the [CompressReaderMap] does not contain a
 // suitable reader for the encountered compression type.
 func (r *Reader) ContinueCompressed(compressReaders CompressReaderMap) (isCompressed bool, compressType Lookahead, err error) {
@@ -161,18 +773,21 @@ func (r *Reader) ContinueCompressed(compressReaders CompressReaderMap) (isCompre
 		return
 	}
 
-	err = r.discardPadding()
-	if err != nil {
-		return
-	}
+	for {
+		if err = r.discardPadding(); err == nil {
+			compressType, err = PeekLookahead(r.br)
+		}
 
-	compressType, err = PeekLookahead(r.br)
-	if err != nil {
-		return
+		if err == nil && compressType == EOF {
+			err = io.EOF
+		}
+
+		if err != io.EOF || !r.popOuter() {
+			break
+		}
 	}
 
-	if compressType == EOF {
-		err = io.EOF
+	if err != nil {
 		return
 	}
 
@@ -192,17 +807,89 @@ func (r *Reader) ContinueCompressed(compressReaders CompressReaderMap) (isCompre
 		return
 	}
 
-	var dr io.Reader
-	dr, err = dec(r.br)
+	var (
+		consumed = &byteCounter{br: r.br}
+		dr       io.Reader
+	)
+
+	dr, err = dec(consumed)
 	if err != nil {
 		return
 	}
 
+	r.outer = append(r.outer, outerStream{r: r.r, br: r.br, nread: r.nread, codec: r.codec, consumed: consumed})
+
 	r.r = dr
-	r.br = bufio.NewReader(dr)
+	r.br = bufio.NewReaderSize(decompressedCounter{dr, r}, r.br.Size())
 	r.fileR.R = r.br
 	r.nread = 0
+	r.codec = compressType
+
+	return
+}
+
+// The state of the stream enclosing a compressed segment, to be restored once
+// the end of the segment is reached.
+type outerStream struct {
+	r        io.Reader
+	br       *bufio.Reader
+	nread    int64 // At the start of the compressed data
+	codec    Lookahead
+	consumed *byteCounter
+}
+
+// Resume reading the stream enclosing the current compressed segment, if any.
+func (r *Reader) popOuter() bool {
+	if len(r.outer) == 0 {
+		return false
+	}
+
+	var s = r.outer[len(r.outer)-1]
+	r.outer = r.outer[:len(r.outer)-1]
+
+	r.r = s.r
+	r.br = s.br
+	r.fileR.R = r.br
+	r.nread = s.nread + s.consumed.n
+	r.codec = s.codec
+
+	return true
+}
+
+// Counts the compressed bytes consumed by a decompressor, while still allowing
+// it to read byte by byte (see [compress/flate.Reader]) so that it does not
+// read beyond the end of its stream.
+type byteCounter struct {
+	br *bufio.Reader
+	n  int64
+}
+
+func (bc *byteCounter) Read(p []byte) (int, error) {
+	n, err := bc.br.Read(p)
+	bc.n += int64(n)
+	return n, err
+}
+
+func (bc *byteCounter) ReadByte() (byte, error) {
+	b, err := bc.br.ReadByte()
+	if err == nil {
+		bc.n++
+	}
+	return b, err
+}
 
+// Returns the compression type of the segment currently being read, or
+// [UnknownLookahead] if it is uncompressed. This changes after each successful
+// call to [Reader.ContinueCompressed].
+func (r *Reader) CurrentCodec() Lookahead { return r.codec }
+
+// Returns the original filename and modification time recorded in the header
+// of the current compressed segment, if any. Only gzip streams (as read by
+// [GzipReader]) carry this metadata, and ok will be false otherwise.
+func (r *Reader) CompressionMetadata() (name string, mtime time.Time, ok bool) {
+	if zr, isGzip := r.r.(*gzip.Reader); isGzip {
+		return zr.Name, zr.ModTime, true
+	}
 	return
 }
 
@@ -218,10 +905,12 @@ func (r *Reader) discard(n int64) error {
 
 func (r *Reader) discardPadding() error {
 	for {
-		const N = 64
+		const N = 64 // Always fits within the buffer, see MinReaderSize
 
+		// Near the end of the stream fewer bytes may be available, which are
+		// still scanned for zeros
 		peek, err := r.br.Peek(N)
-		if err != nil {
+		if err != nil && (err != io.EOF || len(peek) == 0) {
 			return err
 		}
 
@@ -246,10 +935,38 @@ func (r *Reader) discardPadding() error {
 	return nil
 }
 
+// Return a [*ValidationError] if the padding up to the next multiple of n
+// contains any non-zero bytes.
+func (r *Reader) checkZeroAlign(n int) error {
+	peek, _ := r.br.Peek(int(alignFill(r.nread, int64(n))))
+	for i, b := range peek {
+		if b != 0 {
+			return &ValidationError{Offset: r.nread + int64(i), Err: ErrNonZeroPadding}
+		}
+	}
+	return nil
+}
+
 func (r *Reader) discardAlign(n int) error {
-	var n64 = int64(n)
-	if rem := r.nread % n64; rem > 0 {
-		return r.discard(n64 - rem)
+	var fill = alignFill(r.nread, int64(n))
+
+	if r.raw != nil && fill > 0 {
+		k, err := io.CopyN(r.raw, r.br, fill)
+		r.nread += k
+		return err
+	}
+
+	return r.discard(fill)
+}
+
+// Write n zero bytes to w.
+func writeZeros(w io.Writer, n int64) error {
+	for n > 0 {
+		k, err := w.Write(zeroPadding[:min(n, int64(len(zeroPadding)))])
+		if err != nil {
+			return err
+		}
+		n -= int64(k)
 	}
 	return nil
 }
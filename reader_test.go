@@ -0,0 +1,1085 @@
+package initramfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReader_ReadSymlinkTarget(t *testing.T) {
+	const target = "/bin/busybox"
+
+	t.Run("ok", func(t *testing.T) {
+		w, r := testWriterReader(t)
+
+		var hdr = Header{
+			Mode:     Mode_Symlink | 0o777,
+			DataSize: uint32(len(target)),
+			Filename: "sh",
+		}
+		testWriteHeader(t, w, &hdr)
+		w.Write([]byte(target))
+
+		testNextNamed(t, r, ".")
+		testNextNamed(t, r, "sh")
+
+		got, err := r.ReadSymlinkTarget()
+		if err != nil {
+			t.Fatalf("ReadSymlinkTarget: %s", err)
+		}
+
+		if got != target {
+			t.Errorf("expected %q, got %q", target, got)
+		}
+	})
+
+	t.Run("too long", func(t *testing.T) {
+		w, r := testWriterReader(t)
+
+		var long = strings.Repeat("a", DefaultMaxSymlinkSize+1)
+
+		var hdr = Header{
+			Mode:     Mode_Symlink | 0o777,
+			DataSize: uint32(len(long)),
+			Filename: "long",
+		}
+		testWriteHeader(t, w, &hdr)
+		w.Write([]byte(long))
+
+		testNextNamed(t, r, ".")
+		testNextNamed(t, r, "long")
+
+		if _, err := r.ReadSymlinkTarget(); err != ErrSymlinkTooLong {
+			t.Fatalf("expected ErrSymlinkTooLong, got %v", err)
+		}
+
+		r.SetMaxSymlinkSize(len(long))
+
+		if got, err := r.ReadSymlinkTarget(); err != nil {
+			t.Fatalf("ReadSymlinkTarget: %s", err)
+		} else if got != long {
+			t.Errorf("expected target of length %d, got %d", len(long), len(got))
+		}
+	})
+
+	t.Run("not symlink", func(t *testing.T) {
+		w, r := testWriterReader(t)
+
+		testMkdirHeader(t, w, "dir", nil)
+
+		testNextNamed(t, r, ".")
+
+		if _, err := r.ReadSymlinkTarget(); err != ErrNotSymlink {
+			t.Fatalf("expected ErrNotSymlink, got %v", err)
+		}
+	})
+}
+
+func TestReader_UnexpectedContent(t *testing.T) {
+	var b bytes.Buffer
+
+	w := NewWriter(&b)
+	testMkdirHeader(t, w, "dir", nil)
+
+	var offset = int64(b.Len())
+	b.WriteString("garbage!!")
+
+	var r = NewReader(&b)
+	testNextNamed(t, r, ".")
+	testNextNamed(t, r, "dir")
+
+	_, err := r.Next()
+
+	var uce *UnexpectedContentError
+	if !errors.As(err, &uce) {
+		t.Fatalf("expected UnexpectedContentError, got %v", err)
+	}
+
+	if uce.Offset != offset {
+		t.Errorf("expected offset %d, got %d", offset, uce.Offset)
+	}
+
+	if expect := []byte("garbage!"); !bytes.Equal(uce.Peek, expect) {
+		t.Errorf("expected peek %q, got %q", expect, uce.Peek)
+	}
+}
+
+func TestReader_CompressionMetadata(t *testing.T) {
+	var (
+		b     bytes.Buffer
+		zw    = gzip.NewWriter(&b)
+		mtime = time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	)
+
+	zw.Name = "foo.cpio"
+	zw.ModTime = mtime
+
+	w := NewWriter(zw)
+	testMkdirHeader(t, w, "dir", nil)
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	var r = NewReader(&b)
+
+	if _, _, ok := r.CompressionMetadata(); ok {
+		t.Fatal("expected no metadata before compressed segment")
+	}
+
+	if _, err := r.Next(); err != ErrCompressedContentAhead {
+		t.Fatalf("expected ErrCompressedContentAhead, got %v", err)
+	}
+
+	if _, _, err := r.ContinueCompressed(nil); err != nil {
+		t.Fatalf("ContinueCompressed: %s", err)
+	}
+
+	name, got, ok := r.CompressionMetadata()
+	if !ok {
+		t.Fatal("expected gzip metadata")
+	}
+
+	if name != "foo.cpio" {
+		t.Errorf("expected name foo.cpio, got %s", name)
+	}
+
+	if !got.Equal(mtime) {
+		t.Errorf("expected mtime %s, got %s", mtime, got)
+	}
+
+	testNextNamed(t, r, ".")
+}
+
+func TestReader_Resync(t *testing.T) {
+	var b bytes.Buffer
+
+	w := NewWriter(&b)
+	for _, name := range []string{"a", "b", "c"} {
+		testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, DataSize: 4, Filename: name})
+		w.Write([]byte(strings.Repeat(name, 4)))
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var (
+		data = b.Bytes()
+		hdrs headerList
+	)
+
+	hdrs.readAll(NewReader(bytes.NewReader(data)))
+	if len(hdrs) != 5 || hdrs[2].Filename != "b" {
+		t.Fatalf("unexpected archive layout: %v", hdrs)
+	}
+
+	// Corrupt the mode field of the header for "b"
+	data[hdrs[2].HeaderOffset+6+8] = 'Z'
+
+	var r = NewReader(bytes.NewReader(data))
+	testNextNamed(t, r, ".")
+	testNextNamed(t, r, "a")
+
+	var ibe *InvalidByteError
+	if _, err := r.Next(); !errors.As(err, &ibe) {
+		t.Fatalf("expected InvalidByteError, got %v", err)
+	}
+
+	skipped, err := r.Resync()
+	if err != nil {
+		t.Fatalf("Resync: %s", err)
+	}
+
+	if expect := hdrs[3].HeaderOffset - (hdrs[2].HeaderOffset + HeaderSize); skipped != expect {
+		t.Errorf("expected %d bytes skipped, got %d", expect, skipped)
+	}
+
+	testNextNamed(t, r, "c")
+	testNextNamed(t, r, TrailerFilename)
+
+	if skipped, err := r.Resync(); err != io.EOF {
+		t.Errorf("expected EOF, got %v after skipping %d", err, skipped)
+	}
+}
+
+func TestReader_ResyncSkipsFileData(t *testing.T) {
+	// File data that itself looks like an archive must not be resynced into
+	var nested bytes.Buffer
+
+	nw := NewWriter(&nested)
+	if err := nw.WriteFile("inner", 0o644, []byte("inner")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := nw.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var b bytes.Buffer
+
+	w := NewWriter(&b)
+	if err := w.WriteFile("nested.cpio", 0o644, nested.Bytes()); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteFile("after", 0o644, []byte("after")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var r = NewReader(bytes.NewReader(b.Bytes()))
+	testNextNamed(t, r, ".")
+	hdr := testNextNamed(t, r, "nested.cpio")
+
+	skipped, err := r.Resync()
+	if err != nil {
+		t.Fatalf("Resync: %s", err)
+	}
+	if skipped != 0 {
+		t.Errorf("expected nothing skipped beyond the file data, got %d", skipped)
+	}
+
+	var end = hdr.DataOffset + int64(hdr.DataSize)
+	if off := r.Offset(); off != alignUp(end, 4) {
+		t.Errorf("expected offset %d after Resync, got %d", alignUp(end, 4), off)
+	}
+
+	after := testNextNamed(t, r, "after")
+	if after.HeaderOffset != alignUp(end, 4) {
+		t.Errorf("expected header at offset %d, got %d", alignUp(end, 4), after.HeaderOffset)
+	}
+}
+
+func TestReader_ResyncLzma(t *testing.T) {
+	// A weak LZMA magic is only a resync point if the rest of its header is
+	// plausible
+	var (
+		bogus = []byte{0x5d, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}
+		lzma  = []byte{0x5d, 0x00, 0x00, 0x80, 0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	)
+
+	for _, tc := range []struct {
+		name   string
+		lead   []byte
+		expect int64
+	}{
+		{"bogus", bogus, int64(len("garbage!") + len(bogus))},
+		{"plausible", lzma, int64(len("garbage!"))},
+	} {
+		var b bytes.Buffer
+		b.WriteString("garbage!")
+		b.Write(tc.lead)
+
+		w := NewWriter(&b)
+		testMkdirHeader(t, w, "dir", nil)
+
+		var r = NewReader(&b)
+
+		if _, err := r.Next(); err == nil {
+			t.Fatalf("%s: expected an error for the leading garbage", tc.name)
+		}
+
+		// Resync scans from where the failed header started
+		if skipped, err := r.Resync(); err != nil {
+			t.Fatalf("%s: Resync: %s", tc.name, err)
+		} else if off := r.Offset(); off != tc.expect {
+			t.Errorf("%s: expected to resync at offset %d, got %d after skipping %d", tc.name, tc.expect, off, skipped)
+		}
+	}
+}
+
+func TestReader_AllErr(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	testMkdirHeader(t, w, "etc", nil)
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var collect = func(r *Reader) (names []string, errs []error) {
+		for hdr, err := range r.AllErr() {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			names = append(names, hdr.Filename)
+		}
+		return
+	}
+
+	t.Run("clean", func(t *testing.T) {
+		names, errs := collect(NewReader(bytes.NewReader(buf.Bytes())))
+
+		if len(errs) != 0 {
+			t.Errorf("expected no errors, got %v", errs)
+		}
+		if len(names) != 3 {
+			t.Errorf("expected 3 headers, got %v", names)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		var raw = buf.Bytes()
+
+		// Cut off part way through the trailer header
+		names, errs := collect(NewReader(bytes.NewReader(raw[:len(raw)-HeaderSize])))
+
+		if len(names) != 2 {
+			t.Errorf("expected 2 headers, got %v", names)
+		}
+		if len(errs) != 1 {
+			t.Fatalf("expected 1 error, got %v", errs)
+		}
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		w := NewWriter(&buf)
+		testMkdirHeader(t, w, "etc", nil)
+		if err := w.StartCompression(GzipWriter); err != nil {
+			t.Fatalf("StartCompression: %s", err)
+		}
+		testMkdirHeader(t, w, "usr", nil)
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %s", err)
+		}
+
+		_, errs := collect(NewReader(&buf))
+
+		if len(errs) != 1 || errs[0] != ErrCompressedContentAhead {
+			t.Errorf("expected ErrCompressedContentAhead, got %v", errs)
+		}
+	})
+}
+
+func TestNewSectionReader(t *testing.T) {
+	var archive bytes.Buffer
+
+	w := NewWriter(&archive)
+	if err := w.WriteFile("init", 0o755, []byte("#!/bin/sh\n")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	// Surround the archive with other content, which is not zero padding
+	var (
+		prefix    = bytes.Repeat([]byte{0xee}, 1234)
+		suffix    = bytes.Repeat([]byte{0xff}, 100)
+		container = slices.Concat(prefix, archive.Bytes(), suffix)
+	)
+
+	r := NewSectionReader(bytes.NewReader(container), int64(len(prefix)), int64(archive.Len()))
+
+	var hdrs headerList
+	for hdr, err := range r.AllErr() {
+		if err != nil {
+			t.Fatalf("AllErr: %s", err)
+		}
+		hdrs = append(hdrs, hdr)
+	}
+
+	hdrs.expectNames(t, ".", "init", TrailerFilename)
+}
+
+func TestReader_Reset(t *testing.T) {
+	var archive = func(name string) *bytes.Buffer {
+		var buf bytes.Buffer
+
+		w := NewWriter(&buf)
+		if err := w.WriteFile(name, 0o644, []byte(name)); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+
+		return &buf
+	}
+
+	r := NewReader(archive("first"))
+	testNextNamed(t, r, ".")
+	testNextNamed(t, r, "first")
+
+	r.Reset(archive("second"))
+
+	var hdrs headerList
+	hdrs.readAll(r)
+	hdrs.expectNames(t, ".", "second", TrailerFilename)
+}
+
+func TestNewReaderSize(t *testing.T) {
+	if r := NewReaderSize(bytes.NewReader(nil), 1); r.br.Size() != MinReaderSize {
+		t.Errorf("expected minimum buffer size %d, got %d", MinReaderSize, r.br.Size())
+	}
+
+	const size = 256 << 10
+
+	r := NewReaderSize(testdataReader(t, "testdata/data.cpio.gz"), size)
+
+	if _, err := r.Next(); err != ErrCompressedContentAhead {
+		t.Fatalf("expected ErrCompressedContentAhead, got %v", err)
+	}
+	if _, _, err := r.ContinueCompressed(nil); err != nil {
+		t.Fatalf("ContinueCompressed: %s", err)
+	}
+
+	if r.br.Size() != size {
+		t.Errorf("expected decompressed buffer size %d, got %d", size, r.br.Size())
+	}
+
+	var hdrs headerList
+	hdrs.readAll(r)
+	hdrs.expectNames(t, "helloworld.txt", TrailerFilename)
+}
+
+func TestReader_ShortTrailingPadding(t *testing.T) {
+	for _, pad := range []int{1, 8, 63, 64, 65, 200} {
+		var buf bytes.Buffer
+
+		w := NewWriter(&buf)
+		if err := w.WriteFile("init", 0o755, []byte("#!/bin/sh\n")); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+		buf.Write(make([]byte, pad))
+
+		r := NewReader(&buf)
+
+		var hdrs headerList
+		hdrs.readAll(r)
+		hdrs.expectNames(t, ".", "init", TrailerFilename)
+
+		if _, err := r.Next(); err != io.EOF {
+			t.Errorf("%d bytes of padding: expected EOF, got %v", pad, err)
+		}
+		if _, _, err := r.ContinueCompressed(nil); err != io.EOF {
+			t.Errorf("%d bytes of padding: ContinueCompressed expected EOF, got %v", pad, err)
+		}
+	}
+}
+
+func TestReader_ShortPaddingBeforeCompressed(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	// Fewer than 64 bytes follow the start of the padding
+	buf.Write(make([]byte, 8))
+	buf.Write([]byte{0x28, 0xb5, 0x2f, 0xfd})
+
+	r := NewReader(&buf)
+	testNextNamed(t, r, TrailerFilename)
+
+	if _, err := r.Next(); err != ErrCompressedContentAhead {
+		t.Fatalf("expected ErrCompressedContentAhead, got %v", err)
+	}
+}
+
+func TestReader_SawTrailer(t *testing.T) {
+	for _, trailer := range []bool{true, false} {
+		var buf bytes.Buffer
+
+		w := NewWriter(&buf)
+		if err := w.WriteFile("init", 0o755, []byte("#!/bin/sh\n")); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+		if trailer {
+			if err := w.WriteTrailer(); err != nil {
+				t.Fatalf("WriteTrailer: %s", err)
+			}
+		}
+
+		var raw = buf.Bytes()
+
+		r := NewReader(bytes.NewReader(raw))
+		for range r.All() {
+		}
+		if r.SawTrailer() != trailer {
+			t.Errorf("trailer %v: SawTrailer returned %v", trailer, r.SawTrailer())
+		}
+
+		var expect = io.EOF
+		if !trailer {
+			expect = ErrMissingTrailer
+		}
+
+		r = NewReader(bytes.NewReader(raw))
+		r.SetRequireTrailer(true)
+		for {
+			if _, err := r.Next(); err != nil {
+				if err != expect {
+					t.Errorf("trailer %v: expected %v, got %v", trailer, expect, err)
+				}
+				break
+			}
+		}
+	}
+}
+
+func TestReader_SetStopAtTrailer(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	if err := w.WriteFile("init", 0o755, []byte("#!/bin/sh\n")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	buf.WriteString("SIGNATURE")
+
+	for _, stop := range []bool{false, true} {
+		var (
+			r    = NewReader(bytes.NewReader(buf.Bytes()))
+			hdrs headerList
+			err  error
+		)
+
+		r.SetStopAtTrailer(stop)
+
+		for {
+			var hdr *Header
+			if hdr, err = r.Next(); err != nil {
+				break
+			}
+			hdrs = append(hdrs, *hdr)
+		}
+
+		hdrs.expectNames(t, ".", "init", TrailerFilename)
+
+		var unexpected *UnexpectedContentError
+		if stop && err != io.EOF {
+			t.Errorf("stop: expected io.EOF, got %v", err)
+		} else if !stop && !errors.As(err, &unexpected) {
+			t.Errorf("expected UnexpectedContentError, got %v", err)
+		}
+	}
+}
+
+func TestReader_SetStrict(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	for _, name := range []string{"a", "bb"} {
+		if err := w.WriteFile(name, 0o644, []byte("x")); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var (
+		raw    = buf.Bytes()
+		offset int64 // Of the "bb" header
+	)
+
+	for _, hdr := range NewReader(bytes.NewReader(raw)).All() {
+		if hdr.Filename == "bb" {
+			offset = hdr.HeaderOffset
+		}
+	}
+
+	var splice = func(insert []byte) []byte {
+		return slices.Concat(raw[:offset], insert, raw[offset:])
+	}
+
+	var nonZero = bytes.Clone(raw)
+	nonZero[offset+HeaderSize+3] = 'X'
+
+	var badMagic = bytes.Clone(raw)
+	copy(badMagic[offset:], "070709")
+
+	for _, tc := range []struct {
+		name    string
+		raw     []byte
+		offset  int64
+		err     error
+		lenient bool // Whether the default lenient reader accepts it
+	}{
+		{"well-formed", raw, 0, nil, true},
+		{"misaligned", splice([]byte{0, 0}), offset + 2, ErrMisalignedHeader, false},
+		{"excess padding", splice([]byte{0, 0, 0, 0}), offset, ErrUnexpectedPadding, true},
+		{"non-zero padding", nonZero, offset + HeaderSize + 3, ErrNonZeroPadding, true},
+		{"bad magic", badMagic, offset, ErrBadHeaderMagic, false},
+	} {
+		for _, strict := range []bool{false, true} {
+			var (
+				r   = NewReader(bytes.NewReader(tc.raw))
+				err error
+			)
+
+			r.SetStrict(strict)
+			r.SetRequireTrailer(true)
+
+			for err == nil {
+				_, err = r.Next()
+			}
+
+			if !strict {
+				if (err == io.EOF) != tc.lenient {
+					t.Errorf("%s: lenient: unexpected error %v", tc.name, err)
+				}
+				continue
+			}
+
+			if tc.err == nil {
+				if err != io.EOF {
+					t.Errorf("%s: expected io.EOF, got %v", tc.name, err)
+				}
+				continue
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) || !errors.Is(err, tc.err) {
+				t.Errorf("%s: expected ValidationError with %v, got %v", tc.name, tc.err, err)
+			} else if verr.Offset != tc.offset {
+				t.Errorf("%s: expected offset %d, got %d", tc.name, tc.offset, verr.Offset)
+			}
+		}
+	}
+}
+
+func TestReader_Files(t *testing.T) {
+	var files = map[string]string{
+		"etc/hostname": "initramfs\n",
+		"init":         "#!/bin/sh\n",
+		"skipped":      "never read",
+	}
+
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	for _, name := range []string{"etc/hostname", "skipped", "init"} {
+		if err := w.WriteFile(name, 0o644, []byte(files[name])); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var (
+		r     = NewReader(&buf)
+		hdrs  headerList
+		stale io.Reader
+	)
+
+	for hdr, data := range r.Files() {
+		hdrs = append(hdrs, *hdr)
+
+		if stale != nil {
+			if n, err := stale.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+				t.Errorf("%s: stale reader returned %d, %v", hdr.Filename, n, err)
+			}
+		}
+		stale = data
+
+		if !hdr.Mode.File() || hdr.Filename == "skipped" {
+			continue
+		}
+
+		if got, err := io.ReadAll(data); err != nil || string(got) != files[hdr.Filename] {
+			t.Errorf("%s: unexpected data %q (%v)", hdr.Filename, got, err)
+		}
+	}
+
+	hdrs.expectNames(t, ".", "etc", "etc/hostname", "skipped", "init", TrailerFilename)
+}
+
+func TestReader_Offset(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	if err := w.WriteFile("data", 0o644, []byte("0123456789")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	if r.Offset() != 0 || r.FileRemaining() != 0 {
+		t.Errorf("expected 0, 0 initially, got %d, %d", r.Offset(), r.FileRemaining())
+	}
+
+	testNextNamed(t, r, ".")
+	var hdr = testNextNamed(t, r, "data")
+
+	if r.Offset() != hdr.DataOffset || r.FileRemaining() != 10 {
+		t.Errorf("expected %d, 10, got %d, %d", hdr.DataOffset, r.Offset(), r.FileRemaining())
+	}
+
+	if _, err := io.ReadFull(r, make([]byte, 4)); err != nil {
+		t.Fatalf("ReadFull: %s", err)
+	}
+
+	if r.Offset() != hdr.DataOffset+4 || r.FileRemaining() != 6 {
+		t.Errorf("expected %d, 6, got %d, %d", hdr.DataOffset+4, r.Offset(), r.FileRemaining())
+	}
+}
+
+func TestReader_AllPtr(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	for _, name := range []string{"etc/hostname", "init"} {
+		if err := w.WriteFile(name, 0o644, []byte(name)); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var (
+		r    = NewReader(&buf)
+		hdrs headerList
+		prev *Header
+	)
+
+	for hdr := range r.AllPtr() {
+		if prev != nil && hdr != prev {
+			t.Errorf("expected the same *Header on each step")
+		}
+		prev = hdr
+
+		hdrs = append(hdrs, *hdr)
+
+		if hdr.Mode.File() && hdr.Filename != TrailerFilename {
+			if data, err := io.ReadAll(r); err != nil || string(data) != hdr.Filename {
+				t.Errorf("%s: unexpected data %q (%v)", hdr.Filename, data, err)
+			}
+		}
+	}
+
+	hdrs.expectNames(t, ".", "etc", "etc/hostname", "init", TrailerFilename)
+}
+
+// An archive resembling a tree of kernel modules, with many small entries.
+func benchmarkArchive(b *testing.B) []byte {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	for i := range 10000 {
+		var name = fmt.Sprintf("lib/modules/6.1.0/kernel/drivers/d%d/m%d.ko", i/100, i)
+		if err := w.WriteFile(name, 0o644, []byte("module")); err != nil {
+			b.Fatalf("WriteFile: %s", err)
+		}
+	}
+	if err := w.WriteTrailer(); err != nil {
+		b.Fatalf("WriteTrailer: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+func BenchmarkReader_All(b *testing.B) {
+	var (
+		raw = benchmarkArchive(b)
+		r   = NewReader(bytes.NewReader(raw))
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		r.Reset(bytes.NewReader(raw))
+		for range r.All() {
+		}
+	}
+}
+
+func BenchmarkReader_AllPtr(b *testing.B) {
+	var (
+		raw = benchmarkArchive(b)
+		r   = NewReader(bytes.NewReader(raw))
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		r.Reset(bytes.NewReader(raw))
+		for range r.AllPtr() {
+		}
+	}
+}
+
+func TestReader_LastGap(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	if err := w.WriteFile("a", 0o644, []byte("x")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.SetHeaderAlignment(512); err != nil {
+		t.Fatalf("SetHeaderAlignment: %s", err)
+	}
+	if err := w.WriteFile("b", 0o644, []byte("y")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	var (
+		r   = NewReader(bytes.NewReader(buf.Bytes()))
+		end int64 // Of the previous entry
+	)
+
+	for _, expect := range []string{".", "a", "b"} {
+		var hdr = testNextNamed(t, r, expect)
+
+		if gap := hdr.HeaderOffset - end; r.LastGap() != gap {
+			t.Errorf("%s: expected gap %d, got %d", expect, gap, r.LastGap())
+		}
+
+		end = hdr.DataOffset + int64(hdr.DataSize)
+	}
+
+	if r.LastGap() != 512-(2*(HeaderSize+2)+1) {
+		t.Errorf("expected the header alignment as the gap, got %d", r.LastGap())
+	}
+}
+
+func TestReader_ContinueUncompressed(t *testing.T) {
+	var buf bytes.Buffer
+
+	for _, name := range []string{"first", "second"} {
+		w := NewWriter(&buf)
+		w.SetTrailerPadding(512)
+
+		if err := w.WriteFile(name, 0o644, []byte(name)); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+	}
+
+	w := NewWriter(&buf)
+	if err := w.StartCompressionType(Gzip); err != nil {
+		t.Fatalf("StartCompressionType: %s", err)
+	}
+	if err := w.WriteFile("third", 0o644, []byte("third")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	var r = NewReader(&buf)
+	r.SetStopAtTrailer(true)
+
+	for _, name := range []string{"first", "second"} {
+		var hdrs headerList
+		hdrs.readAll(r)
+		hdrs.expectNames(t, ".", name, TrailerFilename)
+
+		if _, err := r.Next(); err != io.EOF {
+			t.Errorf("%s: expected io.EOF once stopped, got %v", name, err)
+		}
+
+		isArchive, err := r.ContinueUncompressed()
+		if err != nil {
+			t.Fatalf("%s: ContinueUncompressed: %s", name, err)
+		}
+
+		// The compressed segment follows the second archive
+		if expect := name == "first"; isArchive != expect {
+			t.Errorf("%s: expected %v, got %v", name, expect, isArchive)
+		}
+
+		if r.SawTrailer() {
+			t.Errorf("%s: trailer state not reset", name)
+		}
+	}
+
+	if _, _, err := r.ContinueCompressed(nil); err != nil {
+		t.Fatalf("ContinueCompressed: %s", err)
+	}
+
+	var hdrs headerList
+	hdrs.readAll(r)
+	hdrs.expectNames(t, ".", "third")
+
+	if _, err := r.ContinueUncompressed(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+// Counts the bytes read from a seekable input.
+type countingReadSeeker struct {
+	io.ReadSeeker
+	n int64
+}
+
+func (c *countingReadSeeker) Read(p []byte) (int, error) {
+	n, err := c.ReadSeeker.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestReader_Glob(t *testing.T) {
+	raw, err := Build(func(iw *Writer) error {
+		if err := iw.WriteFile("boot/vmlinuz", 0o644, make([]byte, 1<<20)); err != nil {
+			return err
+		}
+		for _, name := range []string{"lib/modules/a.ko", "lib/modules/b.ko", "lib/modules/modules.dep"} {
+			if err := iw.WriteFile(name, 0o644, []byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Build: %s", err)
+	}
+
+	for _, seekable := range []bool{false, true} {
+		var (
+			in    = &countingReadSeeker{ReadSeeker: bytes.NewReader(raw)}
+			r     *Reader
+			names []string
+		)
+
+		if seekable {
+			r = NewReader(in)
+		} else {
+			r = NewReader(struct{ io.Reader }{in})
+		}
+
+		for hdr, data := range r.Glob("lib/modules/*.ko") {
+			names = append(names, hdr.Filename)
+
+			if got, err := io.ReadAll(data); err != nil || string(got) != hdr.Filename {
+				t.Errorf("%s: unexpected data %q (%v)", hdr.Filename, got, err)
+			}
+		}
+
+		if expect := []string{"lib/modules/a.ko", "lib/modules/b.ko"}; !slices.Equal(names, expect) {
+			t.Errorf("seekable %v: expected %q, got %q", seekable, expect, names)
+		}
+
+		if read := in.n < int64(len(raw))/2; read != seekable {
+			t.Errorf("seekable %v: read %d of %d bytes", seekable, in.n, len(raw))
+		}
+	}
+}
+
+func TestReader_GlobErr(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	for _, name := range []string{"etc/hostname", "etc/hosts", "init"} {
+		if err := w.WriteFile(name, 0o644, []byte(name)); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var collect = func(r *Reader, pattern string) (names []string, errs []error) {
+		for hdr, err := range r.GlobErr(pattern) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			names = append(names, hdr.Filename)
+
+			if data, err := io.ReadAll(r); err != nil || string(data) != hdr.Filename {
+				t.Errorf("%s: unexpected data %q (%v)", hdr.Filename, data, err)
+			}
+		}
+		return
+	}
+
+	t.Run("clean", func(t *testing.T) {
+		names, errs := collect(NewReader(bytes.NewReader(buf.Bytes())), "etc/*")
+
+		if expect := []string{"etc/hostname", "etc/hosts"}; !slices.Equal(names, expect) {
+			t.Errorf("expected %q, got %q", expect, names)
+		}
+		if len(errs) != 0 {
+			t.Errorf("expected no errors, got %v", errs)
+		}
+	})
+
+	t.Run("bad pattern", func(t *testing.T) {
+		var (
+			in = &countingReadSeeker{ReadSeeker: bytes.NewReader(buf.Bytes())}
+			r  = NewReader(in)
+		)
+
+		names, errs := collect(r, "etc/[")
+		if len(names) != 0 || len(errs) != 1 || errs[0] != path.ErrBadPattern {
+			t.Errorf("expected only ErrBadPattern, got %q and %v", names, errs)
+		}
+		if in.n != 0 {
+			t.Errorf("expected no input to be read, got %d bytes", in.n)
+		}
+
+		for hdr := range r.Glob("etc/[") {
+			t.Errorf("unexpected entry %s for a bad pattern", hdr.Filename)
+		}
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		var (
+			raw  = bytes.Clone(buf.Bytes())
+			hdrs headerList
+		)
+
+		hdrs.readAll(NewReader(bytes.NewReader(raw)))
+		if len(hdrs) != 6 || hdrs[3].Filename != "etc/hosts" {
+			t.Fatalf("unexpected archive layout: %v", hdrs)
+		}
+
+		// Corrupt the mode field of the header for "etc/hosts"
+		raw[hdrs[3].HeaderOffset+6+8] = 'Z'
+
+		names, errs := collect(NewReader(bytes.NewReader(raw)), "etc/*")
+
+		var ibe *InvalidByteError
+		if len(errs) != 1 || !errors.As(errs[0], &ibe) {
+			t.Errorf("expected an InvalidByteError, got %v", errs)
+		}
+		if expect := []string{"etc/hostname"}; !slices.Equal(names, expect) {
+			t.Errorf("expected %q, got %q", expect, names)
+		}
+	})
+}
+
+func TestNewAutoReader(t *testing.T) {
+	for _, early := range []bool{false, true} {
+		r, err := NewAutoReader(bytes.NewReader(testSegmentedArchive(t, early)), nil)
+		if err != nil {
+			t.Fatalf("NewAutoReader: %s", err)
+		}
+
+		testNextNamed(t, r, ".")
+
+		if codec := r.CurrentCodec(); (codec == Gzip) == early {
+			t.Errorf("early %v: unexpected codec %s", early, codec)
+		}
+	}
+
+	var compressed = testSegmentedArchive(t, false)
+	if _, err := NewAutoReader(bytes.NewReader(compressed), CompressReaderMap{}); err != ErrNoCompressReader {
+		t.Errorf("expected ErrNoCompressReader, got %v", err)
+	}
+}
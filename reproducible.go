@@ -0,0 +1,130 @@
+package initramfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Enables reproducible output, such that writing the same entries (in the same
+// order) always produces identical output, regardless of the ownership and
+// inode numbers of the source files:
+//   - The Mtime of every header passed to [Writer.WriteHeader] is set to a
+//     fixed epoch, taken from the SOURCE_DATE_EPOCH environment variable if set
+//     (see [SourceDateEpoch]), otherwise the Unix epoch
+//   - The Uid and Gid of every header passed to [Writer.WriteHeader] are set to
+//     0, unless preserved with [Writer.SetPreserveOwnership]
+//   - Inode numbers are assigned in write order starting from 1 (or by the
+//     [InodeAllocator], see [Writer.SetInodeAllocator]), with any Inode given by
+//     the caller remapped such that hard links remain grouped
+//
+// Automatically created directories are likewise given the fixed epoch, even
+// if their metadata is provided by [Writer.SetDirMetadata].
+//
+// Returns [ErrMalformedSourceDateEpoch] if SOURCE_DATE_EPOCH is set but is not
+// a valid number of seconds since the Unix epoch, in which case reproducible
+// mode is unchanged.
+func (iw *Writer) SetReproducible(enable bool) error {
+	if !enable {
+		iw.reproducible = false
+		return nil
+	}
+
+	mtime, ok, err := LookupSourceDateEpoch()
+	if err != nil {
+		return err
+	} else if !ok {
+		mtime = time.Unix(0, 0)
+	}
+
+	iw.reproducible = true
+	iw.reproducibleMtime = mtime
+	iw.nextInode = max(iw.nextInode, 1)
+
+	if iw.inodeMap == nil {
+		iw.inodeMap = make(map[uint32]uint32)
+	}
+
+	return nil
+}
+
+// When enabled, the Uid and Gid of headers are written as given in reproducible
+// mode (see [Writer.SetReproducible]), rather than being set to 0. This allows
+// for explicitly chosen ownership, such as when headers are built from a
+// specification rather than from the files of the build machine.
+func (iw *Writer) SetPreserveOwnership(preserve bool) { iw.preserveOwnership = preserve }
+
+var ErrMalformedSourceDateEpoch = errors.New("initramfs: malformed SOURCE_DATE_EPOCH")
+
+// Returns the time given by the SOURCE_DATE_EPOCH environment variable, as a
+// number of seconds since the Unix epoch, as per the [reproducible builds]
+// specification. Reports false if it is unset or empty.
+//
+// A malformed value also reports false; use [LookupSourceDateEpoch] to tell it
+// apart from an unset one. [Writer.SetReproducible] returns an error for it.
+//
+// [reproducible builds]: https://reproducible-builds.org/specs/source-date-epoch/
+func SourceDateEpoch() (time.Time, bool) {
+	mtime, ok, err := LookupSourceDateEpoch()
+	return mtime, ok && err == nil
+}
+
+// As [SourceDateEpoch], but returns [ErrMalformedSourceDateEpoch] if the
+// variable is set to anything other than a non-negative decimal integer.
+func LookupSourceDateEpoch() (mtime time.Time, ok bool, err error) {
+	s, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	if !ok || s == "" {
+		return time.Time{}, false, nil
+	}
+
+	secs, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || secs < 0 {
+		return time.Time{}, false, fmt.Errorf("%w: %q", ErrMalformedSourceDateEpoch, s)
+	}
+
+	return time.Unix(secs, 0), true, nil
+}
+
+// Replace the nondeterministic metadata of a header passed to WriteHeader.
+func (iw *Writer) applyReproducible(hdr *Header) {
+	if !iw.reproducible || hdr.Trailer() {
+		return
+	}
+
+	hdr.Mtime = iw.reproducibleMtime
+
+	if !iw.preserveOwnership {
+		hdr.Uid = 0
+		hdr.Gid = 0
+	}
+}
+
+// Assign an inode number to the header if it does not already have one, or if
+// in reproducible mode, remap the given one.
+func (iw *Writer) assignInode(hdr *Header) {
+	if hdr.Trailer() || iw.keepInode {
+		return
+	}
+
+	if iw.reproducible && hdr.Inode != 0 {
+		if ino, ok := iw.inodeMap[hdr.Inode]; ok {
+			hdr.Inode = ino
+			return
+		}
+
+		var orig = hdr.Inode
+		defer func() { iw.inodeMap[orig] = hdr.Inode }()
+
+		hdr.Inode = 0
+	}
+
+	if hdr.Inode == 0 {
+		if iw.inodeAlloc != nil {
+			hdr.Inode = iw.allocInode(hdr)
+		} else {
+			hdr.Inode = iw.nextInode
+		}
+	}
+}
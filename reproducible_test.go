@@ -0,0 +1,167 @@
+package initramfs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWriter_SetReproducible(t *testing.T) {
+	var build = func(mtime time.Time, uid uint32, inodeBase uint32) []byte {
+		var buf bytes.Buffer
+
+		w := NewWriter(&buf)
+		if err := w.SetReproducible(true); err != nil {
+			t.Fatalf("SetReproducible: %s", err)
+		}
+
+		for i, name := range []string{"bin/busybox", "bin/sh"} {
+			var hdr = Header{
+				Mode:     Mode_File | 0o755,
+				Uid:      uid,
+				Gid:      uid,
+				Mtime:    mtime.Add(time.Duration(i) * time.Hour),
+				Inode:    inodeBase,
+				NumLinks: 2,
+				Filename: name,
+			}
+			testWriteHeader(t, w, &hdr)
+		}
+
+		testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Uid: uid, Mtime: mtime, Inode: inodeBase + 1, Filename: "etc/hosts"})
+
+		if err := w.WriteHardLink("bin/ls", inodeBase); err != nil {
+			t.Fatalf("WriteHardLink: %s", err)
+		}
+
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+
+		return buf.Bytes()
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	var (
+		a = build(time.Now(), 1000, 12345)
+		b = build(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), 0, 777)
+	)
+
+	if !bytes.Equal(a, b) {
+		t.Fatalf("expected identical output")
+	}
+
+	var inodes = make(map[string]uint32)
+
+	for _, hdr := range NewReader(bytes.NewReader(a)).All() {
+		if hdr.Trailer() {
+			continue
+		}
+
+		inodes[hdr.Filename] = hdr.Inode
+
+		if hdr.Mtime.Unix() != 1700000000 {
+			t.Errorf("%s: expected mtime from SOURCE_DATE_EPOCH, got %s", hdr.Filename, hdr.Mtime)
+		}
+		if hdr.Uid != 0 || hdr.Gid != 0 {
+			t.Errorf("%s: expected owner 0:0, got %d:%d", hdr.Filename, hdr.Uid, hdr.Gid)
+		}
+	}
+
+	if inodes["."] != 1 {
+		t.Errorf("expected first inode 1, got %d", inodes["."])
+	}
+
+	if ino := inodes["bin/busybox"]; inodes["bin/sh"] != ino || inodes["bin/ls"] != ino {
+		t.Errorf("expected hard links to share an inode, got %v", inodes)
+	}
+
+	if inodes["etc/hosts"] == inodes["bin/busybox"] {
+		t.Errorf("expected distinct inodes, got %v", inodes)
+	}
+}
+
+func TestWriter_SetReproducibleOverrides(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	var (
+		buf   bytes.Buffer
+		mtime = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	w, err := NewWriterOptions(&buf, WithReproducible(), WithPreserveOwnership())
+	if err != nil {
+		t.Fatalf("NewWriterOptions: %s", err)
+	}
+
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Uid: 1000, Gid: 100, Mtime: mtime, Filename: "etc/hosts"})
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Uid: 1000, Gid: 100, Filename: "etc/motd"})
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var hdrs = make(map[string]Header)
+	for _, hdr := range NewReader(&buf).All() {
+		hdrs[hdr.Filename] = hdr
+	}
+
+	for _, name := range []string{"etc", "etc/hosts", "etc/motd"} {
+		if hdr := hdrs[name]; hdr.Mtime.Unix() != 1700000000 {
+			t.Errorf("%s: expected mtime from SOURCE_DATE_EPOCH, got %s", name, hdr.Mtime)
+		}
+	}
+
+	for _, name := range []string{"etc/hosts", "etc/motd"} {
+		if hdr := hdrs[name]; hdr.Uid != 1000 || hdr.Gid != 100 {
+			t.Errorf("%s: expected owner 1000:100 to be preserved, got %d:%d", name, hdr.Uid, hdr.Gid)
+		}
+	}
+}
+
+func TestWriter_SetReproducibleBadEpoch(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+
+	w, _ := testWriterReader(t)
+	if err := w.SetReproducible(true); !errors.Is(err, ErrMalformedSourceDateEpoch) {
+		t.Fatalf("expected ErrMalformedSourceDateEpoch, got %v", err)
+	}
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	var testcases = []struct {
+		value     string
+		expect    int64
+		ok        bool
+		malformed bool
+	}{
+		{"1700000000", 1700000000, true, false},
+		{"0", 0, true, false},
+		{"", 0, false, false},
+		{"yesterday", 0, false, true},
+		{"-1", 0, false, true},
+		{"1.5", 0, false, true},
+	}
+
+	for i, tc := range testcases {
+		t.Setenv("SOURCE_DATE_EPOCH", tc.value)
+
+		mtime, ok := SourceDateEpoch()
+		if ok != tc.ok || (ok && mtime.Unix() != tc.expect) {
+			t.Errorf("#%d %q: expected %d, %v, got %s, %v", i, tc.value, tc.expect, tc.ok, mtime, ok)
+		}
+
+		_, ok, err := LookupSourceDateEpoch()
+		if ok != tc.ok || errors.Is(err, ErrMalformedSourceDateEpoch) != tc.malformed {
+			t.Errorf("#%d %q: expected %v and malformed %v, got %v and %v", i, tc.value, tc.ok, tc.malformed, ok, err)
+		}
+	}
+
+	os.Unsetenv("SOURCE_DATE_EPOCH")
+
+	if _, ok, err := LookupSourceDateEpoch(); ok || err != nil {
+		t.Errorf("unset: expected false and no error, got %v and %v", ok, err)
+	}
+}
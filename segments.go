@@ -0,0 +1,104 @@
+package initramfs
+
+import (
+	"io"
+	"iter"
+)
+
+// A contiguous part of an archive read by [Reader.Segments], being either the
+// uncompressed part at the start of the input or a compressed part.
+type Segment struct {
+	Index       int       // Counting from 0, amongst those segments yielded
+	Compression Lookahead // As per [Reader.CurrentCodec], [UnknownLookahead] if uncompressed
+
+	// Yields every header of the segment in order, including any trailers. The
+	// file data of the current header may be read from the [Reader] while
+	// iterating. Must not be used once the next segment has been yielded.
+	Headers iter.Seq[Header]
+}
+
+// Provides a sequence iterator over each segment of the archive, continuing
+// through each compressed part using the global [CompressReaders] (see
+// [Reader.ContinueCompressed]). An uncompressed part without any entries, such
+// as when the input starts with compressed data, is not yielded.
+//
+// Any headers of a segment that are not consumed (including when Headers is
+// never iterated) are skipped before moving on to the next. Any error, such as
+// a malformed header or [ErrNoCompressReader], is yielded as the final element
+// (along with an empty segment). Iteration that ends without yielding an error
+// reached the end of the input cleanly.
+func (r *Reader) Segments() iter.Seq2[Segment, error] {
+	return func(yield func(seg Segment, err error) bool) {
+		for index := 0; ; {
+			var (
+				first Header
+				err   = r.next(&first)
+			)
+
+			if err == nil {
+				var state = segmentState{r: r, first: &first}
+
+				if !yield(Segment{Index: index, Compression: r.codec, Headers: state.headers}, nil) {
+					return
+				}
+				index++
+
+				err = state.drain()
+			}
+
+			switch {
+			case err == io.EOF && len(r.outer) == 0:
+				return
+			case err == io.EOF, err == ErrCompressedContentAhead:
+			default:
+				yield(Segment{}, err)
+				return
+			}
+
+			if _, _, err := r.ContinueCompressed(nil); err == io.EOF {
+				return
+			} else if err != nil {
+				yield(Segment{}, err)
+				return
+			}
+		}
+	}
+}
+
+type segmentState struct {
+	r     *Reader
+	first *Header // Already read, not yet yielded
+	err   error   // That ended the segment, once done
+	done  bool
+}
+
+func (s *segmentState) headers(yield func(hdr Header) bool) {
+	for !s.done {
+		var hdr Header
+
+		if s.first != nil {
+			hdr, s.first = *s.first, nil
+		} else if err := s.r.next(&hdr); err != nil {
+			s.err, s.done = err, true
+			return
+		}
+
+		if !yield(hdr) {
+			return
+		}
+	}
+}
+
+// Skip any remaining headers, returning the error that ended the segment.
+func (s *segmentState) drain() error {
+	s.first = nil
+
+	for !s.done {
+		var hdr Header
+		if err := s.r.next(&hdr); err != nil {
+			s.err, s.done = err, true
+		}
+	}
+
+	return s.err
+}
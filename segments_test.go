@@ -0,0 +1,228 @@
+package initramfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+func testSegmentedArchive(t *testing.T, early bool) []byte {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+
+	if early {
+		if err := w.WriteFile(MicrocodePath_GenuineIntel, 0o644, []byte("microcode")); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+	}
+
+	if err := w.StartCompressionType(Gzip); err != nil {
+		t.Fatalf("StartCompressionType: %s", err)
+	}
+	if err := w.WriteFile("init", 0o755, []byte("#!/bin/sh\n")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+// Concatenate an uncompressed archive and two gzip compressed ones, each
+// holding a single file with the given name, followed by zero padding.
+func testConcatenatedArchive(t *testing.T, names ...string) []byte {
+	var parts []io.Reader
+
+	for i, name := range names {
+		var (
+			buf bytes.Buffer
+			w   = NewWriter(&buf)
+		)
+
+		if i > 0 {
+			if err := w.StartCompressionType(Gzip); err != nil {
+				t.Fatalf("StartCompressionType: %s", err)
+			}
+		}
+		if err := w.WriteFile(name, 0o644, []byte(name)); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %s", err)
+		}
+
+		parts = append(parts, &buf)
+	}
+
+	var out bytes.Buffer
+	if err := Concat(&out, parts...); err != nil {
+		t.Fatalf("Concat: %s", err)
+	}
+
+	out.Write(make([]byte, 100))
+	return out.Bytes()
+}
+
+// Collect the codec and file names of each segment, along with the data of
+// each regular file.
+func testReadSegments(t *testing.T, r *Reader) (codecs []Lookahead, names [][]string, data map[string]string) {
+	data = make(map[string]string)
+
+	for seg, err := range r.Segments() {
+		if err != nil {
+			t.Fatalf("Segments: %s", err)
+		}
+
+		codecs = append(codecs, seg.Compression)
+
+		var segNames []string
+		for hdr := range seg.Headers {
+			segNames = append(segNames, hdr.Filename)
+
+			if hdr.Mode.File() {
+				b, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("ReadAll: %s", err)
+				}
+				data[hdr.Filename] = string(b)
+			}
+		}
+		names = append(names, segNames)
+	}
+
+	return
+}
+
+// Expect the segments of an archive from [testConcatenatedArchive].
+func testExpectConcatenated(t *testing.T, r *Reader, names ...string) {
+	t.Helper()
+
+	codecs, segNames, data := testReadSegments(t, r)
+
+	if len(codecs) != len(names) {
+		t.Fatalf("expected %d segments, got %v", len(names), codecs)
+	}
+
+	for i, name := range names {
+		var codec = Gzip
+		if i == 0 {
+			codec = UnknownLookahead
+		}
+		if codecs[i] != codec {
+			t.Errorf("segment %d: expected codec %s, got %s", i, codec, codecs[i])
+		}
+		if expect := []string{".", name, TrailerFilename}; !slices.Equal(segNames[i], expect) {
+			t.Errorf("segment %d: expected %q, got %q", i, expect, segNames[i])
+		}
+		if data[name] != name {
+			t.Errorf("%s: unexpected data %q", name, data[name])
+		}
+	}
+}
+
+func TestReader_Segments(t *testing.T) {
+	var r = NewReader(bytes.NewReader(testSegmentedArchive(t, true)))
+
+	var (
+		codecs []Lookahead
+		names  [][]string
+		init   string
+	)
+
+	for seg, err := range r.Segments() {
+		if err != nil {
+			t.Fatalf("Segments: %s", err)
+		}
+
+		if seg.Index != len(codecs) {
+			t.Errorf("expected index %d, got %d", len(codecs), seg.Index)
+		}
+		codecs = append(codecs, seg.Compression)
+
+		var segNames []string
+		for hdr := range seg.Headers {
+			segNames = append(segNames, hdr.Filename)
+
+			if hdr.Filename == "init" {
+				data, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("ReadAll: %s", err)
+				}
+				init = string(data)
+			}
+		}
+		names = append(names, segNames)
+	}
+
+	if len(codecs) != 2 || codecs[0] != UnknownLookahead || codecs[1] != Gzip {
+		t.Fatalf("expected an uncompressed and a gzip segment, got %v", codecs)
+	}
+
+	if len(names[0]) != 6 || names[0][5] != TrailerFilename || names[1][1] != "init" {
+		t.Errorf("unexpected entries %q", names)
+	}
+
+	if init != "#!/bin/sh\n" {
+		t.Errorf("unexpected init data %q", init)
+	}
+}
+
+func TestReader_SegmentsPartial(t *testing.T) {
+	// Headers left unconsumed are skipped, and an input starting with
+	// compressed data has no uncompressed segment
+	for _, early := range []bool{true, false} {
+		var (
+			r      = NewReader(bytes.NewReader(testSegmentedArchive(t, early)))
+			codecs []Lookahead
+		)
+
+		for seg, err := range r.Segments() {
+			if err != nil {
+				t.Fatalf("Segments: %s", err)
+			}
+
+			codecs = append(codecs, seg.Compression)
+
+			for range seg.Headers {
+				break
+			}
+		}
+
+		if codecs[len(codecs)-1] != Gzip || len(codecs) != map[bool]int{true: 2, false: 1}[early] {
+			t.Errorf("early %v: unexpected segments %v", early, codecs)
+		}
+	}
+}
+
+func TestReader_SegmentsError(t *testing.T) {
+	var r = NewReader(bytes.NewReader(testSegmentedArchive(t, true)))
+	r.SetMaxEntries(3)
+
+	var last error
+	for _, err := range r.Segments() {
+		last = err
+	}
+
+	if !errors.Is(last, ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got %v", last)
+	}
+}
+
+func TestReader_SegmentsConcatenated(t *testing.T) {
+	var raw = testConcatenatedArchive(t, "early", "first", "second")
+
+	testExpectConcatenated(t, NewReader(bytes.NewReader(raw)), "early", "first", "second")
+}
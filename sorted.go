@@ -0,0 +1,110 @@
+package initramfs
+
+import (
+	"os"
+	"slices"
+	"strings"
+)
+
+// Buffers entries in memory and writes them to an underlying [Writer] sorted by
+// normalized filename, so that the archive does not depend upon the order in
+// which entries were produced (such as when iterating over a map, or gathering
+// from concurrent sources). As a parent directory name is a prefix of its
+// children, parents always precede their children. Entries with the same name
+// keep their relative order.
+//
+// All of the usual processing of the underlying writer, such as creating
+// missing parent directories, assigning inodes and coalescing hard links,
+// applies to the entries as they are written in sorted order.
+type SortedWriter struct {
+	iw        *Writer
+	entries   []builderEntry
+	off       int // Of the next byte of data for the last entry
+	remaining int64
+}
+
+// Create a writer that buffers entries in memory and writes them to iw in
+// sorted order upon [SortedWriter.Flush] or [SortedWriter.WriteTrailer].
+func NewSortedWriter(iw *Writer) *SortedWriter { return &SortedWriter{iw: iw} }
+
+// Buffer a header, whose file data of up to DataSize bytes may then be
+// provided via [SortedWriter.Write]. Any data not provided is zero filled.
+func (sw *SortedWriter) WriteHeader(hdr *Header) error {
+	if sw.iw.closed {
+		return os.ErrClosed
+	}
+
+	var e = builderEntry{hdr: *hdr}
+	if hdr.DataSize > 0 {
+		e.data = make([]byte, hdr.DataSize)
+	}
+
+	sw.entries = append(sw.entries, e)
+	sw.off = 0
+	sw.remaining = int64(hdr.DataSize)
+
+	return nil
+}
+
+// Buffer file data for the most recent header. As with [Writer.Write], returns
+// [ErrFileTooLarge] for any data beyond DataSize.
+func (sw *SortedWriter) Write(buf []byte) (n int, err error) {
+	if sw.remaining > 0 {
+		var e = &sw.entries[len(sw.entries)-1]
+
+		n = copy(e.data[sw.off:], buf)
+		sw.off += n
+		sw.remaining -= int64(n)
+	}
+
+	if n < len(buf) {
+		err = ErrFileTooLarge
+	}
+
+	return
+}
+
+// Buffer a regular file entry with the given permissions (any file type bits in
+// mode are ignored) and contents.
+func (sw *SortedWriter) WriteFile(name string, mode Mode, data []byte) error {
+	var hdr = Header{
+		Mode:     Mode_File | mode&^Mode_FileTypeMask,
+		Filename: name,
+	}
+
+	if err := hdr.SetDataSize(int64(len(data))); err != nil {
+		return err
+	}
+
+	if err := sw.WriteHeader(&hdr); err != nil {
+		return err
+	}
+
+	_, err := sw.Write(data)
+	return err
+}
+
+// Write all buffered entries to the underlying writer in sorted order, and
+// forget them. Entries buffered afterwards are sorted separately.
+func (sw *SortedWriter) Flush() error {
+	var entries = sw.entries
+
+	sw.entries = nil
+	sw.off = 0
+	sw.remaining = 0
+
+	slices.SortStableFunc(entries, func(x, y builderEntry) int {
+		return strings.Compare(normalizeName(x.hdr.Filename), normalizeName(y.hdr.Filename))
+	})
+
+	return writeEntries(sw.iw, entries)
+}
+
+// Flush the buffered entries, then write the trailer to the underlying writer.
+func (sw *SortedWriter) WriteTrailer() error {
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+
+	return sw.iw.WriteTrailer()
+}
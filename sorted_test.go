@@ -0,0 +1,59 @@
+package initramfs
+
+import (
+	"io"
+	"testing"
+)
+
+func TestSortedWriter(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	w.SetCoalesceHardLinks(true)
+
+	sw := NewSortedWriter(w)
+
+	for _, name := range []string{"usr/bin/env", "etc/motd", "init", "etc/hostname"} {
+		if err := sw.WriteFile(name, 0o644, []byte(name)); err != nil {
+			t.Fatalf("WriteFile %s: %s", name, err)
+		}
+	}
+
+	for _, name := range []string{"bin/sh", "bin/ash"} {
+		var hdr = Header{
+			Mode:     Mode_File | 0o755,
+			Inode:    100,
+			NumLinks: 2,
+			DataSize: 7,
+			Filename: name,
+		}
+
+		if err := sw.WriteHeader(&hdr); err != nil {
+			t.Fatalf("WriteHeader %s: %s", name, err)
+		}
+
+		// Data beyond DataSize is refused
+		if n, err := sw.Write([]byte("busybox!")); n != 7 || err != ErrFileTooLarge {
+			t.Fatalf("Write %s: expected 7 bytes and ErrFileTooLarge, got %d and %v", name, n, err)
+		}
+	}
+
+	if err := sw.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var hdrs headerList
+	for _, hdr := range r.All() {
+		hdrs = append(hdrs, hdr)
+
+		if hdr.Filename == "bin/sh" && hdr.DataSize != 0 {
+			t.Errorf("bin/sh: expected coalesced hard link, got DataSize %d", hdr.DataSize)
+		}
+		if hdr.Filename == "etc/motd" {
+			if data, err := io.ReadAll(r); err != nil || string(data) != "etc/motd" {
+				t.Errorf("etc/motd: unexpected data %q (%v)", data, err)
+			}
+		}
+	}
+
+	hdrs.expectNames(t, ".", "bin", "bin/ash", "bin/sh", "etc", "etc/hostname", "etc/motd", "init", "usr", "usr/bin", "usr/bin/env", TrailerFilename)
+}
@@ -0,0 +1,256 @@
+package initramfs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var ErrMalformedSpec = errors.New("initramfs: malformed gen_init_cpio spec")
+
+// A single directive of a spec file as understood by the kernel's
+// `usr/gen_init_cpio` tool, see [ParseSpec].
+type SpecEntry struct {
+	Line int // Line number within the spec, from 1
+
+	Filename string
+	Mode     Mode // Including the file type bits
+	Uid      uint32
+	Gid      uint32
+
+	Location string   // For "file", the path of the contents within the base directory
+	Links    []string // For "file", any further names that are hard links to it
+	Target   string   // For "slink", the symlink target
+
+	RMajor uint32 // For "nod", the device numbers
+	RMinor uint32
+}
+
+// Parse a spec file as understood by the kernel's `usr/gen_init_cpio` tool,
+// which consists of one directive per line:
+//
+//	file <name> <location> <mode> <uid> <gid> [<hard links>...]
+//	dir <name> <mode> <uid> <gid>
+//	nod <name> <mode> <uid> <gid> <dev_type> <maj> <min>
+//	slink <name> <target> <mode> <uid> <gid>
+//	pipe <name> <mode> <uid> <gid>
+//	sock <name> <mode> <uid> <gid>
+//
+// The mode is in octal, and the dev_type of "nod" is either "b" (block) or "c"
+// (character). Blank lines and those starting with "#" are ignored.
+//
+// Returns [ErrMalformedSpec], with the offending line number, for any unknown
+// directive or invalid field. See [Writer.WriteSpec].
+func ParseSpec(r io.Reader) ([]SpecEntry, error) {
+	var (
+		entries []SpecEntry
+		scanner = bufio.NewScanner(r)
+		lineNum int
+	)
+
+	for scanner.Scan() {
+		lineNum++
+
+		var line = strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		entry, err := parseSpecLine(strings.Fields(line))
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrMalformedSpec, lineNum, err)
+		}
+
+		entry.Line = lineNum
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// The number of fields (including the directive) expected for each directive.
+var specFieldCounts = map[string]int{
+	"file":  6,
+	"dir":   5,
+	"nod":   8,
+	"slink": 6,
+	"pipe":  5,
+	"sock":  5,
+}
+
+func parseSpecLine(fields []string) (entry SpecEntry, err error) {
+	var directive = fields[0]
+
+	want, ok := specFieldCounts[directive]
+	if !ok {
+		return entry, fmt.Errorf("unknown directive %q", directive)
+	}
+
+	if len(fields) < want || (len(fields) > want && directive != "file") {
+		return entry, fmt.Errorf("%s: expected %d fields, got %d", directive, want-1, len(fields)-1)
+	}
+
+	entry.Filename = fields[1]
+
+	// The mode, uid and gid follow the name, other than for "file" and "slink"
+	// where they follow the location or target
+	var rest = fields[2:]
+	switch directive {
+	case "file":
+		entry.Location = fields[2]
+		entry.Links = fields[6:]
+		rest = fields[3:]
+	case "slink":
+		entry.Target = fields[2]
+		rest = fields[3:]
+	}
+
+	perm, err := strconv.ParseUint(rest[0], 8, 32)
+	if err != nil || perm > 0o7777 {
+		return entry, fmt.Errorf("%s: invalid mode %q", directive, rest[0])
+	}
+	entry.Mode = Mode(perm)
+
+	if entry.Uid, err = parseSpecNumber(directive, "uid", rest[1]); err != nil {
+		return
+	}
+	if entry.Gid, err = parseSpecNumber(directive, "gid", rest[2]); err != nil {
+		return
+	}
+
+	switch directive {
+	case "file":
+		entry.Mode |= Mode_File
+	case "dir":
+		entry.Mode |= Mode_Dir
+	case "slink":
+		entry.Mode |= Mode_Symlink
+	case "pipe":
+		entry.Mode |= Mode_FIFO
+	case "sock":
+		entry.Mode |= Mode_Socket
+	case "nod":
+		switch rest[3] {
+		case "b":
+			entry.Mode |= Mode_BlockDevice
+		case "c":
+			entry.Mode |= Mode_CharDevice
+		default:
+			return entry, fmt.Errorf("nod: invalid device type %q", rest[3])
+		}
+
+		if entry.RMajor, err = parseSpecNumber(directive, "major", rest[4]); err != nil {
+			return
+		}
+		if entry.RMinor, err = parseSpecNumber(directive, "minor", rest[5]); err != nil {
+			return
+		}
+	}
+
+	return entry, nil
+}
+
+func parseSpecNumber(directive, field, s string) (uint32, error) {
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid %s %q", directive, field, s)
+	}
+	return uint32(v), nil
+}
+
+// Write the entries of a spec, as parsed by [ParseSpec], to the archive in
+// order.
+//
+// The contents of each "file" are read from baseDir at its Location, with any
+// leading slash removed, such that absolute locations may be resolved with
+// [os.DirFS]("/"). Its modification time is taken from the source file, and
+// any hard links are written immediately after it. Every other entry has a
+// zero modification time (see [Writer.SetReproducible]).
+//
+// Any error is returned as an [io/fs.PathError] naming the offending entry. The
+// trailer is not written.
+func (iw *Writer) WriteSpec(entries []SpecEntry, baseDir fs.FS) error {
+	for i := range entries {
+		if err := iw.writeSpecEntry(&entries[i], baseDir); err != nil {
+			var pathErr *fs.PathError
+			if errors.As(err, &pathErr) {
+				return err
+			}
+			return &fs.PathError{Op: "WriteSpec", Path: entries[i].Filename, Err: err}
+		}
+	}
+
+	return nil
+}
+
+func (iw *Writer) writeSpecEntry(entry *SpecEntry, baseDir fs.FS) error {
+	var hdr = Header{
+		Mode:     entry.Mode,
+		Uid:      entry.Uid,
+		Gid:      entry.Gid,
+		RMajor:   entry.RMajor,
+		RMinor:   entry.RMinor,
+		Filename: entry.Filename,
+	}
+
+	var data io.Reader
+
+	switch {
+	case entry.Mode.File():
+		f, err := baseDir.Open(strings.TrimPrefix(path.Clean(entry.Location), "/"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		if err := hdr.SetDataSize(fi.Size()); err != nil {
+			return err
+		}
+
+		hdr.Mtime = fi.ModTime()
+		hdr.NumLinks = uint32(1 + len(entry.Links))
+		data = f
+
+	case entry.Mode.Symlink():
+		if err := hdr.SetDataSize(int64(len(entry.Target))); err != nil {
+			return err
+		}
+
+		data = strings.NewReader(entry.Target)
+	}
+
+	if err := iw.WriteHeader(&hdr); err != nil {
+		return err
+	}
+
+	if hdr.DataSize > 0 {
+		if _, err := iw.ReadFrom(data); err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+
+	for _, link := range entry.Links {
+		if err := iw.writeHardLink(link, hdr.Inode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
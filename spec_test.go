@@ -0,0 +1,144 @@
+package initramfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+const testSpec = `# A simple initramfs
+dir /dev 0755 0 0
+nod /dev/console 0600 0 0 c 5 1
+nod /dev/sda 0660 0 6 b 8 0
+dir /bin 0755 0 0
+file /bin/busybox /src/busybox 4755 0 0 /bin/ls /bin/cat
+slink /bin/sh busybox 777 0 0
+
+pipe /run/initctl 0600 0 0
+sock /run/socket 0666 1000 1000
+`
+
+func TestParseSpec(t *testing.T) {
+	entries, err := ParseSpec(strings.NewReader(testSpec))
+	if err != nil {
+		t.Fatalf("ParseSpec: %s", err)
+	}
+
+	if len(entries) != 8 {
+		t.Fatalf("expected 8 entries, got %d", len(entries))
+	}
+
+	var console = entries[1]
+	if console.Line != 3 || console.Filename != "/dev/console" || console.Mode != Mode_CharDevice|0o600 || console.RMajor != 5 || console.RMinor != 1 {
+		t.Errorf("unexpected console entry %+v", console)
+	}
+
+	var busybox = entries[4]
+	if busybox.Location != "/src/busybox" || busybox.Mode != Mode_File|Mode_SUID|0o755 || len(busybox.Links) != 2 || busybox.Links[1] != "/bin/cat" {
+		t.Errorf("unexpected busybox entry %+v", busybox)
+	}
+
+	if sh := entries[5]; sh.Target != "busybox" || sh.Mode != Mode_Symlink|0o777 {
+		t.Errorf("unexpected sh entry %+v", sh)
+	}
+
+	if sock := entries[7]; sock.Mode != Mode_Socket|0o666 || sock.Uid != 1000 || sock.Gid != 1000 {
+		t.Errorf("unexpected sock entry %+v", sock)
+	}
+
+	for _, line := range []string{
+		"link /a /b 0644 0 0",
+		"dir /a 0755 0",
+		"dir /a 0755 0 0 extra",
+		"dir /a 0855 0 0",
+		"dir /a 17777 0 0",
+		"dir /a 0755 root 0",
+		"nod /a 0600 0 0 x 1 1",
+		"nod /a 0600 0 0 c 1 -1",
+	} {
+		if _, err := ParseSpec(strings.NewReader("\n" + line)); !errors.Is(err, ErrMalformedSpec) || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%q: expected ErrMalformedSpec on line 2, got %v", line, err)
+		}
+	}
+}
+
+func TestWriter_WriteSpec(t *testing.T) {
+	var mtime = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	var baseDir = fstest.MapFS{
+		"src/busybox": {Data: []byte("busybox"), Mode: 0o755, ModTime: mtime},
+	}
+
+	entries, err := ParseSpec(strings.NewReader(testSpec))
+	if err != nil {
+		t.Fatalf("ParseSpec: %s", err)
+	}
+
+	w, r := testWriterReader(t)
+
+	if err := w.WriteSpec(entries, baseDir); err != nil {
+		t.Fatalf("WriteSpec: %s", err)
+	}
+
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var (
+		hdrs headerList
+		data = make(map[string]string)
+	)
+	for _, hdr := range r.All() {
+		hdrs = append(hdrs, hdr)
+
+		if hdr.DataSize > 0 {
+			b, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll %s: %s", hdr.Filename, err)
+			}
+			data[hdr.Filename] = string(b)
+		}
+	}
+
+	hdrs.expectNames(t, ".", "dev", "dev/console", "dev/sda", "bin", "bin/busybox", "bin/ls", "bin/cat", "bin/sh", "run", "run/initctl", "run/socket", TrailerFilename)
+
+	var byName = make(map[string]Header)
+	for _, hdr := range hdrs {
+		byName[hdr.Filename] = hdr
+	}
+
+	if sda := byName["dev/sda"]; sda.Mode != Mode_BlockDevice|0o660 || sda.Gid != 6 || sda.RMajor != 8 || sda.RMinor != 0 {
+		t.Errorf("unexpected dev/sda %+v", sda)
+	}
+
+	var busybox = byName["bin/busybox"]
+	if !busybox.Mtime.Equal(mtime) || busybox.NumLinks != 3 || data["bin/busybox"] != "busybox" {
+		t.Errorf("unexpected bin/busybox %+v with data %q", busybox, data["bin/busybox"])
+	}
+
+	for _, name := range []string{"bin/ls", "bin/cat"} {
+		if link := byName[name]; link.Inode != busybox.Inode || link.DataSize != 0 {
+			t.Errorf("%s: expected hard link to inode %d, got %+v", name, busybox.Inode, link)
+		}
+	}
+
+	if data["bin/sh"] != "busybox" {
+		t.Errorf("bin/sh: expected target busybox, got %q", data["bin/sh"])
+	}
+
+	if sock := byName["run/socket"]; sock.Mode != Mode_Socket|0o666 || sock.Uid != 1000 {
+		t.Errorf("unexpected run/socket %+v", sock)
+	}
+
+	// A missing source file is reported
+	w, _ = testWriterReader(t)
+
+	err = w.WriteSpec([]SpecEntry{{Filename: "/init", Mode: Mode_File | 0o755, Location: "/src/init"}}, baseDir)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package initramfs
+
+// Counts of the entries written by a [Writer], see [Writer.Stats].
+type Stats struct {
+	Files    int // Regular files, including hard links
+	Dirs     int // Including those created automatically
+	Symlinks int
+	Devices  int // Character and block devices
+	Others   int // FIFOs, sockets and any unknown file types
+	Trailers int
+
+	HeaderBytes int64 // Headers and filenames, excluding padding
+	DataBytes   int64 // File data (including symlink targets), excluding padding
+}
+
+// The total number of entries, excluding trailers.
+func (s Stats) Entries() int { return s.Files + s.Dirs + s.Symlinks + s.Devices + s.Others }
+
+// Returns counts of the entries written so far, by file type, along with the
+// size of their headers and data. The difference between their sum and the
+// uncompressed output size is the padding written. Hard links that have had
+// their data dropped (see [Writer.SetCoalesceHardLinks]) contribute no data
+// bytes.
+func (iw *Writer) Stats() Stats { return iw.stats }
+
+func (s *Stats) add(hdr *Header, headerBytes int64) {
+	switch {
+	case hdr.Trailer():
+		s.Trailers++
+	case hdr.Mode.File():
+		s.Files++
+	case hdr.Mode.Dir():
+		s.Dirs++
+	case hdr.Mode.Symlink():
+		s.Symlinks++
+	case hdr.Mode.CharDevice(), hdr.Mode.BlockDevice():
+		s.Devices++
+	default:
+		s.Others++
+	}
+
+	s.HeaderBytes += headerBytes
+	s.DataBytes += int64(hdr.DataSize)
+}
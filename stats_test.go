@@ -0,0 +1,52 @@
+package initramfs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriter_Stats(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+
+	if err := w.WriteFile("bin/busybox", 0o755, []byte("busybox")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	if err := w.WriteSymlink("bin/sh", "busybox", 0); err != nil {
+		t.Fatalf("WriteSymlink: %s", err)
+	}
+	if err := w.WriteConsoleDevice(); err != nil {
+		t.Fatalf("WriteConsoleDevice: %s", err)
+	}
+	if err := w.WriteFIFO("run/initctl", 0o600); err != nil {
+		t.Fatalf("WriteFIFO: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var stats = w.Stats()
+
+	var expect = Stats{Files: 1, Dirs: 4, Symlinks: 1, Devices: 1, Others: 1, Trailers: 1, DataBytes: 14}
+	expect.HeaderBytes = stats.HeaderBytes
+
+	if stats != expect {
+		t.Errorf("expected %+v, got %+v", expect, stats)
+	}
+
+	if n := stats.Entries(); n != 8 {
+		t.Errorf("expected 8 entries, got %d", n)
+	}
+
+	// Every entry has a header of at least 110 bytes plus a filename, with
+	// padding making up the remainder of the output
+	if stats.HeaderBytes < 9*HeaderSize || stats.HeaderBytes+stats.DataBytes > int64(buf.Len()) {
+		t.Errorf("unexpected HeaderBytes %d for %d bytes of output", stats.HeaderBytes, buf.Len())
+	}
+
+	w.Reset(&buf)
+	if stats := w.Stats(); stats != (Stats{}) {
+		t.Errorf("expected Reset to clear stats, got %+v", stats)
+	}
+}
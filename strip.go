@@ -0,0 +1,115 @@
+package initramfs
+
+import (
+	"io"
+	"path"
+	"strings"
+)
+
+// The path of the program the kernel runs once the initramfs is unpacked, as
+// it appears within an archive.
+const InitPath = "init"
+
+// Copy an archive from src to dst, keeping only the entries whose normalized
+// filename matches one of the [path.Match] patterns in keep (leading slashes in
+// patterns are ignored), along with [InitPath] and the parent directories of
+// every retained entry. All other entries are dropped.
+//
+// Directory entries from src are retained with their original metadata when
+// they are needed as a parent, and any that are missing are created by the
+// [Writer]. Compressed segments in src are decompressed using the global
+// [CompressReaders], and dst will receive a single uncompressed archive ending
+// with one trailer.
+func StripToEssentials(dst io.Writer, src io.Reader, keep []string) error {
+	var patterns = make([]string, len(keep))
+	for i, pattern := range keep {
+		pattern = strings.TrimLeft(pattern, "/")
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+		patterns[i] = pattern
+	}
+
+	var (
+		r       = NewReader(src)
+		iw      = NewWriter(dst)
+		dirs    = make(map[string]Header)
+		written = make(map[string]bool)
+	)
+
+	var keepName = func(name string) bool {
+		if name == InitPath {
+			return true
+		}
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Write any directories from the source archive that are parents of name,
+	// outermost first
+	var writeParents = func(name string) error {
+		for _, dir := range splitBytePrefixAll(path.Dir(name), '/') {
+			if written[dir] {
+				continue
+			}
+
+			if hdr, ok := dirs[dir]; ok {
+				if err := iw.WriteHeader(&hdr); err != nil {
+					return err
+				}
+				written[dir] = true
+			}
+		}
+		return nil
+	}
+
+	err := r.walk(func(hdr *Header) error {
+		if hdr.Trailer() {
+			return nil
+		}
+
+		var name = normalizeName(hdr.Filename)
+		hdr.Filename = name
+
+		if hdr.Mode.Dir() {
+			dirs[name] = *hdr
+		}
+
+		if !keepName(name) || written[name] {
+			return nil
+		}
+
+		if name != "." {
+			if err := writeParents(name); err != nil {
+				return err
+			}
+		}
+
+		if err := iw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		written[name] = hdr.Mode.Dir()
+
+		if hdr.DataSize > 0 {
+			if _, err := iw.ReadFrom(r); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := iw.WriteTrailer(); err != nil {
+		return err
+	}
+
+	return iw.Flush()
+}
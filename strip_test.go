@@ -0,0 +1,68 @@
+package initramfs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStripToEssentials(t *testing.T) {
+	var src bytes.Buffer
+
+	w := NewWriter(&src)
+	testMkdirAll(t, w, "/", 0o755)
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o755, DataSize: 10, Filename: "/init"})
+	w.Write([]byte("#!/bin/sh\n"))
+	testMkdirHeader(t, w, "/bin", &Header{Mode: Mode_Dir | 0o711})
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o755, DataSize: 4, Filename: "/bin/sh"})
+	w.Write([]byte("sh!\n"))
+	testWriteHeader(t, w, &Header{Mode: Mode_Symlink | 0o777, DataSize: 2, Filename: "/bin/ls"})
+	w.Write([]byte("sh"))
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Filename: "/etc/passwd"})
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o755, Filename: "/usr/bin/env"})
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var dst bytes.Buffer
+	if err := StripToEssentials(&dst, &src, []string{"/bin/*"}); err != nil {
+		t.Fatalf("StripToEssentials: %s", err)
+	}
+
+	var (
+		r    = NewReader(&dst)
+		hdrs headerList
+	)
+
+	for _, hdr := range r.All() {
+		hdrs = append(hdrs, hdr)
+
+		if hdr.Filename == "bin/sh" {
+			var data = make([]byte, hdr.DataSize)
+			r.Read(data)
+			if string(data) != "sh!\n" {
+				t.Errorf("expected bin/sh data, got %q", data)
+			}
+		}
+	}
+
+	hdrs.expectNames(t,
+		".",
+		"init",
+		"bin",
+		"bin/sh",
+		"bin/ls",
+		TrailerFilename,
+	)
+
+	if len(hdrs) > 2 {
+		if expect, got := Mode_Dir|0o711, hdrs[2].Mode; expect != got {
+			t.Errorf("expected bin mode %s, got %s", expect, got)
+		}
+	}
+
+	t.Run("bad pattern", func(t *testing.T) {
+		if err := StripToEssentials(&bytes.Buffer{}, &bytes.Buffer{}, []string{"["}); err == nil {
+			t.Fatal("expected error for bad pattern")
+		}
+	})
+}
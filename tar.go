@@ -0,0 +1,310 @@
+package initramfs
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// Copy every entry of a tar stream into the archive, in order.
+//
+// Regular files, directories, symlinks (whose target is taken from Linkname),
+// character and block devices (see Devmajor and Devminor) and FIFOs are
+// supported, preserving their mode (including any SUID, SGID and sticky bits),
+// ownership and modification time. Filenames are made relative to the root,
+// and inode numbers are assigned by the writer.
+//
+// Tar hard links ([archive/tar.TypeLink]) are written as entries sharing the
+// inode of their (earlier) target with no data, as the kernel expects. As tar
+// does not record how many links a file has, every regular file is written with
+// a NumLinks of 2 so that it may be the target of a later link.
+//
+// Global PAX headers are ignored. Any other entry type (such as GNU sparse
+// files) results in [ErrUnsupportedFileType], and a link to an unknown target
+// in [ErrUnknownHardLink], either returned as an [io/fs.PathError] naming the
+// offending entry. The trailer is not written.
+func FromTar(tr *tar.Reader, iw *Writer) error {
+	var inodes = make(map[string]uint32) // Regular files by normalized name
+
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := fromTarEntry(tr, th, iw, inodes); err != nil {
+			var pathErr *fs.PathError
+			if errors.As(err, &pathErr) {
+				return err
+			}
+			return &fs.PathError{Op: "FromTar", Path: th.Name, Err: err}
+		}
+	}
+}
+
+func fromTarEntry(tr *tar.Reader, th *tar.Header, iw *Writer, inodes map[string]uint32) error {
+	var name = normalizeName(th.Name)
+
+	var hdr = Header{
+		Mode:     Mode(th.Mode) & (Mode_SUID | Mode_SGID | Mode_Sticky | Mode_PermsMask),
+		Uid:      uint32(th.Uid),
+		Gid:      uint32(th.Gid),
+		Mtime:    th.ModTime,
+		Filename: name,
+	}
+
+	var data io.Reader
+
+	switch th.Typeflag {
+	case tar.TypeReg:
+		hdr.Mode |= Mode_File
+		hdr.NumLinks = 2
+
+		if err := hdr.SetDataSize(th.Size); err != nil {
+			return err
+		}
+
+		data = tr
+
+	case tar.TypeLink:
+		inode, ok := inodes[normalizeName(th.Linkname)]
+		if !ok {
+			return ErrUnknownHardLink
+		}
+
+		return iw.writeHardLink(name, inode)
+
+	case tar.TypeDir:
+		hdr.Mode |= Mode_Dir
+
+	case tar.TypeSymlink:
+		hdr.Mode |= Mode_Symlink
+
+		if err := hdr.SetDataSize(int64(len(th.Linkname))); err != nil {
+			return err
+		}
+
+		data = strings.NewReader(th.Linkname)
+
+	case tar.TypeChar, tar.TypeBlock:
+		if th.Typeflag == tar.TypeChar {
+			hdr.Mode |= Mode_CharDevice
+		} else {
+			hdr.Mode |= Mode_BlockDevice
+		}
+
+		hdr.RMajor = uint32(th.Devmajor)
+		hdr.RMinor = uint32(th.Devminor)
+
+	case tar.TypeFifo:
+		hdr.Mode |= Mode_FIFO
+
+	case tar.TypeXGlobalHeader:
+		return nil
+
+	default:
+		return ErrUnsupportedFileType
+	}
+
+	if err := iw.WriteHeader(&hdr); err != nil {
+		return err
+	}
+
+	if hdr.Mode.File() {
+		inodes[name] = hdr.Inode
+	}
+
+	if hdr.DataSize > 0 {
+		if _, err := iw.ReadFrom(data); err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Write every entry of the archive, including any compressed segments (see
+// [CompressReaders]), to a tar stream, in order. This is the inverse of
+// [FromTar]. The tar writer is not closed.
+//
+// Mode (including any SUID, SGID and sticky bits), ownership and modification
+// time are preserved, and filenames are made relative to the root. Symlinks
+// become [archive/tar.TypeSymlink] entries with their target (the file data,
+// see [Reader.ReadSymlinkTarget]) as Linkname, and devices carry their RMajor
+// and RMinor as Devmajor and Devminor.
+//
+// Hard linked regular files (see [Header.HardLinked]) that share an Inode,
+// Major and Minor become a single [archive/tar.TypeReg] entry for the member
+// carrying the file data, followed by an [archive/tar.TypeLink] to it for every
+// other member. This supports both the data being stored with the first link,
+// and the classic cpio convention of storing it only with the last, in which
+// case the earlier members are written once the data has been reached. A group
+// without any data is written as an empty file and links to it. Trailers are
+// omitted.
+//
+// Sockets result in [ErrUnsupportedFileType], returned as an [io/fs.PathError]
+// naming the offending entry.
+func ToTar(ir *Reader, tw *tar.Writer) error {
+	var links = tarLinks{
+		targets: make(map[hardLinkKey]string),
+		pending: make(map[hardLinkKey][]tar.Header),
+	}
+
+	err := ir.walk(func(hdr *Header) error {
+		if hdr.Trailer() {
+			return links.flush(tw)
+		}
+
+		if err := toTarEntry(ir, hdr, tw, &links); err != nil {
+			var pathErr *fs.PathError
+			if errors.As(err, &pathErr) {
+				return err
+			}
+			return &fs.PathError{Op: "ToTar", Path: hdr.Filename, Err: err}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// In case the archive lacks a final trailer
+	return links.flush(tw)
+}
+
+// Hard linked files being converted to tar, as of the last trailer.
+type tarLinks struct {
+	targets map[hardLinkKey]string       // Name of the member carrying the data
+	pending map[hardLinkKey][]tar.Header // Members without data seen before it
+	order   []hardLinkKey                // Of the pending groups
+}
+
+// Write any members of groups that never reached their data, the first as an
+// empty file and the rest as links to it, and forget every group.
+func (tl *tarLinks) flush(tw *tar.Writer) error {
+	for _, key := range tl.order {
+		var ths = tl.pending[key]
+
+		if err := tw.WriteHeader(&ths[0]); err != nil {
+			return err
+		}
+
+		if err := writeTarLinks(tw, ths[0].Name, ths[1:]); err != nil {
+			return err
+		}
+	}
+
+	clear(tl.targets)
+	clear(tl.pending)
+	tl.order = tl.order[:0]
+
+	return nil
+}
+
+// Write every header as a link to target.
+func writeTarLinks(tw *tar.Writer, target string, ths []tar.Header) error {
+	for i := range ths {
+		ths[i].Typeflag = tar.TypeLink
+		ths[i].Linkname = target
+
+		if err := tw.WriteHeader(&ths[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func toTarEntry(ir *Reader, hdr *Header, tw *tar.Writer, links *tarLinks) error {
+	var th = tar.Header{
+		Name:    normalizeName(hdr.Filename),
+		Mode:    int64(hdr.Mode & (Mode_SUID | Mode_SGID | Mode_Sticky | Mode_PermsMask)),
+		Uid:     int(hdr.Uid),
+		Gid:     int(hdr.Gid),
+		ModTime: hdr.Mtime,
+	}
+
+	var pending []tar.Header // Earlier members to link once the data is written
+
+	switch {
+	case hdr.Mode.File():
+		th.Typeflag = tar.TypeReg
+		th.Size = int64(hdr.DataSize)
+
+		if hdr.HardLinked() {
+			var key = hdr.hardLinkKey()
+
+			if target, ok := links.targets[key]; ok {
+				if hdr.DataSize == 0 {
+					th.Typeflag = tar.TypeLink
+					th.Linkname = target
+				}
+			} else if hdr.DataSize == 0 {
+				if _, ok := links.pending[key]; !ok {
+					links.order = append(links.order, key)
+				}
+				links.pending[key] = append(links.pending[key], th)
+				return nil
+			} else {
+				links.targets[key] = th.Name
+
+				if pending = links.pending[key]; pending != nil {
+					delete(links.pending, key)
+					links.order = slices.DeleteFunc(links.order, func(k hardLinkKey) bool { return k == key })
+				}
+			}
+		}
+
+	case hdr.Mode.Dir():
+		th.Typeflag = tar.TypeDir
+
+	case hdr.Mode.Symlink():
+		th.Typeflag = tar.TypeSymlink
+
+		target, err := ir.ReadSymlinkTarget()
+		if err != nil {
+			return err
+		}
+		th.Linkname = target
+
+	case hdr.Mode.CharDevice(), hdr.Mode.BlockDevice():
+		th.Typeflag = tar.TypeChar
+		if hdr.Mode.BlockDevice() {
+			th.Typeflag = tar.TypeBlock
+		}
+
+		th.Devmajor = int64(hdr.RMajor)
+		th.Devminor = int64(hdr.RMinor)
+
+	case hdr.Mode.FIFO():
+		th.Typeflag = tar.TypeFifo
+
+	default:
+		return ErrUnsupportedFileType
+	}
+
+	if err := tw.WriteHeader(&th); err != nil {
+		return err
+	}
+
+	if th.Typeflag == tar.TypeReg && th.Size > 0 {
+		if _, err := io.Copy(tw, ir); err != nil {
+			return err
+		}
+	}
+
+	if pending != nil {
+		return writeTarLinks(tw, th.Name, pending)
+	}
+
+	return nil
+}
@@ -0,0 +1,372 @@
+package initramfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFromTar(t *testing.T) {
+	var (
+		buf   bytes.Buffer
+		tw    = tar.NewWriter(&buf)
+		mtime = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	)
+
+	for _, th := range []*tar.Header{
+		{Typeflag: tar.TypeDir, Name: "./bin/", Mode: 0o755, ModTime: mtime},
+		{Typeflag: tar.TypeReg, Name: "./bin/busybox", Mode: 0o4755, Uid: 1, Gid: 2, Size: 7, ModTime: mtime},
+		{Typeflag: tar.TypeLink, Name: "./bin/ls", Linkname: "bin/busybox", ModTime: mtime},
+		{Typeflag: tar.TypeSymlink, Name: "./bin/sh", Linkname: "busybox", Mode: 0o777, ModTime: mtime},
+		{Typeflag: tar.TypeChar, Name: "./dev/console", Mode: 0o600, Devmajor: 5, Devminor: 1, ModTime: mtime},
+		{Typeflag: tar.TypeBlock, Name: "./dev/sda", Mode: 0o660, Devmajor: 8, ModTime: mtime},
+		{Typeflag: tar.TypeFifo, Name: "./run/initctl", Mode: 0o600, ModTime: mtime},
+	} {
+		if err := tw.WriteHeader(th); err != nil {
+			t.Fatalf("tar WriteHeader %s: %s", th.Name, err)
+		}
+		if th.Size > 0 {
+			if _, err := tw.Write([]byte("busybox")); err != nil {
+				t.Fatalf("tar Write: %s", err)
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar Close: %s", err)
+	}
+
+	w, r := testWriterReader(t)
+
+	if err := FromTar(tar.NewReader(&buf), w); err != nil {
+		t.Fatalf("FromTar: %s", err)
+	}
+
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var (
+		hdrs = make(map[string]Header)
+		data = make(map[string]string)
+	)
+	for _, hdr := range r.All() {
+		hdrs[hdr.Filename] = hdr
+
+		if hdr.DataSize > 0 {
+			b, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll %s: %s", hdr.Filename, err)
+			}
+			data[hdr.Filename] = string(b)
+		}
+	}
+
+	var (
+		busybox = hdrs["bin/busybox"]
+		ls      = hdrs["bin/ls"]
+	)
+
+	if busybox.Mode != Mode_File|Mode_SUID|0o755 || busybox.Uid != 1 || busybox.Gid != 2 || !busybox.Mtime.Equal(mtime) {
+		t.Errorf("bin/busybox: unexpected header %s", &busybox)
+	}
+	if data["bin/busybox"] != "busybox" {
+		t.Errorf("bin/busybox: unexpected data %q", data["bin/busybox"])
+	}
+	if ls.Inode != busybox.Inode || ls.DataSize != 0 || !ls.HardLinked() || !busybox.HardLinked() {
+		t.Errorf("bin/ls: expected hard link to inode %d, got %s (inode %d)", busybox.Inode, &ls, ls.Inode)
+	}
+
+	if sh := hdrs["bin/sh"]; !sh.Mode.Symlink() || data["bin/sh"] != "busybox" {
+		t.Errorf("bin/sh: unexpected symlink %s -> %q", &sh, data["bin/sh"])
+	}
+	if con := hdrs["dev/console"]; !con.Mode.CharDevice() || con.RMajor != 5 || con.RMinor != 1 {
+		t.Errorf("dev/console: unexpected header %s", &con)
+	}
+	if sda := hdrs["dev/sda"]; !sda.Mode.BlockDevice() || sda.RMajor != 8 || sda.RMinor != 0 {
+		t.Errorf("dev/sda: unexpected header %s", &sda)
+	}
+	if fifo := hdrs["run/initctl"]; !fifo.Mode.FIFO() || fifo.Mode.Perms() != 0o600 {
+		t.Errorf("run/initctl: unexpected header %s", &fifo)
+	}
+	if _, ok := hdrs["run"]; !ok {
+		t.Errorf("expected parent directory run to be created")
+	}
+}
+
+// Returns a tar stream with a single (GNU format) entry of the given type,
+// which need not be one that [archive/tar.Writer] permits.
+func testTarEntry(t *testing.T, typeflag byte, name, linkname string) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Linkname: linkname, Format: tar.FormatGNU}); err != nil {
+		t.Fatalf("tar WriteHeader: %s", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar Close: %s", err)
+	}
+
+	// Patch the type flag, and recompute the header checksum
+	var blk = buf.Bytes()[:512]
+	blk[156] = typeflag
+	copy(blk[148:156], "        ")
+
+	var sum int
+	for _, c := range blk {
+		sum += int(c)
+	}
+	copy(blk[148:156], fmt.Sprintf("%06o\x00 ", sum))
+
+	return &buf
+}
+
+func TestFromTar_Unsupported(t *testing.T) {
+	for _, tc := range []struct {
+		typeflag byte
+		name     string
+		linkname string
+		expect   error
+	}{
+		{tar.TypeGNUSparse, "sparse", "", ErrUnsupportedFileType},
+		{'V', "volume", "", ErrUnsupportedFileType},
+		{tar.TypeLink, "link", "missing", ErrUnknownHardLink},
+	} {
+		var (
+			tr  = tar.NewReader(testTarEntry(t, tc.typeflag, tc.name, tc.linkname))
+			out bytes.Buffer
+		)
+
+		err := FromTar(tr, NewWriter(&out))
+
+		var pathErr *fs.PathError
+		if !errors.Is(err, tc.expect) || !errors.As(err, &pathErr) || pathErr.Path != tc.name {
+			t.Errorf("%s: expected %v naming the entry, got %v", tc.name, tc.expect, err)
+		}
+	}
+}
+
+func TestToTar(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	var mtime = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	var hdr = Header{
+		Mode:     Mode_File | Mode_SGID | 0o755,
+		Uid:      3,
+		Gid:      4,
+		NumLinks: 2,
+		Mtime:    mtime,
+		Filename: "bin/busybox",
+		DataSize: 7,
+	}
+	if err := w.WriteHeader(&hdr); err != nil {
+		t.Fatalf("WriteHeader: %s", err)
+	}
+	if _, err := w.Write([]byte("busybox")); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+
+	if err := w.WriteHardLink("bin/ls", hdr.Inode); err != nil {
+		t.Fatalf("WriteHardLink: %s", err)
+	}
+	if err := w.WriteSymlink("bin/sh", "busybox", 0); err != nil {
+		t.Fatalf("WriteSymlink: %s", err)
+	}
+	if err := w.WriteBlockDevice("dev/sda", 0o660, 8, 1); err != nil {
+		t.Fatalf("WriteBlockDevice: %s", err)
+	}
+	if err := w.WriteFIFO("run/initctl", 0o600); err != nil {
+		t.Fatalf("WriteFIFO: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var buf bytes.Buffer
+
+	tw := tar.NewWriter(&buf)
+	if err := ToTar(r, tw); err != nil {
+		t.Fatalf("ToTar: %s", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar Close: %s", err)
+	}
+
+	var (
+		tr   = tar.NewReader(&buf)
+		ths  = make(map[string]*tar.Header)
+		data string
+	)
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("tar Next: %s", err)
+		}
+
+		ths[th.Name] = th
+
+		if th.Name == "bin/busybox" {
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("tar ReadAll: %s", err)
+			}
+			data = string(b)
+		}
+	}
+
+	if th := ths["bin/busybox"]; th.Typeflag != tar.TypeReg || th.Mode != 0o2755 || th.Uid != 3 || th.Gid != 4 || !th.ModTime.Equal(mtime) || data != "busybox" {
+		t.Errorf("bin/busybox: unexpected %+v with data %q", th, data)
+	}
+	if th := ths["bin/ls"]; th.Typeflag != tar.TypeLink || th.Linkname != "bin/busybox" {
+		t.Errorf("bin/ls: unexpected %+v", th)
+	}
+	if th := ths["bin/sh"]; th.Typeflag != tar.TypeSymlink || th.Linkname != "busybox" {
+		t.Errorf("bin/sh: unexpected %+v", th)
+	}
+	if th := ths["dev/sda"]; th.Typeflag != tar.TypeBlock || th.Devmajor != 8 || th.Devminor != 1 || th.Mode != 0o660 {
+		t.Errorf("dev/sda: unexpected %+v", th)
+	}
+	if th := ths["run/initctl"]; th.Typeflag != tar.TypeFifo {
+		t.Errorf("run/initctl: unexpected %+v", th)
+	}
+	if th := ths["run"]; th == nil || th.Typeflag != tar.TypeDir {
+		t.Errorf("run: unexpected %+v", th)
+	}
+}
+
+func TestToTar_SymlinkTooLong(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	var target = strings.Repeat("a", DefaultMaxSymlinkSize+1)
+
+	testWriteHeader(t, w, &Header{Mode: Mode_Symlink | 0o777, DataSize: uint32(len(target)), Filename: "long"})
+	w.Write([]byte(target))
+
+	if err := ToTar(r, tar.NewWriter(io.Discard)); !errors.Is(err, ErrSymlinkTooLong) {
+		t.Fatalf("expected ErrSymlinkTooLong, got %v", err)
+	}
+}
+
+func TestToTar_HardLinks(t *testing.T) {
+	type entry struct {
+		name     string
+		typeflag byte
+		size     int64
+		linkname string
+	}
+
+	var testcases = []struct {
+		name   string
+		sizes  [3]uint32 // Of links a, b and c
+		expect []entry
+	}{
+		{"data-first", [3]uint32{5, 0, 0}, []entry{
+			{"a", tar.TypeReg, 5, ""},
+			{"b", tar.TypeLink, 0, "a"},
+			{"c", tar.TypeLink, 0, "a"},
+		}},
+		{"data-last", [3]uint32{0, 0, 5}, []entry{
+			{"c", tar.TypeReg, 5, ""},
+			{"a", tar.TypeLink, 0, "c"},
+			{"b", tar.TypeLink, 0, "c"},
+		}},
+		{"no-data", [3]uint32{0, 0, 0}, []entry{
+			{"a", tar.TypeReg, 0, ""},
+			{"b", tar.TypeLink, 0, "a"},
+			{"c", tar.TypeLink, 0, "a"},
+		}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				b bytes.Buffer
+				w = NewWriter(&b)
+			)
+
+			for i, name := range []string{"a", "b", "c"} {
+				testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Inode: 42, NumLinks: 3, DataSize: tc.sizes[i], Filename: name})
+				if tc.sizes[i] > 0 {
+					w.Write([]byte("hello"))
+				}
+			}
+			if err := w.WriteTrailer(); err != nil {
+				t.Fatalf("WriteTrailer: %s", err)
+			}
+
+			var buf bytes.Buffer
+
+			tw := tar.NewWriter(&buf)
+			if err := ToTar(NewReader(&b), tw); err != nil {
+				t.Fatalf("ToTar: %s", err)
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatalf("tar Close: %s", err)
+			}
+
+			var (
+				tr  = tar.NewReader(&buf)
+				got []entry
+			)
+			for {
+				th, err := tr.Next()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("tar Next: %s", err)
+				}
+
+				if th.Typeflag != tar.TypeDir {
+					got = append(got, entry{th.Name, th.Typeflag, th.Size, th.Linkname})
+				}
+			}
+
+			if !slices.Equal(got, tc.expect) {
+				t.Errorf("expected %v, got %v", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestToTar_RoundTrip(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	for _, name := range []string{"etc/hostname", "etc/motd"} {
+		if err := w.WriteFile(name, 0o644, []byte(name)); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var buf bytes.Buffer
+
+	tw := tar.NewWriter(&buf)
+	if err := ToTar(r, tw); err != nil {
+		t.Fatalf("ToTar: %s", err)
+	}
+	tw.Close()
+
+	w2, r2 := testWriterReader(t)
+	if err := FromTar(tar.NewReader(&buf), w2); err != nil {
+		t.Fatalf("FromTar: %s", err)
+	}
+	w2.WriteTrailer()
+
+	var hdrs headerList
+	hdrs.readAll(r2)
+	hdrs.expectNames(t, ".", "etc", "etc/hostname", "etc/motd", TrailerFilename)
+}
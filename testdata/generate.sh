@@ -32,5 +32,6 @@ compress "data.cpio"    ".bz2"      "bzip2 -c"
 compress "data.cpio"    ".lzma"     "lzma -c"
 compress "data.cpio"    ".xz"       "xz --check=crc32 -9 --lzma2=dict=1MiB -c"
 compress "data.cpio"    ".lzo"      "lzop -9 -c"
+# The kernel only accepts the LZ4 legacy frame format, hence -l
 compress "data.cpio"    ".lz4"      "lz4 -2 -l -c"
 compress "data.cpio"    ".zstd"     "zstd -q -1 -T0 -c"
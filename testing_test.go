@@ -66,6 +66,14 @@ func testMkdirAll(t *testing.T, w *Writer, path string, perm Mode) {
 	}
 }
 
+func testGzipWriterLevel(t *testing.T, level int) CompressWriter {
+	gw, err := GzipWriterLevel(level)
+	if err != nil {
+		t.Fatalf("GzipWriterLevel %d: %s", level, err)
+	}
+	return gw
+}
+
 type headerList []Header
 
 func (hdrs *headerList) readAll(r *Reader) {
@@ -85,3 +93,16 @@ func (hdrs headerList) expectNames(t *testing.T, names ...string) {
 		t.Errorf("expected names %v, got %v", names, got)
 	}
 }
+
+func testNextNamed(t *testing.T, r *Reader, name string) *Header {
+	hdr, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next: %s", err)
+	}
+
+	if hdr.Filename != name {
+		t.Fatalf("expected next header %s, got %s", name, hdr.Filename)
+	}
+
+	return hdr
+}
@@ -0,0 +1,226 @@
+package initramfs
+
+import (
+	"io"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Normalize an archive member filename into a relative, slash separated path
+// without any leading slashes, or "." for the root.
+func normalizeName(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+	return name
+}
+
+// Scan the entire archive, including any compressed segments, and group the
+// headers by their parent directory.
+//
+// The map is keyed by normalized directory path ("." for the root), and each
+// value lists the immediate children of that directory in archive order. The
+// Filename of every returned header is normalized in the same way. Trailer
+// entries are omitted.
+func BuildDirIndex(r *Reader) (map[string][]Header, error) {
+	var index = make(map[string][]Header)
+
+	err := r.walk(func(hdr *Header) error {
+		if hdr.Trailer() {
+			return nil
+		}
+
+		hdr.Filename = normalizeName(hdr.Filename)
+		if hdr.Filename == "." {
+			return nil
+		}
+
+		var dir = path.Dir(hdr.Filename)
+		index[dir] = append(index[dir], *hdr)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// Returns the set of directories that must exist for every one of the paths to
+// have all of its ancestors, including the root ("."), as normalized paths. The
+// paths themselves are not included, unless they are also the ancestor of
+// another. The result is sorted such that every directory follows its parent.
+//
+// This is the same set of directories that [Writer.MkdirAll] would create, so
+// a builder may use it to plan for or pre-create them.
+func RequiredDirs(paths []string) []string {
+	var set = make(map[string]struct{})
+
+	for _, name := range paths {
+		name = normalizeName(name)
+		if name == "." {
+			continue
+		}
+
+		for _, prefix := range splitBytePrefixAll(path.Dir(name), '/') {
+			set[prefix] = struct{}{}
+		}
+	}
+
+	var dirs = slices.Collect(maps.Keys(set))
+
+	slices.SortFunc(dirs, func(a, b string) int {
+		// The root sorts first; otherwise a parent is always a prefix of its
+		// children and so sorts before them
+		switch {
+		case a == b:
+			return 0
+		case a == ".":
+			return -1
+		case b == ".":
+			return 1
+		default:
+			return strings.Compare(a, b)
+		}
+	})
+
+	return dirs
+}
+
+// The largest file data that [BuildTree] keeps in memory for each node.
+const MaxTreeDataSize = 64 << 10
+
+// A node of the tree of archive entries built by [BuildTree].
+type Node struct {
+	// The Filename is normalized, and the HeaderOffset and DataOffset are
+	// relative to the (possibly decompressed) stream in which it was found
+	Header Header
+
+	// The compression of the segment in which the entry was found, as per
+	// [Reader.CurrentCodec], being [UnknownLookahead] if it was uncompressed
+	Compression Lookahead
+
+	// The file data, if it is no larger than [MaxTreeDataSize]. Otherwise, only
+	// the data of an entry from an uncompressed segment may be read later, at
+	// Header.DataOffset (see [Reader.ExtractAt]), as the offset of an entry
+	// from a compressed segment is within its decompressed stream.
+	Data []byte
+
+	// Children by base name, for a directory
+	Children map[string]*Node
+
+	// Whether the node is a directory that was not present as an entry, having
+	// been synthesized with [SyntheticDirMode]
+	Synthetic bool
+}
+
+// Scan the entire archive, including any compressed segments, and build a tree
+// of its entries rooted at ".".
+//
+// Filenames are normalized, and parent directories that are not explicitly
+// present as entries are synthesized. If the same name appears more than once,
+// the last entry wins, as it would when the kernel unpacks the archive.
+// Trailer entries are omitted.
+func BuildTree(r *Reader) (*Node, error) {
+	var root = newSyntheticNode(".")
+
+	err := r.walk(func(hdr *Header) error {
+		if hdr.Trailer() {
+			return nil
+		}
+
+		var node = Node{Header: *hdr, Compression: r.CurrentCodec()}
+		node.Header.Filename = normalizeName(hdr.Filename)
+
+		if hdr.DataSize > 0 && hdr.DataSize <= MaxTreeDataSize {
+			node.Data = make([]byte, hdr.DataSize)
+			if _, err := io.ReadFull(r, node.Data); err != nil {
+				return err
+			}
+		}
+
+		root.insert(&node)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+func newSyntheticNode(name string) *Node {
+	return &Node{
+		Header:    Header{Mode: SyntheticDirMode, Filename: name},
+		Synthetic: true,
+	}
+}
+
+// Place node at its Filename beneath n, which must be the root.
+func (n *Node) insert(node *Node) {
+	var name = node.Header.Filename
+
+	if name == "." {
+		node.Children = n.Children
+		*n = *node
+		return
+	}
+
+	var parent = n
+	for _, elem := range strings.Split(path.Dir(name), "/") {
+		if elem == "." {
+			break
+		}
+
+		child, ok := parent.Children[elem]
+		if !ok {
+			child = newSyntheticNode(path.Join(parent.Header.Filename, elem))
+			parent.addChild(elem, child)
+		}
+		parent = child
+	}
+
+	var base = path.Base(name)
+	if prev, ok := parent.Children[base]; ok {
+		node.Children = prev.Children
+	}
+	parent.addChild(base, node)
+}
+
+func (n *Node) addChild(base string, child *Node) {
+	if n.Children == nil {
+		n.Children = make(map[string]*Node)
+	}
+	n.Children[base] = child
+}
+
+// Call fn for this node and every node beneath it, depth first with the
+// children of each directory in lexical order, passing the normalized path of
+// each. If fn returns [io/fs.SkipDir] for a node, its children are skipped;
+// any other error stops the walk and is returned.
+func (n *Node) Walk(fn func(path string, n *Node) error) error {
+	err := n.walk(fn)
+	if err == fs.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (n *Node) walk(fn func(path string, n *Node) error) error {
+	if err := fn(n.Header.Filename, n); err != nil {
+		return err
+	}
+
+	for _, base := range slices.Sorted(maps.Keys(n.Children)) {
+		if err := n.Children[base].walk(fn); err != nil && err != fs.SkipDir {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package initramfs
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"slices"
+	"testing"
+)
+
+func TestBuildDirIndex(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	testMkdirAll(t, w, "/etc", 0o755)
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Filename: "/etc/hostname"})
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o755, Filename: "/init"})
+
+	if err := w.StartCompressionType(Gzip); err != nil {
+		t.Fatalf("StartCompressionType: %s", err)
+	}
+
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o755, Filename: "/bin/busybox"})
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Filename: "/etc/passwd"})
+
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	index, err := BuildDirIndex(r)
+	if err != nil {
+		t.Fatalf("BuildDirIndex: %s", err)
+	}
+
+	var testcases = []struct {
+		dir   string
+		names []string
+	}{
+		{".", []string{"etc", "init", "bin"}},
+		{"etc", []string{"etc/hostname", "etc/passwd"}},
+		{"bin", []string{"bin/busybox"}},
+	}
+
+	for _, tc := range testcases {
+		var got []string
+		for _, hdr := range index[tc.dir] {
+			got = append(got, hdr.Filename)
+		}
+
+		if !slices.Equal(tc.names, got) {
+			t.Errorf("dir %s: expected %v, got %v", tc.dir, tc.names, got)
+		}
+	}
+}
+
+func TestRequiredDirs(t *testing.T) {
+	var dirs = RequiredDirs([]string{
+		"/usr/lib/modules/6.1/kernel/e1000.ko",
+		"usr/bin/busybox",
+		"init",
+		"/etc/",
+		"etc/hosts",
+		"/",
+		"+plus/file",
+		"usr/bin/../sbin/tool",
+	})
+
+	var expect = []string{
+		".",
+		"+plus",
+		"etc",
+		"usr",
+		"usr/bin",
+		"usr/lib",
+		"usr/lib/modules",
+		"usr/lib/modules/6.1",
+		"usr/lib/modules/6.1/kernel",
+		"usr/sbin",
+	}
+
+	if !slices.Equal(dirs, expect) {
+		t.Errorf("expected %v, got %v", expect, dirs)
+	}
+}
+
+func TestBuildTree(t *testing.T) {
+	raw, err := Build(func(iw *Writer) error {
+		if err := iw.WriteFile("init", 0o755, []byte("old")); err != nil {
+			return err
+		}
+		if err := iw.WriteFile("init", 0o755, []byte("#!/bin/sh\n")); err != nil {
+			return err
+		}
+		if err := iw.WriteFile("boot/big.img", 0o644, make([]byte, MaxTreeDataSize+1)); err != nil {
+			return err
+		}
+
+		// Parent directories of this file are deliberately not present
+		if err := iw.writeHeader(&Header{Mode: Mode_File | 0o644, DataSize: 5, Filename: "lib/modules/e1000.ko"}); err != nil {
+			return err
+		}
+		_, err := iw.Write([]byte("\x7fELF\n"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Build: %s", err)
+	}
+
+	root, err := BuildTree(NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("BuildTree: %s", err)
+	}
+
+	var paths []string
+	err = root.Walk(func(path string, n *Node) error {
+		paths = append(paths, path)
+
+		if n.Header.Filename != path {
+			t.Errorf("%s: node has filename %s", path, n.Header.Filename)
+		}
+
+		if expect := path == "lib" || path == "lib/modules"; n.Synthetic != expect {
+			t.Errorf("%s: expected synthetic %v", path, expect)
+		}
+
+		if path == "boot" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %s", err)
+	}
+
+	if expect := []string{".", "boot", "init", "lib", "lib/modules", "lib/modules/e1000.ko"}; !slices.Equal(paths, expect) {
+		t.Errorf("expected %q, got %q", expect, paths)
+	}
+
+	if data := root.Children["init"].Data; string(data) != "#!/bin/sh\n" {
+		t.Errorf("init: expected the last entry to win, got %q", data)
+	}
+
+	var big = root.Children["boot"].Children["big.img"]
+	if big.Data != nil || big.Header.DataOffset == 0 {
+		t.Errorf("big.img: expected only an offset, got %d bytes at %d", len(big.Data), big.Header.DataOffset)
+	}
+
+	var errStop = errors.New("stop")
+	if err := root.Walk(func(string, *Node) error { return errStop }); err != errStop {
+		t.Errorf("expected the walk error, got %v", err)
+	}
+}
+
+func TestBuildTree_Compression(t *testing.T) {
+	root, err := BuildTree(NewReader(bytes.NewReader(testSegmentedArchive(t, true))))
+	if err != nil {
+		t.Fatalf("BuildTree: %s", err)
+	}
+
+	if n := root.Children["kernel"]; n == nil || n.Compression != UnknownLookahead {
+		t.Errorf("kernel: expected an uncompressed entry, got %+v", n)
+	}
+	if n := root.Children["init"]; n == nil || n.Compression != Gzip {
+		t.Errorf("init: expected an entry from the gzip segment, got %+v", n)
+	}
+}
@@ -0,0 +1,238 @@
+package initramfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrBadKernelVersion = errors.New("initramfs: malformed kernel version")
+	ErrKernelTooOld     = errors.New("initramfs: content is not supported by the target kernel version")
+)
+
+// Configures the checks made by [Validate].
+type ValidateOption func(v *validator)
+
+type validator struct {
+	kernelVersion string
+}
+
+// Report any compressed segment using a codec that the given kernel version
+// (such as "5.4" or "4.19.0") does not support, see [Lookahead.SupportedSince].
+func RequireKernelVersion(version string) ValidateOption {
+	return func(v *validator) { v.kernelVersion = version }
+}
+
+// Errors reported by [Validate] for structural problems.
+var (
+	ErrFilenameSizeMismatch = errors.New("initramfs: header filename size does not match the filename")
+	ErrMisalignedHeader     = errors.New("initramfs: header is not 4 byte aligned")
+)
+
+// A problem found by [Validate], or by a strict [Reader] (see
+// [Reader.SetStrict]), at an offset relative to the start of the current
+// (possibly decompressed) stream.
+type ValidationError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("initramfs: at offset %d: %s", e.Offset, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// Read the entire archive, continuing through any compressed segments using the
+// global [CompressReaders], and check that it is well-formed:
+//   - Every header has a newc magic (see [Magic_070701]) and valid fields
+//   - Every FilenameSize matches the length of the filename
+//   - Every header is 4 byte aligned
+//   - Each archive is ended by a trailer
+//   - Every [Magic_070702] entry has a matching checksum (see [Reader.SetVerifyChecksum], which is enabled on r)
+//
+// Along with any further checks given by the options.
+//
+// Every problem found is reported, combined using [errors.Join], such that the
+// absence of an error means the archive passed all checks. Problems within the
+// archive are reported as a [*ValidationError] giving the offset. After a
+// malformed header, reading resumes from the next valid header (see
+// [Reader.Resync]).
+func Validate(r *Reader, opts ...ValidateOption) error {
+	var v validator
+	for _, opt := range opts {
+		opt(&v)
+	}
+
+	if v.kernelVersion != "" {
+		if _, err := parseKernelVersion(v.kernelVersion); err != nil {
+			return err
+		}
+	}
+
+	r.SetVerifyChecksum(true)
+
+	var (
+		errs      []error
+		entries   int   // Since the start of the current segment
+		lastErrAt int64 = -1
+	)
+
+	// Each archive, before compressed data or the end of the input, must have
+	// ended with a trailer, as must an input without any entries at all
+	var checkTrailer = func(end bool) {
+		if (entries > 0 || end && r.entries == 0) && !r.SawTrailer() {
+			errs = append(errs, &ValidationError{Offset: r.nread, Err: ErrMissingTrailer})
+		}
+	}
+
+Loop:
+	for {
+		var hdr Header
+		err := r.next(&hdr)
+
+		var sumErr *ChecksumError
+		switch {
+		case err == nil:
+			entries++
+			errs = append(errs, v.checkHeader(&hdr)...)
+
+		case err == io.EOF && len(r.outer) == 0:
+			checkTrailer(true)
+			break Loop
+
+		case err == io.EOF, err == ErrCompressedContentAhead:
+			checkTrailer(false)
+			entries = 0
+
+			_, la, err := r.ContinueCompressed(nil)
+			if err == nil || err == ErrNoCompressReader {
+				errs = append(errs, v.checkCodec(la))
+			}
+			if err == io.EOF {
+				break Loop
+			} else if err != nil {
+				errs = append(errs, err)
+				break Loop
+			}
+
+		case errors.As(err, &sumErr):
+			// The data has been consumed, so reading can continue
+			errs = append(errs, &ValidationError{Offset: r.cur.DataOffset, Err: err})
+
+		case err == ErrLimitExceeded:
+			errs = append(errs, err)
+			break Loop
+
+		default:
+			if r.nread == lastErrAt {
+				// No progress has been made since the last problem
+				break Loop
+			}
+			lastErrAt = r.nread
+
+			if ucErr, ok := err.(*UnexpectedContentError); ok {
+				errs = append(errs, ucErr)
+			} else {
+				errs = append(errs, &ValidationError{Offset: r.Offset(), Err: err})
+			}
+
+			if _, err := r.Resync(); err != nil {
+				break Loop
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (v *validator) checkHeader(hdr *Header) (errs []error) {
+	var problem = func(err error) {
+		errs = append(errs, &ValidationError{Offset: hdr.HeaderOffset, Err: fmt.Errorf("%s: %w", hdr.Filename, err)})
+	}
+
+	if hdr.Magic != Magic_070701 && hdr.Magic != Magic_070702 {
+		problem(ErrBadHeaderMagic)
+	}
+	if hdr.FilenameSize != uint32(len(hdr.Filename)+1) {
+		problem(ErrFilenameSizeMismatch)
+	}
+	if hdr.HeaderOffset%4 != 0 {
+		problem(ErrMisalignedHeader)
+	}
+
+	return
+}
+
+func (v *validator) checkCodec(la Lookahead) error {
+	if v.kernelVersion == "" {
+		return nil
+	}
+
+	var since = la.SupportedSince()
+	if since == "" {
+		return nil
+	}
+
+	if cmp, err := compareKernelVersions(v.kernelVersion, since); err != nil {
+		return err
+	} else if cmp < 0 {
+		return fmt.Errorf("%w: %s compression requires %s, target is %s", ErrKernelTooOld, la, since, v.kernelVersion)
+	}
+
+	return nil
+}
+
+// Parse the numeric components of a kernel version, ignoring any suffix such as
+// "-rc1" or "-generic".
+func parseKernelVersion(version string) ([]int, error) {
+	version, _, _ = strings.Cut(version, "-")
+
+	var parts = strings.Split(version, ".")
+	var nums = make([]int, len(parts))
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrBadKernelVersion, version)
+		}
+		nums[i] = n
+	}
+
+	return nums, nil
+}
+
+// Compare two kernel versions, where missing trailing components are 0.
+func compareKernelVersions(a, b string) (int, error) {
+	x, err := parseKernelVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	y, err := parseKernelVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range max(len(x), len(y)) {
+		var m, n int
+		if i < len(x) {
+			m = x[i]
+		}
+		if i < len(y) {
+			n = y[i]
+		}
+
+		if m != n {
+			if m < n {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,180 @@
+package initramfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestValidate_RequireKernelVersion(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	testMkdirHeader(t, w, "etc", nil)
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	// Follow with the start of a zstd compressed segment
+	buf.Write(make([]byte, alignFill(int64(buf.Len()), StartCompressionAlignment)))
+	buf.Write([]byte{0x28, 0xb5, 0x2f, 0xfd})
+	buf.Write(bytes.Repeat([]byte{0xaa}, 100))
+
+	var raw = buf.Bytes()
+
+	err := Validate(NewReader(bytes.NewReader(raw)), RequireKernelVersion("4.19"))
+	if !errors.Is(err, ErrKernelTooOld) {
+		t.Errorf("expected ErrKernelTooOld, got %v", err)
+	}
+
+	err = Validate(NewReader(bytes.NewReader(raw)), RequireKernelVersion("6.1.0-rc2"))
+	if errors.Is(err, ErrKernelTooOld) {
+		t.Errorf("unexpected ErrKernelTooOld: %v", err)
+	}
+
+	err = Validate(NewReader(bytes.NewReader(raw)), RequireKernelVersion("five"))
+	if !errors.Is(err, ErrBadKernelVersion) {
+		t.Errorf("expected ErrBadKernelVersion, got %v", err)
+	}
+}
+
+func TestLookahead_SupportedSince(t *testing.T) {
+	for _, tc := range []struct {
+		version string
+		la      Lookahead
+		cmp     int
+	}{
+		{"2.6.38", Xz, 0},
+		{"2.6.37", Xz, -1},
+		{"3.11", Lz4, 0},
+		{"5.8.18", Zstd, -1},
+		{"5.10", Zstd, 1},
+		{"2.6", Gzip, 0},
+	} {
+		cmp, err := compareKernelVersions(tc.version, tc.la.SupportedSince())
+		if err != nil {
+			t.Fatalf("compareKernelVersions: %s", err)
+		}
+
+		if cmp != tc.cmp {
+			t.Errorf("%s vs %s: expected %d, got %d", tc.version, tc.la, tc.cmp, cmp)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var build = func(fn func(w *Writer, buf *bytes.Buffer)) []byte {
+		var buf bytes.Buffer
+
+		w := NewWriter(&buf)
+		fn(w, &buf)
+
+		return buf.Bytes()
+	}
+
+	t.Run("well formed", func(t *testing.T) {
+		var raw = build(func(w *Writer, buf *bytes.Buffer) {
+			w.SetDefaultMagic(Magic_070702)
+			w.SetAutoChecksum(true)
+			w.WriteFile("etc/motd", 0o644, []byte("hello"))
+			w.WriteTrailer()
+		})
+
+		if err := Validate(NewReader(bytes.NewReader(raw))); err != nil {
+			t.Errorf("expected no problems, got %v", err)
+		}
+	})
+
+	t.Run("problems", func(t *testing.T) {
+		var lateOffset int64
+
+		var raw = build(func(w *Writer, buf *bytes.Buffer) {
+			var hdr = Header{Magic: Magic_070702, Mode: Mode_File | 0o644, DataSize: 5, Checksum: 1, Filename: "etc/motd"}
+			w.WriteHeader(&hdr)
+			w.Write([]byte("hello"))
+
+			w.WriteFile("init", 0o755, nil)
+			w.Flush()
+
+			// A header with a bad magic
+			buf.WriteString("070709")
+			buf.Write(bytes.Repeat([]byte{'0'}, HeaderSize-6))
+			buf.Write(make([]byte, 6))
+
+			// A header at an unaligned offset, that also has a mismatched
+			// filename size, and no trailer follows
+			lateOffset = int64(buf.Len() + 1)
+			buf.WriteByte(0)
+			var late = (&Header{Magic: Magic_070701, Mode: Mode_File, Filename: "late"}).Bytes()
+			copy(late[6+11*8:], "00000009") // FilenameSize
+			buf.Write(late[:HeaderSize])
+			buf.WriteString("late\x00\x00\x00\x00\x00")
+		})
+
+		err := Validate(NewReader(bytes.NewReader(raw)))
+
+		for _, target := range []error{ErrMisalignedHeader, ErrFilenameSizeMismatch, ErrMissingTrailer} {
+			if !errors.Is(err, target) {
+				t.Errorf("expected %v to be reported, got %v", target, err)
+			}
+		}
+
+		var sumErr *ChecksumError
+		if !errors.As(err, &sumErr) || sumErr.Filename != "etc/motd" {
+			t.Errorf("expected a checksum error for etc/motd, got %v", err)
+		}
+
+		var ucErr *UnexpectedContentError
+		if !errors.As(err, &ucErr) {
+			t.Errorf("expected the bad magic to be reported as unexpected content, got %v", err)
+		}
+
+		var offsets = make(map[int64]bool)
+		for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+			var vErr *ValidationError
+			if errors.As(err, &vErr) {
+				offsets[vErr.Offset] = true
+			}
+		}
+		if !offsets[lateOffset] {
+			t.Errorf("expected a problem at offset %d, got %v", lateOffset, offsets)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		// Incompressible data, so that the compressed segment is cut off part
+		// way through it
+		var data = make([]byte, 64<<10)
+		rand.New(rand.NewSource(1)).Read(data)
+
+		var raw = build(func(w *Writer, buf *bytes.Buffer) {
+			w.StartCompressionType(Gzip)
+			w.WriteFile("big", 0o644, data)
+			w.WriteTrailer()
+			w.Close()
+		})
+		raw = raw[:len(raw)/2]
+
+		var hdrs headerList
+		if ar, err := NewAutoReader(bytes.NewReader(raw), nil); err != nil {
+			t.Fatalf("NewAutoReader: %s", err)
+		} else {
+			hdrs.readAll(ar)
+		}
+		if len(hdrs) != 2 || hdrs[1].Filename != "big" {
+			t.Fatalf("unexpected archive layout: %v", hdrs)
+		}
+
+		var vErr *ValidationError
+		if err := Validate(NewReader(bytes.NewReader(raw))); !errors.As(err, &vErr) || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected a ValidationError for the truncated data, got %v", err)
+		}
+
+		// Reported where reading stopped, once the file data was abandoned
+		if expect := hdrs[1].DataOffset + int64(hdrs[1].DataSize); vErr.Offset != expect {
+			t.Errorf("expected offset %d, got %d", expect, vErr.Offset)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package initramfs
+
+import "path"
+
+// The name of the marker file that designates its parent directory as opaque in
+// an OCI image layer. See [OCI image layer whiteouts].
+//
+// [OCI image layer whiteouts]: https://github.com/opencontainers/image-spec/blob/main/layer.md#whiteouts
+const OpaqueMarkerName = ".wh..wh..opq"
+
+// Add an overlayfs whiteout, which hides the file of the same name in any lower
+// layer. This is a character device with device numbers 0/0 and no permission
+// bits. See [Documentation/filesystems/overlayfs.rst].
+//
+// [Documentation/filesystems/overlayfs.rst]: https://docs.kernel.org/filesystems/overlayfs.html#whiteouts-and-opaque-directories
+func (iw *Writer) WriteWhiteout(name string) error {
+	return iw.writeNode(name, Mode_CharDevice, 0, 0)
+}
+
+// Add a directory (with the default permissions, see [Writer.MkdirAll]) whose
+// contents replace, rather than merge with, those of the same directory in any
+// lower layer.
+//
+// Overlayfs marks opaque directories with the "trusted.overlay.opaque" extended
+// attribute, which the newc format cannot carry. Instead, an empty file named
+// [OpaqueMarkerName] is added within the directory, which is how OCI image
+// layers express the same thing. Whatever assembles the overlay from the
+// unpacked archive must translate the marker into the attribute.
+func (iw *Writer) WriteOpaqueDir(name string) error {
+	var hdr = Header{
+		Mode:     Mode_Dir | iw.defaultDirPerm,
+		Filename: name,
+	}
+
+	if err := iw.WriteHeader(&hdr); err != nil {
+		return err
+	}
+
+	return iw.WriteFile(path.Join(hdr.Filename, OpaqueMarkerName), 0, nil)
+}
+
+// Reports whether the header is an overlayfs whiteout, see
+// [Writer.WriteWhiteout].
+func (hdr *Header) IsWhiteout() bool {
+	return hdr.Mode.CharDevice() && hdr.RMajor == 0 && hdr.RMinor == 0
+}
@@ -0,0 +1,46 @@
+package initramfs
+
+import "testing"
+
+func TestWriter_WriteWhiteout(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	if err := w.WriteWhiteout("etc/motd"); err != nil {
+		t.Fatalf("WriteWhiteout: %s", err)
+	}
+	if err := w.WriteOpaqueDir("/usr/share"); err != nil {
+		t.Fatalf("WriteOpaqueDir: %s", err)
+	}
+	if err := w.WriteConsoleDevice(); err != nil {
+		t.Fatalf("WriteConsoleDevice: %s", err)
+	}
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var hdrs headerList
+	hdrs.readAll(r)
+	hdrs.expectNames(t, ".", "etc", "etc/motd", "usr", "usr/share", "usr/share/"+OpaqueMarkerName, "dev", ConsoleDevicePath, TrailerFilename)
+
+	for _, hdr := range hdrs {
+		var expect = hdr.Filename == "etc/motd"
+		if hdr.IsWhiteout() != expect {
+			t.Errorf("%s: expected IsWhiteout %v", hdr.Filename, expect)
+		}
+
+		switch hdr.Filename {
+		case "etc/motd":
+			if hdr.Mode != Mode_CharDevice || hdr.DataSize != 0 {
+				t.Errorf("%s: unexpected whiteout %s", hdr.Filename, &hdr)
+			}
+		case "usr/share":
+			if hdr.Mode != Mode_Dir|DefaultMkdirPerm {
+				t.Errorf("%s: unexpected directory %s", hdr.Filename, &hdr)
+			}
+		case "usr/share/" + OpaqueMarkerName:
+			if !hdr.Mode.File() || hdr.DataSize != 0 {
+				t.Errorf("%s: unexpected marker %s", hdr.Filename, &hdr)
+			}
+		}
+	}
+}
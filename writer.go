@@ -1,12 +1,17 @@
 package initramfs
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
+	"io/fs"
 	"iter"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Writer
@@ -16,53 +21,174 @@ type Writer struct {
 	closed     bool
 	compressed bool
 
+	out   *countWriter // Wraps w
 	curW  io.Writer
 	compW io.Writer
 
-	mkdirs    map[string]struct{}
-	nextInode uint32
+	mkdirs         map[string]struct{}
+	dirMetadata    map[string]Header
+	defaultDirPerm Mode
+	nextInode      uint32
+	inodeAlloc     InodeAllocator
+	allocated      map[uint32]struct{} // Inodes assigned by inodeAlloc
 
-	written       int64 // FIXME TODO: rename N
+	reproducible      bool
+	reproducibleMtime time.Time
+	preserveOwnership bool              // Keep Uid and Gid in reproducible mode
+	inodeMap          map[uint32]uint32 // Remapped inodes in reproducible mode
+
+	links         map[uint32]*hardLink // By inode
+	coalesceLinks bool
+	keepInode     bool // Writing a hard link, whose inode is already assigned
+
+	written       int64 // Within the current segment, see writeAlignment. FIXME TODO: rename N
 	fileRemaining int64
+	dropping      bool // The current entry was dropped by rewriteName, so its data is discarded
+
+	rewriteName func(name string) (string, bool)
+
+	dataAlignTo    int
+	headerAlignTo  int
+	allDataAlignTo int
+
+	profile  TargetProfile
+	warnings []error
 
-	dataAlignTo   int
-	headerAlignTo int
+	strictPaths  bool
+	defaultMagic string
+
+	trailerPadTo      int64
+	trailerPadPending bool
+	autoTrailer       bool
+	mergeAppended     bool
+	padEntryPrefix    string
+	trailerDue        bool // No trailer has followed the latest entry, or nothing written yet
+
+	stats Stats
+
+	onEntry      func(hdr *Header, written int64)
+	entry        Header // Most recently written, excluding trailers
+	entryPending bool   // Whether onEntry is yet to be called for entry
+
+	autoChecksum bool
+	sumPending   bool
+	sumOffset    int64 // Output position of the pending Checksum field
+	sum          ChecksumWriter
 }
 
 var (
 	ErrBadAlignment      = errors.New("initramfs: alignment must itself be a multiple of 4")
-	ErrBadDataAlignment  = errors.New("initramfs: unable to align data as requested given the filename")
+	ErrBadDataAlignment  = errors.New("initramfs: unable to align data as requested given the filename") // No longer returned
 	ErrAlreadyCompressed = errors.New("initramfs: writer compression is already being applied")
+	ErrFileTooLarge      = errors.New("initramfs: file data exceeds the declared or maximum size")
 )
 
 func NewWriter(w io.Writer) *Writer {
+	var out = &countWriter{w: w}
 	return &Writer{
 		w:    w,
-		curW: w,
+		out:  out,
+		curW: out,
+
+		mkdirs:    make(map[string]struct{}),
+		links:     make(map[uint32]*hardLink),
+		allocated: make(map[uint32]struct{}),
 
-		mkdirs: make(map[string]struct{}),
+		defaultMagic:   Magic_070701,
+		defaultDirPerm: DefaultMkdirPerm,
+
+		trailerDue: true,
 	}
 }
 
+// Discard all state and begin writing a new archive to w. Settings such as
+// alignment for all data, the default magic, reproducibility and the inode
+// allocator are retained, whereas per-entry alignment, the set of directories
+// created, the inodes assigned so far and [Writer.Stats] are not, such that
+// writing the same entries again produces identical output. This allows a
+// Writer to be pooled and reused for many archives.
+//
+// Reset must not be called part way through writing an entry or a compressed
+// segment, as any buffered output is discarded rather than flushed; call
+// [Writer.Close] first.
+func (iw *Writer) Reset(w io.Writer) {
+	iw.w = w
+	iw.out.w = w
+	iw.out.n = 0
+	iw.curW = iw.out
+	iw.compW = nil
+
+	iw.closed = false
+	iw.compressed = false
+
+	clear(iw.mkdirs)
+	clear(iw.links)
+	clear(iw.inodeMap)
+	clear(iw.allocated)
+
+	iw.nextInode = 0
+	if iw.reproducible {
+		iw.nextInode = 1
+	}
+
+	iw.written = 0
+	iw.fileRemaining = 0
+	iw.dropping = false
+	iw.dataAlignTo = 0
+	iw.headerAlignTo = 0
+	iw.warnings = nil
+
+	iw.trailerPadPending = false
+	iw.trailerDue = true
+	iw.sumPending = false
+	iw.sumOffset = 0
+	iw.sum.Reset()
+
+	iw.stats = Stats{}
+
+	iw.entry = Header{}
+	iw.entryPending = false
+}
+
 func (iw *Writer) skipFileRemaining() (err error) {
+	if iw.dropping {
+		iw.fileRemaining, iw.dropping = 0, false
+		return nil
+	}
+
 	if n := iw.fileRemaining; n > 0 {
 		err = iw.writePad(n)
 		iw.fileRemaining = 0
 	}
+	if err == nil {
+		err = iw.finishChecksum()
+	}
+	if err == nil {
+		iw.entryDone()
+	}
 	return
 }
 
+// Writes file data for the current entry, which must not exceed the remaining
+// [Header.DataSize]. If buf is longer than what remains, only the remainder is
+// written and [ErrFileTooLarge] is returned, as is also the case once all of
+// the data has been written. Any data not written is zero filled by the next
+// call to [Writer.WriteHeader] or [Writer.WriteTrailer].
 func (iw *Writer) Write(buf []byte) (n int, err error) {
 	if iw.closed {
 		return 0, os.ErrClosed
 	}
 
-	if rem := iw.fileRemaining; rem == 0 {
-		return 0, io.EOF
-	} else if rem < int64(len(buf)) {
-		n, err = iw.write(buf[:rem])
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	if rem := iw.fileRemaining; rem < int64(len(buf)) {
+		if rem > 0 {
+			n, err = iw.write(buf[:rem])
+		}
 		if err == nil {
-			err = io.EOF
+			err = ErrFileTooLarge
 		}
 	} else {
 		n, err = iw.write(buf)
@@ -70,27 +196,32 @@ func (iw *Writer) Write(buf []byte) (n int, err error) {
 
 	if n > 0 {
 		iw.fileRemaining -= int64(n)
+
+		if iw.sumPending {
+			iw.sum.Write(buf[:n])
+		}
+
+		if iw.fileRemaining == 0 {
+			iw.entryDone()
+		}
 	}
 
 	return
 }
 
 // Reads file data from r and writes to the archive.
+//
+// Never reads more than the remaining [Header.DataSize] from r. If r reports
+// its unread length through a Len method (as [bytes.Reader] and
+// [strings.Reader] do), [ErrFileTooLarge] is returned when data is still left
+// over once the declared size has been fully written; any other source is left
+// positioned just past the data that was copied.
+//
+// As with [Writer.Write], [ErrFileTooLarge] is also returned if the current
+// entry has no file data left to write, unless r is known to be empty.
+// [io.EOF] is returned if r ends before the declared size has been written.
 func (iw *Writer) ReadFrom(r io.Reader) (n int64, err error) {
-	if iw.closed {
-		return 0, os.ErrClosed
-	}
-
-	if rem := iw.fileRemaining; rem == 0 {
-		return 0, io.EOF
-	} else {
-		n, err = io.CopyN(iw.curW, r, rem)
-		if n > 0 {
-			iw.written += n
-			iw.fileRemaining -= n
-		}
-		return
-	}
+	return iw.ReadFromContext(context.Background(), r)
 }
 
 func (iw *Writer) write(p []byte) (int, error) {
@@ -98,6 +229,10 @@ func (iw *Writer) write(p []byte) (int, error) {
 		return 0, os.ErrClosed
 	}
 
+	if iw.dropping {
+		return len(p), nil
+	}
+
 	n, err := iw.curW.Write(p)
 	if n > 0 {
 		iw.written += int64(n)
@@ -111,8 +246,24 @@ func (iw *Writer) Close() error {
 		return os.ErrClosed
 	}
 
+	// Any data remaining for a dropped entry is never written
+	if iw.dropping {
+		iw.fileRemaining, iw.dropping = 0, false
+	}
+
+	if iw.autoTrailer && iw.trailerDue {
+		if err := iw.WriteTrailer(); err != nil {
+			return err
+		}
+	}
+
+	var padErr error
+	if iw.trailerPadPending {
+		padErr = iw.padTrailer()
+	}
+
 	var (
-		errs = [...]error{iw.Flush(), nil, nil}
+		errs = [...]error{errors.Join(iw.finishChecksum(), padErr, iw.Flush()), nil, nil}
 		wrs  = [...]io.Writer{nil, iw.compW, iw.w}
 	)
 
@@ -154,6 +305,18 @@ func (iw *Writer) Flush() error {
 	return errors.Join(errs[:]...)
 }
 
+// Counts the bytes written to the underlying writer.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
 // Any writer that supports flushing its output.
 type Flusher interface {
 	Flush() error
@@ -164,9 +327,20 @@ type Flusher interface {
 const StartCompressionAlignment = 512
 
 // Switch the writer to a compressed output stream, according to the supplied
-// [CompressWriter]. It is not possible to end a compressed stream other than by
-// reaching the end of the file, so all remaining output from the writer will be
-// compressed.
+// [CompressWriter]. All further output is compressed, until either
+// [Writer.EndCompression] is called or the writer is closed.
+//
+// This may be called at any point, including after some entries have already
+// been written, in which case the output consists of an uncompressed archive
+// prefix followed by a compressed segment; the kernel supports this layout. A
+// trailer is not required before the compressed segment. Any data remaining
+// for the current file is first padded with zeros, then the output is padded to
+// a multiple of [StartCompressionAlignment]. Within the compressed segment,
+// header alignment is relative to the start of the decompressed stream.
+//
+// When reading such an archive, [Reader.Next] returns
+// [ErrCompressedContentAhead] at the end of the uncompressed prefix, after
+// which [Reader.ContinueCompressed] proceeds with the compressed segment.
 func (iw *Writer) StartCompression(c CompressWriter) error {
 	if iw.closed {
 		return os.ErrClosed
@@ -184,7 +358,7 @@ func (iw *Writer) StartCompression(c CompressWriter) error {
 		return err
 	}
 
-	cw, err := c(iw.curW)
+	cw, err := c(iw.out)
 	if err != nil {
 		return err
 	}
@@ -197,6 +371,64 @@ func (iw *Writer) StartCompression(c CompressWriter) error {
 	return err
 }
 
+var ErrNotCompressed = errors.New("initramfs: writer compression is not being applied")
+
+// End the compressed output stream started by [Writer.StartCompression], and
+// resume writing uncompressed output. The [CompressWriter] is closed (or
+// flushed, if it does not implement [io.Closer]) so that the compressed stream
+// is complete. Compression may then be started again, such that the output
+// consists of a series of concatenated segments, which the kernel supports.
+// Alignment of the uncompressed output that follows is again relative to the
+// start of the output.
+//
+// Returns [ErrNotCompressed] if compression is not currently being applied.
+func (iw *Writer) EndCompression() error {
+	if iw.closed {
+		return os.ErrClosed
+	}
+
+	if !iw.compressed {
+		return ErrNotCompressed
+	}
+
+	if err := iw.skipFileRemaining(); err != nil {
+		return err
+	}
+
+	if closer, ok := iw.compW.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	} else if flusher, ok := iw.compW.(Flusher); ok {
+		if err := flusher.Flush(); err != nil {
+			return err
+		}
+	}
+
+	iw.curW = iw.out
+	iw.compW = nil
+	iw.compressed = false
+	iw.written = iw.out.n
+
+	return nil
+}
+
+var ErrNoCompressWriter = errors.New("initramfs: no suitable CompressWriter found")
+
+// Switch the writer to a compressed output stream, using the [CompressWriter]
+// registered for the compression type in [CompressWriters]. See
+// [Writer.StartCompression].
+//
+// Returns [ErrNoCompressWriter] if no suitable writer has been registered.
+func (iw *Writer) StartCompressionType(la Lookahead) error {
+	c, ok := CompressWriters[la]
+	if !ok {
+		return ErrNoCompressWriter
+	}
+
+	return iw.StartCompression(c)
+}
+
 var zeroPadding [512]byte
 
 // Write some number of 0 padding bytes.
@@ -215,8 +447,16 @@ func (iw *Writer) writePad(n int64) error {
 	return nil
 }
 
+// Aligns file data to a 4 KiB page boundary, as wanted for firmware images
+// that are memory mapped, or files used with DAX.
+//
+// Use with [Writer.SetDataAlignment] or [Writer.SetDefaultDataAlignment].
+const DataAlignment4K = 4096
+
 // Sets the output alignment for the start of the next header write. Value must
-// itself be a multiple of 4.
+// itself be a multiple of 4. Alignment is relative to the start of the output,
+// or within a compressed segment, to the start of its decompressed stream (see
+// [Writer.StartCompression]).
 //
 // Only one of header or data alignment can be applied, and whichever is called
 // last prior to calling [Writer.WriteHeader] will be applied. After every call
@@ -232,17 +472,15 @@ func (iw *Writer) SetHeaderAlignment(alignTo int) error {
 	return nil
 }
 
-// Attempts to set the alignment of the file data by adjusting the amount of
-// padding before the next header write. Value must itself be a multiple of 4.
-//
-// If the length of the header (110 bytes, see [HeaderSize]), plus the length of
-// the NUL-terminated filename, is itself not a multiple of 4, the call to
-// [Writer.WriteHeader] will return [ErrBadDataAlignment]. In the case of
-// filename [MicrocodePath_GenuineIntel], this will work.
+// Sets the alignment of the file data by adjusting the amount of padding
+// before the next header write. Value must itself be a multiple of 4. The
+// padding is zero filled, unless [Writer.SetAlignmentPadEntries] is used.
+// Alignment is relative in the same way as for [Writer.SetHeaderAlignment].
 //
 // Only one of header or data alignment can be applied, and whichever is called
 // last prior to calling [Writer.WriteHeader] will be applied. After every call
-// to [Writer.WriteHeader] alignment is reset.
+// to [Writer.WriteHeader] alignment is reset, to any default set by
+// [Writer.SetDefaultDataAlignment].
 func (iw *Writer) SetDataAlignment(alignTo int) error {
 	if alignTo%4 != 0 {
 		return ErrBadAlignment
@@ -254,6 +492,45 @@ func (iw *Writer) SetDataAlignment(alignTo int) error {
 	return nil
 }
 
+// Sets the alignment of the file data for every subsequent regular file, as if
+// [Writer.SetDataAlignment] were called before each call to
+// [Writer.WriteHeader]. Value must itself be a multiple of 4, and 0 disables
+// this alignment.
+//
+// Unlike [Writer.SetDataAlignment], this setting persists across calls to
+// [Writer.WriteHeader], but any header or data alignment set for an individual
+// entry takes precedence. Directories and other entries without file data are
+// not aligned.
+func (iw *Writer) SetAllDataAlignment(alignTo int) error {
+	if alignTo%4 != 0 {
+		return ErrBadAlignment
+	}
+
+	iw.allDataAlignTo = alignTo
+
+	return nil
+}
+
+// Sets the default alignment of the file data of every subsequent regular
+// file, which persists until changed, while [Writer.SetDataAlignment] and
+// [Writer.SetHeaderAlignment] continue to override it for the next header only.
+// This is the same setting as [Writer.SetAllDataAlignment] and
+// [WithDefaultAlignment].
+func (iw *Writer) SetDefaultDataAlignment(alignTo int) error { return iw.SetAllDataAlignment(alignTo) }
+
+// The data alignment to apply to the header about to be written.
+func (iw *Writer) entryDataAlignment(hdr *Header) int {
+	if iw.dataAlignTo > 0 {
+		return iw.dataAlignTo
+	}
+
+	if hdr.Mode.File() && hdr.DataSize > 0 {
+		return iw.allDataAlignTo
+	}
+
+	return 0
+}
+
 func alignUp(n, to int64) int64 { return n + alignFill(n, to) }
 
 func alignFill(n, to int64) int64 {
@@ -265,6 +542,13 @@ func alignFill(n, to int64) int64 {
 
 // Write sufficient padding such that the total number of output bytes written
 // is a multiple of [alignTo].
+//
+// The count is of the current segment: the decompressed bytes written since
+// [Writer.StartCompression] while compressing, and otherwise the bytes written
+// to the underlying writer in total, including any earlier compressed
+// segments. As such, [StartCompressionAlignment] and the alignment of an
+// uncompressed part are absolute, whereas alignment within a compressed
+// segment is relative to its decompressed stream, as the kernel reads it.
 func (iw *Writer) writeAlignment(alignTo int64) error {
 	return iw.writePad(alignFill(iw.written, alignTo))
 }
@@ -306,6 +590,23 @@ func (iw *Writer) mkdir(path string, perm Mode) error {
 		Filename: path,
 	}
 
+	if md, ok := iw.dirMetadata[path]; ok {
+		hdr.Mode = Mode_Dir | md.Mode&^Mode_FileTypeMask
+		hdr.Uid = md.Uid
+		hdr.Gid = md.Gid
+		hdr.Mtime = md.Mtime
+	}
+
+	if iw.reproducible {
+		hdr.Mtime = iw.reproducibleMtime
+	}
+
+	// Any per-entry alignment is for the entry whose parents are being
+	// created, so is kept aside
+	var dataAlignTo, headerAlignTo = iw.dataAlignTo, iw.headerAlignTo
+	iw.dataAlignTo, iw.headerAlignTo = 0, 0
+	defer func() { iw.dataAlignTo, iw.headerAlignTo = dataAlignTo, headerAlignTo }()
+
 	iw.mkdirs[path] = struct{}{}
 	return iw.writeHeader(&hdr)
 }
@@ -313,14 +614,16 @@ func (iw *Writer) mkdir(path string, perm Mode) error {
 // Add a directory named path, along with any necessary parents, to the archive.
 //
 // The writer tracks which directories have already been added, and will skip
-// any that already exist.
+// any that already exist. Metadata for the directories that are created may be
+// provided with [Writer.SetDirMetadata]. A perm of 0 uses the default, which is
+// [DefaultMkdirPerm] unless changed with [WithDefaultDirPerm].
 func (iw *Writer) MkdirAll(path string, perm Mode) error {
 	if iw.closed {
 		return os.ErrClosed
 	}
 
 	if perm == 0 {
-		perm = DefaultMkdirPerm
+		perm = iw.defaultDirPerm
 	}
 
 	path = strings.TrimPrefix(path, "/")
@@ -341,11 +644,46 @@ func (iw *Writer) MkdirAll(path string, perm Mode) error {
 	return nil
 }
 
+// Provide the metadata for directories that are created automatically, either
+// by [Writer.MkdirAll] or as the parents of an entry passed to
+// [Writer.WriteHeader]. When a directory being created has its path as a key in
+// m, the Mode (other than file type bits), Uid, Gid and Mtime of the
+// corresponding header are used instead of the defaults. Paths are normalized,
+// such that "/etc/" and "etc" are equivalent, and "/" refers to the root.
+func (iw *Writer) SetDirMetadata(m map[string]Header) {
+	iw.dirMetadata = make(map[string]Header, len(m))
+	for name, hdr := range m {
+		iw.dirMetadata[normalizeName(name)] = hdr
+	}
+}
+
+// Sets a function applied by [Writer.WriteHeader] to the filename of every
+// entry other than a trailer, before it is normalized and any parent
+// directories are created, such that the entry is written with the returned
+// name instead. Returning false drops the entry entirely, with any file data
+// subsequently written for it being discarded. This allows a tree to be
+// relocated or filtered when copying an archive. A nil function (the default)
+// leaves names unchanged.
+//
+// Directories created by [Writer.MkdirAll] are not rewritten, whereas those
+// created as parents follow from the rewritten name.
+func (iw *Writer) SetRewriteName(fn func(name string) (newName string, keep bool)) {
+	iw.rewriteName = fn
+}
+
+// When enabled, [Writer.WriteHeader] will normalize every filename using
+// [Header.CleanName], and reject any containing ".." components with
+// [ErrUnsafePath].
+func (iw *Writer) SetStrictPaths(strict bool) { iw.strictPaths = strict }
+
 // Write the header in textual form, respecting output alignment requirements.
 // The header will first be updated to ensure well-formedness:
-//   - If Magic is blank, it will be given a default value of [Magic_070701]
+//   - If Magic is blank, it will be given the default (see [Writer.SetDefaultMagic])
 //   - NumLinks will be minimum 1
-//   - If Inode is 0 and this is not a trailer, an inode number will be assigned
+//   - If Inode is 0 and this is not a trailer, an inode number will be assigned (see [Writer.SetInodeAllocator])
+//   - Hard links may have NumLinks and DataSize adjusted, see [Writer.SetCoalesceHardLinks]
+//   - Checksum may be computed from the data, see [Writer.SetAutoChecksum]
+//   - Mtime, Uid, Gid and Inode may be replaced, see [Writer.SetReproducible]
 //   - All leading slashes will be removed from the Filename
 //   - FilenameSize will be set to the length of Filename plus 1
 func (iw *Writer) WriteHeader(hdr *Header) error {
@@ -353,6 +691,28 @@ func (iw *Writer) WriteHeader(hdr *Header) error {
 		return os.ErrClosed
 	}
 
+	if iw.rewriteName != nil && !hdr.Trailer() {
+		if err := iw.skipFileRemaining(); err != nil {
+			return err
+		}
+
+		name, keep := iw.rewriteName(hdr.Filename)
+		if !keep {
+			return iw.dropEntry(hdr)
+		}
+		hdr.Filename = name
+	}
+
+	iw.applyReproducible(hdr)
+
+	if iw.strictPaths {
+		filename, err := hdr.CleanName()
+		if err != nil {
+			return err
+		}
+		hdr.Filename = filename
+	}
+
 	filename := strings.TrimPrefix(hdr.Filename, "/")
 	if filename == "" {
 		filename = "."
@@ -378,25 +738,55 @@ func (iw *Writer) WriteHeader(hdr *Header) error {
 	return iw.writeHeader(hdr)
 }
 
+// Skip writing the entry, discarding any file data written for it and
+// resetting any per-entry alignment, as if it had been written.
+func (iw *Writer) dropEntry(hdr *Header) error {
+	iw.dropping = true
+	iw.fileRemaining = int64(hdr.DataSize)
+	iw.dataAlignTo = 0
+	iw.headerAlignTo = 0
+	return nil
+}
+
 func (iw *Writer) writeHeader(hdr *Header) error {
 	if err := iw.skipFileRemaining(); err != nil {
 		return err
 	}
 
 	if hdr.Magic == "" {
-		hdr.Magic = Magic_070701
+		hdr.Magic = iw.defaultMagic
+	} else if hdr.Magic == Magic_070707 {
+		// The kernel does not understand odc, and it lacks alignment
+		return ErrBadHeaderMagic
 	}
 
 	if hdr.NumLinks == 0 {
 		hdr.NumLinks = 1
 	}
 
-	if hdr.Inode == 0 && !hdr.Trailer() {
-		hdr.Inode = iw.nextInode
+	if !hdr.Trailer() {
+		if err := iw.checkTargetProfile(hdr); err != nil {
+			return err
+		}
 	}
 
+	iw.assignInode(hdr)
+
 	iw.nextInode = max(iw.nextInode, hdr.Inode) + 1
 
+	if hdr.Trailer() {
+		clear(iw.links)
+	} else {
+		iw.trackHardLink(hdr)
+	}
+
+	var wantChecksum = iw.wantChecksum(hdr)
+	if wantChecksum && hdr.DataSize > 0 {
+		if _, ok := iw.w.(io.WriteSeeker); !ok || iw.compressed {
+			return ErrChecksumNotSeekable
+		}
+	}
+
 	hdr.FilenameSize = uint32(len(hdr.Filename) + 1)
 
 	if err := iw.writeAlignment(4); err != nil {
@@ -406,24 +796,22 @@ func (iw *Writer) writeHeader(hdr *Header) error {
 	// As of this point, the output is guaranteed to be 4 byte aligned
 
 	if alignTo := int64(iw.headerAlignTo); alignTo > 0 {
-		if err := iw.writeAlignment(alignTo); err != nil {
+		if err := iw.writeFill(alignFill(iw.written, alignTo), alignTo); err != nil {
 			return err
 		}
-	} else if alignTo := int64(iw.dataAlignTo); alignTo > 0 {
+	} else if alignTo := int64(iw.entryDataAlignment(hdr)); alignTo > 0 {
 		// How much padding do we need to achieve the desired data alignment
-		// once this header and following alignment is applied?
-		var fill = alignFill(iw.written+int64(hdr.Size()), alignTo)
+		// once this header and the 4 byte alignment following it are written?
+		// As the output is 4 byte aligned, so too is the fill.
+		var fill = alignFill(iw.written+alignUp(int64(hdr.Size()), 4), alignTo)
 
-		// If the fill length itself is not 4 byte aligned, then the post-header
-		// alignment will throw off the data alignment.
-		//
-		// In this case, you would need to resort to the trick of writing an
-		// empty file header with a filename of a specially crafted length.
-		if fill%4 != 0 {
-			return ErrBadDataAlignment
+		if err := iw.writeFill(fill, alignTo); err != nil {
+			return err
 		}
+	}
 
-		if err := iw.writePad(fill); err != nil {
+	if wantChecksum {
+		if err := iw.startChecksum(hdr); err != nil {
 			return err
 		}
 	}
@@ -432,6 +820,7 @@ func (iw *Writer) writeHeader(hdr *Header) error {
 		return err
 	} else {
 		iw.written += n
+		iw.stats.add(hdr, n)
 	}
 
 	if err := iw.writeAlignment(4); err != nil {
@@ -444,8 +833,288 @@ func (iw *Writer) writeHeader(hdr *Header) error {
 	iw.dataAlignTo = 0
 	iw.headerAlignTo = 0
 
+	iw.trailerDue = !hdr.Trailer()
+
+	if !hdr.Trailer() {
+		iw.entry = *hdr
+		iw.entryPending = true
+
+		if iw.fileRemaining == 0 {
+			iw.entryDone()
+		}
+	}
+
+	return nil
+}
+
+// Write the end-of-archive sentinel trailer entry, using the default magic.
+// Any padding set by [Writer.SetTrailerPadding] is written afterwards.
+func (iw *Writer) WriteTrailer() error {
+	var hdr = trailerHeader
+	hdr.Magic = iw.defaultMagic
+	if err := iw.WriteHeader(&hdr); err != nil {
+		return err
+	}
+
+	if iw.trailerPadTo > 0 {
+		if iw.compressed {
+			// Padding must follow the end of the compressed stream
+			iw.trailerPadPending = true
+		} else {
+			return iw.padTrailer()
+		}
+	}
+
+	return nil
+}
+
+// When enabled, [Writer.Close] writes a trailer if one has not been written
+// since the last entry (or if nothing has been written at all), so that the
+// output is always a well-formed archive.
+func (iw *Writer) SetAutoTrailer(enable bool) { iw.autoTrailer = enable }
+
+// Sets the block size that the total output is padded to (with zeros) after
+// each trailer, as some bootloaders require the size of the initrd to be a
+// multiple of a block size such as 512. The kernel ignores zero padding between
+// and after archives. A blockSize of 0 (or less) disables this padding.
+//
+// If compression is being applied when the trailer is written, the padding is
+// instead written when the writer is closed, once the compressed stream has
+// been ended.
+func (iw *Writer) SetTrailerPadding(blockSize int64) { iw.trailerPadTo = max(blockSize, 0) }
+
+// End any compression and pad the output to the trailer block size.
+func (iw *Writer) padTrailer() error {
+	iw.trailerPadPending = false
+
+	if iw.compressed {
+		if err := iw.EndCompression(); err != nil {
+			return err
+		}
+	}
+
+	return iw.writePad(alignFill(iw.out.n, iw.trailerPadTo))
+}
+
+// Sets the magic given to every header written with a blank Magic, including
+// the trailer. Must be either [Magic_070701] (the initial default) or
+// [Magic_070702], otherwise [ErrBadHeaderMagic] is returned. A Magic set on an
+// individual header always takes precedence.
+//
+// Note that the writer does not compute checksums for [Magic_070702] entries
+// unless enabled with [Writer.SetAutoChecksum].
+func (iw *Writer) SetDefaultMagic(magic string) error {
+	switch magic {
+	case Magic_070701, Magic_070702:
+		iw.defaultMagic = magic
+		return nil
+	default:
+		return ErrBadHeaderMagic
+	}
+}
+
+// Write a regular file entry with the given permissions (any file type bits in
+// mode are ignored) and contents.
+func (iw *Writer) WriteFile(name string, mode Mode, data []byte) error {
+	return iw.WriteFileReader(name, mode, int64(len(data)), bytes.NewReader(data))
+}
+
+// Write a regular file entry with the given permissions (any file type bits in
+// mode are ignored), with exactly size bytes of contents read from r.
+//
+// Returns [ErrFileTooLarge] if size exceeds [MaxDataSize] or r is known to
+// contain more than size bytes (see [Writer.ReadFrom]), and
+// [io.ErrUnexpectedEOF] if it contains fewer.
+func (iw *Writer) WriteFileReader(name string, mode Mode, size int64, r io.Reader) error {
+	var hdr = Header{
+		Mode:     Mode_File | mode&^Mode_FileTypeMask,
+		Filename: name,
+	}
+
+	if err := hdr.SetDataSize(size); err != nil {
+		return err
+	}
+
+	if err := iw.WriteHeader(&hdr); err != nil {
+		return err
+	}
+
+	if size == 0 {
+		return nil
+	}
+
+	if _, err := iw.ReadFrom(r); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Default permissions for symlink entries
+const DefaultSymlinkPerm Mode = 0o777
+
+// Write a symlink entry pointing to target, which is stored as the file data.
+// If the permission bits of mode are 0, [DefaultSymlinkPerm] is used (any file
+// type bits in mode are ignored).
+func (iw *Writer) WriteSymlink(name, target string, mode Mode) error {
+	if mode&Mode_PermsMask == 0 {
+		mode |= DefaultSymlinkPerm
+	}
+
+	var hdr = Header{
+		Mode:     Mode_Symlink | mode&^Mode_FileTypeMask,
+		Filename: name,
+	}
+
+	if err := hdr.SetDataSize(int64(len(target))); err != nil {
+		return err
+	}
+
+	if err := iw.WriteHeader(&hdr); err != nil {
+		return err
+	}
+
+	if len(target) > 0 {
+		if _, err := iw.Write([]byte(target)); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// Write the end-of-archive sentinel trailer entry.
-func (iw *Writer) WriteTrailer() error { return iw.WriteHeader(&trailerHeader) }
+var ErrUnsupportedFileType = errors.New("initramfs: unsupported file type")
+
+// Equivalent to [io/fs.ReadLinkFS], which is only available as of Go 1.25.
+type readLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// Add the contents of the filesystem to the archive, walking the tree in
+// lexical order (see [io/fs.WalkDir]).
+//
+// Directories and regular files (along with their data) are added, and
+// symlinks are added if the filesystem implements [io/fs.ReadLinkFS]. Any other
+// file type results in [ErrUnsupportedFileType]. Inode numbers are assigned by
+// the writer rather than taken from the filesystem.
+//
+// Any error is returned as an [io/fs.PathError] naming the offending path.
+func (iw *Writer) AddFS(fsys fs.FS) error {
+	return iw.addFSTree("AddFS", fsys, ".", "")
+}
+
+// Walk the tree at root within fsys, adding each entry beneath it to the
+// archive at its path relative to root joined to dstDir. The root itself is
+// only added if dstDir is empty.
+func (iw *Writer) addFSTree(op string, fsys fs.FS, root, dstDir string) error {
+	return fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err == nil {
+			var dst = name
+			if dstDir != "" {
+				if name == root {
+					return nil
+				}
+
+				var rel = name
+				if root != "." {
+					rel = strings.TrimPrefix(name, root+"/")
+				}
+
+				dst = path.Join(dstDir, rel)
+			}
+
+			err = iw.addFSEntry(fsys, name, dst, d)
+		}
+
+		if err != nil {
+			var pathErr *fs.PathError
+			if errors.As(err, &pathErr) {
+				return err
+			}
+			return &fs.PathError{Op: op, Path: name, Err: err}
+		}
+
+		return nil
+	})
+}
+
+// Add the entry at name within fsys to the archive as dst.
+func (iw *Writer) addFSEntry(fsys fs.FS, name, dst string, d fs.DirEntry) error {
+	var (
+		info fs.FileInfo
+		err  error
+	)
+
+	isSymlink := d.Type()&fs.ModeSymlink != 0
+	if isSymlink {
+		lfs, ok := fsys.(readLinkFS)
+		if !ok {
+			return ErrUnsupportedFileType
+		}
+
+		info, err = lfs.Lstat(name)
+	} else {
+		info, err = d.Info()
+	}
+	if err != nil {
+		return err
+	}
+
+	hdr, err := NewHeaderFromFileInfo(dst, info)
+	if err != nil {
+		return err
+	}
+
+	hdr.Inode = 0
+	hdr.NumLinks = 0
+	hdr.Major = 0
+	hdr.Minor = 0
+
+	var data io.Reader
+
+	switch {
+	case hdr.Mode.Dir():
+
+	case hdr.Mode.File():
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		data = f
+
+	case isSymlink:
+		target, err := fsys.(readLinkFS).ReadLink(name)
+		if err != nil {
+			return err
+		}
+
+		if err := hdr.SetDataSize(int64(len(target))); err != nil {
+			return err
+		}
+
+		data = strings.NewReader(target)
+
+	default:
+		return ErrUnsupportedFileType
+	}
+
+	if err := iw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if hdr.DataSize > 0 {
+		if _, err := iw.ReadFrom(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
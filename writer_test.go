@@ -1,6 +1,18 @@
 package initramfs
 
-import "testing"
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
 
 func TestWriter_ParentDirs(t *testing.T) {
 	t.Run("trailer", func(t *testing.T) {
@@ -48,3 +60,952 @@ func TestWriter_ParentDirs(t *testing.T) {
 
 	})
 }
+
+func TestWriter_StartCompressionType(t *testing.T) {
+	t.Run("gzip", func(t *testing.T) {
+		w, r := testWriterReader(t)
+
+		testMkdirHeader(t, w, "/before", nil)
+
+		if err := w.StartCompressionType(Gzip); err != nil {
+			t.Fatalf("StartCompressionType: %s", err)
+		}
+
+		testMkdirHeader(t, w, "/after", nil)
+
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %s", err)
+		}
+
+		var hdrs headerList
+		hdrs.readAll(r)
+
+		compressed, typ, err := r.ContinueCompressed(nil)
+		if err != nil {
+			t.Fatalf("ContinueCompressed: %s", err)
+		}
+
+		if !compressed || typ != Gzip {
+			t.Fatalf("expected gzip compression, got %v %s", compressed, typ)
+		}
+
+		hdrs.readAll(r)
+		hdrs.expectNames(t,
+			".",
+			"before",
+			"after",
+		)
+	})
+
+	t.Run("unregistered", func(t *testing.T) {
+		w, _ := testWriterReader(t)
+
+		if err := w.StartCompressionType(Lzo); err != ErrNoCompressWriter {
+			t.Fatalf("expected ErrNoCompressWriter, got %v", err)
+		}
+	})
+}
+
+func TestWriter_StartCompressionMidArchive(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+
+	if err := w.WriteFile("a", 0o644, []byte("hello")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	// Begin compression part way through the data of a file
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, DataSize: 10, Filename: "b"})
+	if _, err := w.Write([]byte("abc")); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+
+	if err := w.StartCompression(GzipWriter); err != nil {
+		t.Fatalf("StartCompression: %s", err)
+	}
+
+	if err := w.WriteFile("c", 0o644, []byte("compressed")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	var (
+		raw = buf.Bytes()
+		i   = bytes.Index(raw, []byte{0x1f, 0x8b})
+	)
+
+	if i < 0 || i%StartCompressionAlignment != 0 {
+		t.Fatalf("expected compressed data at a multiple of %d, found at %d", StartCompressionAlignment, i)
+	}
+
+	r := NewReader(bytes.NewReader(raw))
+
+	for _, expect := range []struct {
+		name string
+		data string
+	}{
+		{".", ""},
+		{"a", "hello"},
+		{"b", "abc\x00\x00\x00\x00\x00\x00\x00"},
+	} {
+		testNextNamed(t, r, expect.name)
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll: %s", err)
+		}
+
+		if string(data) != expect.data {
+			t.Errorf("%s: expected data %q, got %q", expect.name, expect.data, data)
+		}
+	}
+
+	if hdr, err := r.Next(); err != ErrCompressedContentAhead {
+		t.Fatalf("expected ErrCompressedContentAhead, got %v %v", hdr, err)
+	}
+
+	if compressed, typ, err := r.ContinueCompressed(nil); err != nil || !compressed || typ != Gzip {
+		t.Fatalf("ContinueCompressed: expected gzip, got %v %s %v", compressed, typ, err)
+	}
+
+	testNextNamed(t, r, "c")
+
+	if data, err := io.ReadAll(r); err != nil || string(data) != "compressed" {
+		t.Errorf("c: expected data %q, got %q %v", "compressed", data, err)
+	}
+
+	testNextNamed(t, r, TrailerFilename)
+}
+
+func TestWriter_AlignmentAcrossSegments(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		w   = NewWriter(&buf)
+	)
+
+	// An odd sized microcode part, such that the compressed segment does not
+	// naturally start aligned
+	if err := WriteMicrocode(w, bytes.Repeat([]byte{1}, 1001), bytes.Repeat([]byte{2}, 333)); err != nil {
+		t.Fatalf("WriteMicrocode: %s", err)
+	}
+
+	var starts []int
+
+	for i, name := range []string{"init", "sbin/init"} {
+		if err := w.StartCompression(GzipWriter); err != nil {
+			t.Fatalf("StartCompression: %s", err)
+		}
+		starts = append(starts, buf.Len())
+
+		if err := w.SetDataAlignment(MicrocodeDataAlignment); err != nil {
+			t.Fatalf("SetDataAlignment: %s", err)
+		}
+
+		if err := w.WriteFile(name, 0o755, []byte("#!/bin/sh\n")); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+
+		if err := w.EndCompression(); err != nil {
+			t.Fatalf("EndCompression: %s", err)
+		}
+
+		// An uncompressed entry between the segments, which must be 4 byte
+		// aligned in the output
+		if i == 0 {
+			var offset = buf.Len()
+			if err := w.WriteFile("between", 0o644, []byte("x")); err != nil {
+				t.Fatalf("WriteFile: %s", err)
+			}
+			if i := bytes.Index(buf.Bytes()[offset:], magic_070701); i < 0 || (offset+i)%4 != 0 {
+				t.Errorf("uncompressed header after a segment not aligned, found at %d", offset+i)
+			}
+		}
+	}
+
+	for _, start := range starts {
+		if start%StartCompressionAlignment != 0 {
+			t.Errorf("compressed segment starts at %d", start)
+		}
+
+		if start >= buf.Len() || buf.Bytes()[start] != 0x1f {
+			t.Errorf("expected gzip data at %d", start)
+		}
+	}
+
+	// Each compressed segment is read on its own, as the uncompressed entry
+	// between them would otherwise be read as the continuation of the first
+	var checkAligned = func(r *Reader, names ...string) {
+		for _, hdr := range r.All() {
+			if slices.Contains(names, hdr.Filename) && hdr.DataOffset%MicrocodeDataAlignment != 0 {
+				t.Errorf("%s: data offset %d not aligned", hdr.Filename, hdr.DataOffset)
+			}
+		}
+	}
+
+	checkAligned(NewReader(bytes.NewReader(buf.Bytes())), MicrocodePath_GenuineIntel)
+
+	for i, name := range []string{"init", "sbin/init"} {
+		zr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()[starts[i]:]))
+		if err != nil {
+			t.Fatalf("gzip: %s", err)
+		}
+		zr.Multistream(false)
+
+		checkAligned(NewReader(zr), name)
+	}
+}
+
+func TestGzipWriterLevel(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		w, r := testWriterReader(t)
+
+		if err := w.StartCompression(testGzipWriterLevel(t, gzip.BestSpeed)); err != nil {
+			t.Fatalf("StartCompression: %s", err)
+		}
+
+		testMkdirHeader(t, w, "/dir", nil)
+
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %s", err)
+		}
+
+		if _, _, err := r.ContinueCompressed(nil); err != nil {
+			t.Fatalf("ContinueCompressed: %s", err)
+		}
+
+		var hdrs headerList
+		hdrs.readAll(r)
+		hdrs.expectNames(t,
+			".",
+			"dir",
+		)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, level := range []int{gzip.HuffmanOnly, gzip.DefaultCompression, gzip.NoCompression, gzip.BestCompression + 1} {
+			if gw, err := GzipWriterLevel(level); gw != nil || err != ErrBadCompressionLevel {
+				t.Errorf("level %d: expected ErrBadCompressionLevel, got %v", level, err)
+			}
+		}
+	})
+}
+
+func TestWriter_ReadFromTooLarge(t *testing.T) {
+	w, _ := testWriterReader(t)
+
+	var hdr = Header{
+		Mode:     Mode_File | 0o644,
+		DataSize: 4,
+		Filename: "file",
+	}
+	testWriteHeader(t, w, &hdr)
+
+	n, err := w.ReadFrom(strings.NewReader("12345"))
+	if err != ErrFileTooLarge {
+		t.Fatalf("expected ErrFileTooLarge, got %v", err)
+	}
+
+	if n != 4 {
+		t.Errorf("expected 4 bytes written, got %d", n)
+	}
+}
+
+func TestWriter_ReadFromLeavesRemainder(t *testing.T) {
+	w, _ := testWriterReader(t)
+
+	var hdr = Header{
+		Mode:     Mode_File | 0o644,
+		DataSize: 3,
+		Filename: "file",
+	}
+	testWriteHeader(t, w, &hdr)
+
+	// Hide Len, so that the excess cannot be detected without reading it
+	var src = strings.NewReader("abcdef")
+
+	n, err := w.ReadFrom(struct{ io.Reader }{src})
+	if n != 3 || err != nil {
+		t.Fatalf("expected 3 bytes and no error, got %d and %v", n, err)
+	}
+
+	if rest, _ := io.ReadAll(src); string(rest) != "def" {
+		t.Errorf("expected source to retain %q, got %q", "def", rest)
+	}
+}
+
+func TestWriter_AddFS(t *testing.T) {
+	var fsys = fstest.MapFS{
+		"etc":          &fstest.MapFile{Mode: fs.ModeDir | 0o755},
+		"etc/hostname": &fstest.MapFile{Data: []byte("initramfs\n"), Mode: 0o644},
+		"bin/busybox":  &fstest.MapFile{Data: []byte("#!/bin/false\n"), Mode: 0o755},
+		"init":         &fstest.MapFile{Data: []byte("#!/bin/sh\n"), Mode: 0o755},
+		"empty":        &fstest.MapFile{Mode: 0o600},
+	}
+
+	w, r := testWriterReader(t)
+
+	if err := w.AddFS(fsys); err != nil {
+		t.Fatalf("AddFS: %s", err)
+	}
+
+	var hdrs headerList
+	for _, hdr := range r.All() {
+		hdrs = append(hdrs, hdr)
+
+		if expect, ok := fsys[hdr.Filename]; ok && hdr.Mode.File() {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll: %s", err)
+			}
+
+			if !bytes.Equal(data, expect.Data) {
+				t.Errorf("%s: expected data %q, got %q", hdr.Filename, expect.Data, data)
+			}
+
+			if hdr.Mode.Perms() != int(expect.Mode.Perm()) {
+				t.Errorf("%s: expected perms %#o, got %#o", hdr.Filename, expect.Mode.Perm(), hdr.Mode.Perms())
+			}
+		}
+	}
+
+	hdrs.expectNames(t,
+		".",
+		"bin",
+		"bin/busybox",
+		"empty",
+		"etc",
+		"etc/hostname",
+		"init",
+	)
+
+	t.Run("symlink", func(t *testing.T) {
+		var fsys = fstest.MapFS{
+			"bin/sh": &fstest.MapFile{Data: []byte("busybox"), Mode: fs.ModeSymlink | 0o777},
+		}
+
+		if _, ok := fs.FS(fsys).(readLinkFS); !ok {
+			t.Skip("fstest.MapFS does not support ReadLink")
+		}
+
+		w, r := testWriterReader(t)
+
+		if err := w.AddFS(fsys); err != nil {
+			t.Fatalf("AddFS: %s", err)
+		}
+
+		testNextNamed(t, r, ".")
+		testNextNamed(t, r, "bin")
+		testNextNamed(t, r, "bin/sh")
+
+		if target, err := r.ReadSymlinkTarget(); err != nil {
+			t.Fatalf("ReadSymlinkTarget: %s", err)
+		} else if target != "busybox" {
+			t.Errorf("expected target busybox, got %s", target)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		var fsys = fstest.MapFS{
+			"dev/null": &fstest.MapFile{Mode: fs.ModeDevice | fs.ModeCharDevice | 0o666},
+		}
+
+		w, _ := testWriterReader(t)
+
+		err := w.AddFS(fsys)
+
+		var pathErr *fs.PathError
+		if !errors.As(err, &pathErr) || pathErr.Path != "dev/null" || !errors.Is(err, ErrUnsupportedFileType) {
+			t.Fatalf("expected ErrUnsupportedFileType for dev/null, got %v", err)
+		}
+	})
+}
+
+func TestWriter_SetStrictPaths(t *testing.T) {
+	w, r := testWriterReader(t)
+	w.SetStrictPaths(true)
+
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Filename: "//etc/./hostname"})
+
+	if err := w.WriteHeader(&Header{Mode: Mode_File | 0o644, Filename: "../escape"}); err != ErrUnsafePath {
+		t.Fatalf("expected ErrUnsafePath, got %v", err)
+	}
+
+	var hdrs headerList
+	hdrs.readAll(r)
+	hdrs.expectNames(t,
+		".",
+		"etc",
+		"etc/hostname",
+	)
+}
+
+func TestWriter_SetAllDataAlignment(t *testing.T) {
+	const pageSize = DataAlignment4K
+
+	w, r := testWriterReader(t)
+
+	if err := w.SetAllDataAlignment(pageSize); err != nil {
+		t.Fatalf("SetAllDataAlignment: %s", err)
+	}
+
+	// Each filename length is chosen such that the header plus filename
+	// is a multiple of 4 bytes long
+	for _, name := range []string{"a", "bin/x", "lib/blob1", "lib/blob2"} {
+		var hdr = Header{
+			Mode:     Mode_File | 0o644,
+			DataSize: 100,
+			Filename: name,
+		}
+		testWriteHeader(t, w, &hdr)
+		w.Write(bytes.Repeat([]byte{0xAA}, 100))
+	}
+
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	var files int
+	for _, hdr := range r.All() {
+		if !hdr.Mode.File() {
+			continue
+		}
+
+		files++
+
+		if hdr.DataOffset%pageSize != 0 {
+			t.Errorf("%s: data offset %d is not page aligned", hdr.Filename, hdr.DataOffset)
+		}
+	}
+
+	if files != 4 {
+		t.Errorf("expected 4 files, got %d", files)
+	}
+
+	if err := w.SetAllDataAlignment(3); err != ErrBadAlignment {
+		t.Errorf("expected ErrBadAlignment, got %v", err)
+	}
+}
+
+func TestWriter_SetDefaultDataAlignment(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	if err := w.SetDefaultDataAlignment(16); err != nil {
+		t.Fatalf("SetDefaultDataAlignment: %s", err)
+	}
+
+	testMkdirAll(t, w, "bin", 0o755)
+	testMkdirAll(t, w, "lib", 0o755)
+
+	// Filenames are chosen as for TestWriter_SetAllDataAlignment, and the
+	// second file alone overrides the default
+	var expect = map[string]int64{"a": 16, "bin/x": 64, "lib/blob1": 16}
+
+	for _, name := range []string{"a", "bin/x", "lib/blob1"} {
+		if name == "bin/x" {
+			if err := w.SetDataAlignment(64); err != nil {
+				t.Fatalf("SetDataAlignment: %s", err)
+			}
+		}
+
+		if err := w.WriteFile(name, 0o644, []byte(name)); err != nil {
+			t.Fatalf("WriteFile %s: %s", name, err)
+		}
+	}
+
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	for _, hdr := range r.All() {
+		if alignTo, ok := expect[hdr.Filename]; ok && hdr.DataOffset%alignTo != 0 {
+			t.Errorf("%s: data offset %d is not aligned to %d", hdr.Filename, hdr.DataOffset, alignTo)
+		}
+	}
+
+	if err := w.SetDefaultDataAlignment(6); err != ErrBadAlignment {
+		t.Errorf("expected ErrBadAlignment, got %v", err)
+	}
+}
+
+func TestWriter_DataAlignment4K(t *testing.T) {
+	var blob = bytes.Repeat([]byte{0xAA, 0x55}, 2048)
+
+	for _, prefix := range []string{"", DefaultAlignmentPadPrefix} {
+		w, r := testWriterReader(t)
+
+		w.SetAlignmentPadEntries(prefix)
+
+		for _, name := range []string{"lib/firmware/blob.bin", "lib/firmware/vendor/blob2.bin"} {
+			if err := w.SetDataAlignment(DataAlignment4K); err != nil {
+				t.Fatalf("SetDataAlignment: %s", err)
+			}
+
+			if err := w.WriteFile(name, 0o644, blob); err != nil {
+				t.Fatalf("WriteFile %s: %s", name, err)
+			}
+		}
+
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+
+		var blobs int
+		for _, hdr := range r.All() {
+			if !strings.HasSuffix(hdr.Filename, ".bin") {
+				continue
+			}
+
+			blobs++
+
+			if hdr.DataOffset%DataAlignment4K != 0 {
+				t.Errorf("%q: %s: data offset %d is not page aligned", prefix, hdr.Filename, hdr.DataOffset)
+			}
+
+			if data, err := io.ReadAll(r); err != nil || !bytes.Equal(data, blob) {
+				t.Errorf("%q: %s: unexpected data (%v)", prefix, hdr.Filename, err)
+			}
+		}
+
+		if blobs != 2 {
+			t.Errorf("%q: expected 2 blobs, got %d", prefix, blobs)
+		}
+	}
+}
+
+func TestWriter_WriteFile(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	if err := w.WriteFile("/etc/hostname", 0o644, []byte("initramfs\n")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	if err := w.WriteFileReader("/init", Mode_Dir|0o755, 10, strings.NewReader("#!/bin/sh\n")); err != nil {
+		t.Fatalf("WriteFileReader: %s", err)
+	}
+
+	if err := w.WriteFileReader("short", 0o644, 10, strings.NewReader("short")); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	if err := w.WriteFileReader("long", 0o644, 2, strings.NewReader("long")); err != ErrFileTooLarge {
+		t.Fatalf("expected ErrFileTooLarge, got %v", err)
+	}
+
+	if err := w.WriteFileReader("huge", 0o644, MaxDataSize+1, strings.NewReader("")); err != ErrFileTooLarge {
+		t.Fatalf("expected ErrFileTooLarge, got %v", err)
+	}
+
+	var expect = map[string]struct {
+		mode Mode
+		data string
+	}{
+		"etc/hostname": {Mode_File | 0o644, "initramfs\n"},
+		"init":         {Mode_File | 0o755, "#!/bin/sh\n"},
+	}
+
+	for _, hdr := range r.All() {
+		e, ok := expect[hdr.Filename]
+		if !ok {
+			continue
+		}
+
+		delete(expect, hdr.Filename)
+
+		if hdr.Mode != e.mode {
+			t.Errorf("%s: expected mode %s, got %s", hdr.Filename, e.mode, hdr.Mode)
+		}
+
+		data, _ := io.ReadAll(r)
+		if string(data) != e.data {
+			t.Errorf("%s: expected data %q, got %q", hdr.Filename, e.data, data)
+		}
+	}
+
+	if len(expect) > 0 {
+		t.Errorf("missing entries: %v", expect)
+	}
+}
+
+func TestWriter_WriteSymlink(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	if err := w.WriteSymlink("/bin/sh", "busybox", 0); err != nil {
+		t.Fatalf("WriteSymlink: %s", err)
+	}
+
+	if err := w.WriteSymlink("/bin/ls", "busybox", Mode_File|0o755); err != nil {
+		t.Fatalf("WriteSymlink: %s", err)
+	}
+
+	testNextNamed(t, r, ".")
+	testNextNamed(t, r, "bin")
+
+	for _, expect := range []struct {
+		name string
+		mode Mode
+	}{
+		{"bin/sh", Mode_Symlink | 0o777},
+		{"bin/ls", Mode_Symlink | 0o755},
+	} {
+		hdr := testNextNamed(t, r, expect.name)
+
+		if hdr.Mode != expect.mode {
+			t.Errorf("%s: expected mode %s, got %s", expect.name, expect.mode, hdr.Mode)
+		}
+
+		if target, err := r.ReadSymlinkTarget(); err != nil {
+			t.Fatalf("ReadSymlinkTarget: %s", err)
+		} else if target != "busybox" {
+			t.Errorf("%s: expected target busybox, got %s", expect.name, target)
+		}
+	}
+}
+
+func TestWriter_SetDefaultMagic(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	if err := w.SetDefaultMagic("070707"); !errors.Is(err, ErrBadHeaderMagic) {
+		t.Fatalf("expected ErrBadHeaderMagic, got %v", err)
+	}
+
+	if err := w.SetDefaultMagic(Magic_070702); err != nil {
+		t.Fatalf("SetDefaultMagic: %s", err)
+	}
+
+	testMkdirAll(t, w, "etc", 0o755)
+	testWriteHeader(t, w, &Header{Magic: Magic_070701, Mode: Mode_File | 0o644, Filename: "etc/fstab"})
+	testWriteHeader(t, w, &Header{Mode: Mode_File | 0o644, Filename: "etc/hosts"})
+
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	for _, expect := range []struct {
+		name  string
+		magic string
+	}{
+		{".", Magic_070702},
+		{"etc", Magic_070702},
+		{"etc/fstab", Magic_070701},
+		{"etc/hosts", Magic_070702},
+		{TrailerFilename, Magic_070702},
+	} {
+		hdr := testNextNamed(t, r, expect.name)
+
+		if hdr.Magic != expect.magic {
+			t.Errorf("%s: expected magic %s, got %s", expect.name, expect.magic, hdr.Magic)
+		}
+	}
+}
+
+func TestWriter_SetDirMetadata(t *testing.T) {
+	w, r := testWriterReader(t)
+
+	var mtime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	w.SetDirMetadata(map[string]Header{
+		"/":        {Mode: 0o755},
+		"/usr/bin": {Mode: Mode_File | 0o750, Uid: 10, Gid: 20, Mtime: mtime},
+	})
+
+	if err := w.WriteFile("usr/bin/tool", 0o755, []byte("#!/bin/sh\n")); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	for _, expect := range []struct {
+		name     string
+		mode     Mode
+		uid, gid uint32
+		mtime    time.Time
+	}{
+		{".", Mode_Dir | 0o755, 0, 0, time.Unix(0, 0)},
+		{"usr", Mode_Dir | DefaultMkdirPerm, 0, 0, time.Unix(0, 0)},
+		{"usr/bin", Mode_Dir | 0o750, 10, 20, mtime},
+	} {
+		hdr := testNextNamed(t, r, expect.name)
+
+		if hdr.Mode != expect.mode {
+			t.Errorf("%s: expected mode %s, got %s", expect.name, expect.mode, hdr.Mode)
+		}
+		if hdr.Uid != expect.uid || hdr.Gid != expect.gid {
+			t.Errorf("%s: expected owner %d:%d, got %d:%d", expect.name, expect.uid, expect.gid, hdr.Uid, hdr.Gid)
+		}
+		if !hdr.Mtime.Equal(expect.mtime) {
+			t.Errorf("%s: expected mtime %s, got %s", expect.name, expect.mtime, hdr.Mtime)
+		}
+	}
+
+	testNextNamed(t, r, "usr/bin/tool")
+}
+
+func TestWriter_SetTrailerPadding(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		var buf bytes.Buffer
+
+		w := NewWriter(&buf)
+		w.SetTrailerPadding(512)
+
+		if compress {
+			if err := w.StartCompression(GzipWriter); err != nil {
+				t.Fatalf("StartCompression: %s", err)
+			}
+		}
+
+		if err := w.WriteFile("init", 0o755, []byte("#!/bin/sh\n")); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %s", err)
+		}
+
+		if n := buf.Len(); n == 0 || n%512 != 0 {
+			t.Errorf("compress=%v: expected size to be a multiple of 512, got %d", compress, n)
+		}
+
+		// The padding after a compressed stream must not be mistaken for
+		// further compressed data
+		var raw = bytes.Clone(buf.Bytes())
+
+		ar, err := NewAutoReader(bytes.NewReader(raw), nil)
+		if err != nil {
+			t.Fatalf("NewAutoReader: %s", err)
+		}
+		for _, err := range ar.AllErr() {
+			if err != nil {
+				t.Errorf("compress=%v: AllErr: %s", compress, err)
+			}
+		}
+
+		for _, err := range NewReader(bytes.NewReader(raw)).Segments() {
+			if err != nil {
+				t.Errorf("compress=%v: Segments: %s", compress, err)
+			}
+		}
+
+		if err := Validate(NewReader(bytes.NewReader(raw))); err != nil {
+			t.Errorf("compress=%v: Validate: %s", compress, err)
+		}
+
+		r := NewReader(&buf)
+		if compress {
+			if _, _, err := r.ContinueCompressed(nil); err != nil {
+				t.Fatalf("ContinueCompressed: %s", err)
+			}
+		}
+
+		var hdrs headerList
+		hdrs.readAll(r)
+		hdrs.expectNames(t, ".", "init", TrailerFilename)
+	}
+}
+
+func TestWriter_Reset(t *testing.T) {
+	var build = func(w *Writer) {
+		if err := w.WriteFile("etc/hostname", 0o644, []byte("host\n")); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+		if err := w.WriteTrailer(); err != nil {
+			t.Fatalf("WriteTrailer: %s", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %s", err)
+		}
+	}
+
+	var a, b bytes.Buffer
+
+	w := NewWriter(&a)
+	if err := w.SetDefaultMagic(Magic_070702); err != nil {
+		t.Fatalf("SetDefaultMagic: %s", err)
+	}
+	build(w)
+
+	w.Reset(&b)
+	build(w)
+
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Errorf("expected identical archives after Reset, got %d and %d bytes", a.Len(), b.Len())
+	}
+	if !bytes.HasPrefix(b.Bytes(), []byte(Magic_070702)) {
+		t.Errorf("expected default magic to be retained after Reset")
+	}
+}
+
+func TestWriter_WriteOverflow(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		w   = NewWriter(&buf)
+		hdr = Header{Mode: Mode_File | 0o644, DataSize: 10, Filename: "data"}
+	)
+
+	if err := w.WriteHeader(&hdr); err != nil {
+		t.Fatalf("WriteHeader: %s", err)
+	}
+
+	// Hide ReadFrom, so that io.Copy uses Write
+	var ww = struct{ io.Writer }{w}
+
+	if n, err := io.Copy(ww, strings.NewReader("0123456")); n != 7 || err != nil {
+		t.Fatalf("io.Copy: expected 7 bytes and no error, got %d and %v", n, err)
+	}
+
+	if n, err := io.Copy(ww, strings.NewReader("789abc")); n != 3 || err != ErrFileTooLarge {
+		t.Fatalf("io.Copy: expected 3 bytes and ErrFileTooLarge, got %d and %v", n, err)
+	}
+
+	if n, err := w.Write([]byte("d")); n != 0 || err != ErrFileTooLarge {
+		t.Errorf("Write: expected 0 bytes and ErrFileTooLarge, got %d and %v", n, err)
+	}
+	if n, err := w.Write(nil); n != 0 || err != nil {
+		t.Errorf("Write: expected nothing for an empty buffer, got %d and %v", n, err)
+	}
+
+	if n, err := w.ReadFrom(strings.NewReader("d")); n != 0 || err != ErrFileTooLarge {
+		t.Errorf("ReadFrom: expected 0 bytes and ErrFileTooLarge, got %d and %v", n, err)
+	}
+	if n, err := w.ReadFrom(struct{ io.Reader }{strings.NewReader("d")}); n != 0 || err != ErrFileTooLarge {
+		t.Errorf("ReadFrom: expected 0 bytes and ErrFileTooLarge, got %d and %v", n, err)
+	}
+	if n, err := w.ReadFrom(strings.NewReader("")); n != 0 || err != nil {
+		t.Errorf("ReadFrom: expected nothing for an empty source, got %d and %v", n, err)
+	}
+
+	if err := w.WriteTrailer(); err != nil {
+		t.Fatalf("WriteTrailer: %s", err)
+	}
+
+	r := NewReader(&buf)
+	testNextNamed(t, r, ".")
+	testNextNamed(t, r, "data")
+
+	if data, err := io.ReadAll(r); err != nil || string(data) != "0123456789" {
+		t.Errorf("expected data %q, got %q (%v)", "0123456789", data, err)
+	}
+}
+
+func TestWriter_SetAutoTrailer(t *testing.T) {
+	var testcases = []struct {
+		name   string
+		write  func(w *Writer) error
+		expect []string
+	}{
+		{"empty", func(w *Writer) error { return nil }, []string{TrailerFilename}},
+		{"entries", func(w *Writer) error {
+			return w.WriteFile("init", 0o755, nil)
+		}, []string{".", "init", TrailerFilename}},
+		{"trailer already written", func(w *Writer) error {
+			if err := w.WriteFile("init", 0o755, nil); err != nil {
+				return err
+			}
+			return w.WriteTrailer()
+		}, []string{".", "init", TrailerFilename}},
+		{"entries after trailer", func(w *Writer) error {
+			if err := w.WriteFile("init", 0o755, nil); err != nil {
+				return err
+			}
+			if err := w.WriteTrailer(); err != nil {
+				return err
+			}
+			return w.WriteFile("etc/motd", 0o644, []byte("hi"))
+		}, []string{".", "init", TrailerFilename, ".", "etc", "etc/motd", TrailerFilename}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			w, err := NewWriterOptions(&buf, WithAutoTrailer())
+			if err != nil {
+				t.Fatalf("NewWriterOptions: %s", err)
+			}
+
+			if err := tc.write(w); err != nil {
+				t.Fatalf("write: %s", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %s", err)
+			}
+
+			var hdrs headerList
+			hdrs.readAll(NewReader(&buf))
+			hdrs.expectNames(t, tc.expect...)
+		})
+	}
+}
+
+func TestWriter_SetRewriteName(t *testing.T) {
+	var rewrite = func(name string) (string, bool) {
+		if strings.HasSuffix(name, ".bak") {
+			return "", false
+		}
+		if rest, ok := strings.CutPrefix(name, "old/"); ok {
+			return "new/dir/" + rest, true
+		}
+		return name, true
+	}
+
+	raw, err := Build(func(iw *Writer) error {
+		if err := iw.WriteFile("old/a", 0o644, []byte("a")); err != nil {
+			return err
+		}
+
+		// Dropped entries, whose data and alignment must not leak
+		if err := iw.SetDataAlignment(512); err != nil {
+			return err
+		}
+		if err := iw.WriteFile("old/a.bak", 0o644, []byte("backup")); err != nil {
+			return err
+		}
+		if err := iw.WriteHeader(&Header{Mode: Mode_File | 0o644, DataSize: 10, Filename: "b.bak"}); err != nil {
+			return err
+		}
+		if _, err := iw.Write([]byte("partial")); err != nil {
+			return err
+		}
+
+		if err := iw.WriteFile("init", 0o755, []byte("init")); err != nil {
+			return err
+		}
+
+		return iw.WriteHeader(&Header{Mode: Mode_File | 0o644, DataSize: 3, Filename: "c.bak"})
+	}, WithRewriteName(rewrite))
+	if err != nil {
+		t.Fatalf("Build: %s", err)
+	}
+
+	var r = NewReader(bytes.NewReader(raw))
+	r.SetStrict(true)
+
+	var hdrs headerList
+	for hdr, err := range r.AllErr() {
+		if err != nil {
+			t.Fatalf("AllErr: %s", err)
+		}
+		hdrs = append(hdrs, hdr)
+
+		if hdr.Mode.File() && hdr.DataSize > 0 {
+			if data, err := io.ReadAll(r); err != nil || path.Base(hdr.Filename) != string(data) {
+				t.Errorf("%s: unexpected data %q (%v)", hdr.Filename, data, err)
+			}
+		}
+	}
+
+	hdrs.expectNames(t, ".", "new", "new/dir", "new/dir/a", "init", TrailerFilename)
+}